@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"github.com/aq-simei/coin-pilot/api/middlewares"
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/service"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController interface {
+	SearchUsers(c *gin.Context)
+	SuspendUser(c *gin.Context)
+	ReactivateUser(c *gin.Context)
+	ListAuditLogs(c *gin.Context)
+	ListJobs(c *gin.Context)
+	RetryJob(c *gin.Context)
+}
+
+type AdminControllerImpl struct {
+	service service.AdminService
+}
+
+func NewAdminController(service service.AdminService) AdminController {
+	return &AdminControllerImpl{
+		service: service,
+	}
+}
+
+// RegisterAdminRoutes registers the admin routes, the group must be guarded by
+// JwtMiddleware and AuditMiddleware.
+func RegisterAdminRoutes(router *gin.RouterGroup, controller AdminController) {
+	router.GET("/users", middlewares.RequirePermission(models.PermUsersRead), controller.SearchUsers)
+	router.POST("/users/:id/suspend", middlewares.RequirePermission(models.PermUsersManage), controller.SuspendUser)
+	router.POST("/users/:id/reactivate", middlewares.RequirePermission(models.PermUsersManage), controller.ReactivateUser)
+	router.GET("/audit-logs", middlewares.RequirePermission(models.PermAuditRead), controller.ListAuditLogs)
+	router.GET("/jobs", middlewares.RequirePermission(models.PermJobsRead), controller.ListJobs)
+	router.POST("/jobs/:id/retry", middlewares.RequirePermission(models.PermJobsManage), controller.RetryJob)
+}
+
+func (ac *AdminControllerImpl) SearchUsers(c *gin.Context) {
+	var filter models.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		responses.BadRequest(c, "Invalid query parameters")
+		return
+	}
+
+	page, err := ac.service.SearchUsers(c, filter)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, page)
+}
+
+func (ac *AdminControllerImpl) SuspendUser(c *gin.Context) {
+	var payload models.SuspendUserPayload
+	// The reason is optional, an empty body is fine
+	_ = c.ShouldBindJSON(&payload)
+	if payload.Reason != "" {
+		c.Set("audit_details", payload.Reason)
+	}
+
+	if err := ac.service.SuspendUser(c, c.GetString("user_id"), c.Param("id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "User suspended successfully")
+}
+
+func (ac *AdminControllerImpl) ReactivateUser(c *gin.Context) {
+	if err := ac.service.ReactivateUser(c, c.Param("id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "User reactivated successfully")
+}
+
+func (ac *AdminControllerImpl) ListAuditLogs(c *gin.Context) {
+	var filter models.AuditLogFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		responses.BadRequest(c, "Invalid query parameters")
+		return
+	}
+
+	page, err := ac.service.ListAuditLogs(c, filter)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, page)
+}
+
+func (ac *AdminControllerImpl) ListJobs(c *gin.Context) {
+	var filter models.JobFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		responses.BadRequest(c, "Invalid query parameters")
+		return
+	}
+
+	page, err := ac.service.ListJobs(c, filter)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, page)
+}
+
+func (ac *AdminControllerImpl) RetryJob(c *gin.Context) {
+	job, err := ac.service.RetryJob(c, c.Param("id"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, job)
+}
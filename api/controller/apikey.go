@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/service"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController interface {
+	CreateAPIKey(c *gin.Context)
+	ListAPIKeys(c *gin.Context)
+	RevokeAPIKey(c *gin.Context)
+}
+
+type APIKeyControllerImpl struct {
+	service service.APIKeyService
+}
+
+func NewAPIKeyController(service service.APIKeyService) APIKeyController {
+	return &APIKeyControllerImpl{
+		service: service,
+	}
+}
+
+// RegisterAPIKeyRoutes registers the key management routes, the group must be
+// guarded by JwtMiddleware so keys cannot mint other keys.
+func RegisterAPIKeyRoutes(router *gin.RouterGroup, controller APIKeyController) {
+	router.GET("/me/api-keys", controller.ListAPIKeys)
+	router.POST("/me/api-keys", controller.CreateAPIKey)
+	router.DELETE("/me/api-keys/:id", controller.RevokeAPIKey)
+}
+
+func (kc *APIKeyControllerImpl) CreateAPIKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var payload models.CreateAPIKeyPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	key, err := kc.service.CreateAPIKey(c, userID, payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Created(c, key)
+}
+
+func (kc *APIKeyControllerImpl) ListAPIKeys(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	keys, err := kc.service.ListAPIKeys(c, userID)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, keys)
+}
+
+func (kc *APIKeyControllerImpl) RevokeAPIKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := kc.service.RevokeAPIKey(c, userID, c.Param("id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "API key revoked successfully")
+}
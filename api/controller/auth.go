@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/service"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	"github.com/gin-gonic/gin"
+)
+
+type AuthController interface {
+	Login(c *gin.Context)
+	Callback(c *gin.Context)
+	Link(c *gin.Context)
+}
+
+type AuthControllerImpl struct {
+	service service.AuthService
+}
+
+func NewAuthController(service service.AuthService) AuthController {
+	return &AuthControllerImpl{
+		service: service,
+	}
+}
+
+func RegisterAuthRoutes(router *gin.RouterGroup, controller AuthController) {
+	router.GET("/:provider/login", controller.Login)
+	router.GET("/:provider/callback", controller.Callback)
+}
+
+// RegisterAuthLinkRoutes registers the routes of logged in users.
+func RegisterAuthLinkRoutes(router *gin.RouterGroup, controller AuthController) {
+	router.POST("/:provider/link", controller.Link)
+}
+
+func (ac *AuthControllerImpl) Login(c *gin.Context) {
+	authURL, err := ac.service.BeginLogin(c, c.Param("provider"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+func (ac *AuthControllerImpl) Callback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		responses.Unauthorized(c, "Login cancelled: "+providerErr)
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+	if state == "" || code == "" {
+		responses.BadRequest(c, "Missing state or code")
+		return
+	}
+
+	token, err := ac.service.CompleteLogin(c, c.Param("provider"), state, code)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+
+	responses.Success(c, gin.H{"token": token})
+}
+
+// Link returns the provider URL to send the user to, the callback then links
+// the provider account to the user logged in.
+func (ac *AuthControllerImpl) Link(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	authURL, err := ac.service.BeginLink(c, userID, c.Param("provider"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, gin.H{"url": authURL})
+}
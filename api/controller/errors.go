@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"net/http"
+
+	responses "github.com/aq-simei/coin-pilot/internal"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/gin-gonic/gin"
+)
+
+// writeAppError maps an AppError onto the matching response envelope.
+func writeAppError(c *gin.Context, err error) {
+	if appErr, ok := errors.IsAppError(err); ok {
+		switch appErr.Code {
+		case http.StatusBadRequest:
+			responses.BadRequest(c, appErr.Message)
+		case http.StatusUnauthorized:
+			responses.Unauthorized(c, appErr.Message)
+		case http.StatusForbidden:
+			responses.Forbidden(c, appErr.Message)
+		case http.StatusNotFound:
+			responses.NotFound(c, appErr.Message)
+		case http.StatusTooManyRequests:
+			responses.TooManyRequests(c, appErr.Message)
+		case http.StatusInternalServerError:
+			responses.InternalServerError(c, appErr.Message)
+		default:
+			responses.CustomError(c, appErr.Code, appErr.Message)
+		}
+		return
+	}
+	responses.InternalServerError(c, "Unexpected error occurred")
+}
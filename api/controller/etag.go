@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordETag is the strong entity tag of a record at version.
+func recordETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion reads the version the client expects from If-Match. "*"
+// matches any version and returns 0, a tag that cannot match any record,
+// like a weak one, returns -1.
+func ifMatchVersion(c *gin.Context) (version int64, present bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) || version < 1 {
+		return -1, true
+	}
+	return version, true
+}
+
+// ifNoneMatch reports whether If-None-Match lists etag, using the weak
+// comparison RFC 9110 asks for on GET.
+func ifNoneMatch(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
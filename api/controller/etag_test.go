@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func contextWithHeader(name, value string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if value != "" {
+		c.Request.Header.Set(name, value)
+	}
+	return c
+}
+
+func TestRecordETag(t *testing.T) {
+	if got := recordETag(42); got != `"42"` {
+		t.Fatalf("recordETag(42) = %s", got)
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		header      string
+		wantVersion int64
+		wantPresent bool
+	}{
+		{"", 0, false},
+		{"   ", 0, false},
+		{"*", 0, true},
+		{`"3"`, 3, true},
+		{` "3" `, 3, true},
+		{`"9223372036854775807"`, 9223372036854775807, true},
+		{"3", -1, true},
+		{`"3`, -1, true},
+		{`3"`, -1, true},
+		{`W/"3"`, -1, true},
+		{`"0"`, -1, true},
+		{`"-2"`, -1, true},
+		{`"abc"`, -1, true},
+		{`"3", "4"`, -1, true},
+		{`"9223372036854775808"`, -1, true},
+	}
+	for _, tt := range tests {
+		version, present := ifMatchVersion(contextWithHeader("If-Match", tt.header))
+		if version != tt.wantVersion || present != tt.wantPresent {
+			t.Errorf("If-Match %q = (%d, %v), want (%d, %v)", tt.header, version, present, tt.wantVersion, tt.wantPresent)
+		}
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	etag := recordETag(3)
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{`"2", "3"`, true},
+		{`"2",W/"3"`, true},
+		{"*", true},
+		{`"2"`, false},
+		{`"33"`, false},
+		{"3", false},
+	}
+	for _, tt := range tests {
+		if got := ifNoneMatch(contextWithHeader("If-None-Match", tt.header), etag); got != tt.want {
+			t.Errorf("If-None-Match %q with %s = %v, want %v", tt.header, etag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package controller
+
+import (
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/service"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	"github.com/gin-gonic/gin"
+)
+
+type GroupController interface {
+	ListGroups(c *gin.Context)
+	CreateGroup(c *gin.Context)
+	GetGroup(c *gin.Context)
+	UpdateGroup(c *gin.Context)
+	DeleteGroup(c *gin.Context)
+	AddMember(c *gin.Context)
+	RemoveMember(c *gin.Context)
+	ListExpenses(c *gin.Context)
+	CreateExpense(c *gin.Context)
+	GetExpense(c *gin.Context)
+	DeleteExpense(c *gin.Context)
+	ListSettlements(c *gin.Context)
+	CreateSettlement(c *gin.Context)
+	DeleteSettlement(c *gin.Context)
+	GetBalances(c *gin.Context)
+}
+
+type GroupControllerImpl struct {
+	service service.GroupService
+}
+
+func NewGroupController(service service.GroupService) GroupController {
+	return &GroupControllerImpl{
+		service: service,
+	}
+}
+
+// RegisterGroupRoutes registers the group expense routes.
+func RegisterGroupRoutes(router *gin.RouterGroup, controller GroupController) {
+	router.GET("", controller.ListGroups)
+	router.POST("", controller.CreateGroup)
+	router.GET("/:id", controller.GetGroup)
+	router.PATCH("/:id", controller.UpdateGroup)
+	router.DELETE("/:id", controller.DeleteGroup)
+	router.POST("/:id/members", controller.AddMember)
+	router.DELETE("/:id/members/:member_id", controller.RemoveMember)
+	router.GET("/:id/expenses", controller.ListExpenses)
+	router.POST("/:id/expenses", controller.CreateExpense)
+	router.GET("/:id/expenses/:expense_id", controller.GetExpense)
+	router.DELETE("/:id/expenses/:expense_id", controller.DeleteExpense)
+	router.GET("/:id/settlements", controller.ListSettlements)
+	router.POST("/:id/settlements", controller.CreateSettlement)
+	router.DELETE("/:id/settlements/:settlement_id", controller.DeleteSettlement)
+	router.GET("/:id/balances", controller.GetBalances)
+}
+
+func (gc *GroupControllerImpl) ListGroups(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	groups, err := gc.service.ListGroups(c, userID)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, groups)
+}
+
+// CreateGroup creates a group the current user is a member of, along with
+// placeholder members.
+func (gc *GroupControllerImpl) CreateGroup(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var payload models.CreateGroupPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	group, err := gc.service.CreateGroup(c, userID, payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Created(c, group)
+}
+
+func (gc *GroupControllerImpl) GetGroup(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	group, err := gc.service.GetGroup(c, userID, c.Param("id"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, group)
+}
+
+func (gc *GroupControllerImpl) UpdateGroup(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var payload models.UpdateGroupPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	group, err := gc.service.UpdateGroup(c, userID, c.Param("id"), payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, group)
+}
+
+// DeleteGroup deletes the group with its expenses and settlements.
+func (gc *GroupControllerImpl) DeleteGroup(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := gc.service.DeleteGroup(c, userID, c.Param("id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Group deleted")
+}
+
+// AddMember adds a member by email or a placeholder by name.
+func (gc *GroupControllerImpl) AddMember(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var payload models.AddGroupMemberPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	member, err := gc.service.AddMember(c, userID, c.Param("id"), payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Created(c, member)
+}
+
+// RemoveMember removes a member who has no expenses or settlements.
+func (gc *GroupControllerImpl) RemoveMember(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := gc.service.RemoveMember(c, userID, c.Param("id"), c.Param("member_id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Member removed")
+}
+
+func (gc *GroupControllerImpl) ListExpenses(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var filter models.GroupExpenseFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		responses.BadRequest(c, "Invalid query parameters")
+		return
+	}
+
+	expenses, err := gc.service.ListExpenses(c, userID, c.Param("id"), filter)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, expenses)
+}
+
+// CreateExpense splits an expense between members. A record_id is looked up
+// in the ledger selected by the X-Ledger-ID header.
+func (gc *GroupControllerImpl) CreateExpense(c *gin.Context) {
+	scope, ok := ledgerScope(c)
+	if !ok {
+		return
+	}
+	var payload models.CreateGroupExpensePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	expense, err := gc.service.CreateExpense(c, scope, c.Param("id"), payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Created(c, expense)
+}
+
+func (gc *GroupControllerImpl) GetExpense(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	expense, err := gc.service.GetExpense(c, userID, c.Param("id"), c.Param("expense_id"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, expense)
+}
+
+func (gc *GroupControllerImpl) DeleteExpense(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := gc.service.DeleteExpense(c, userID, c.Param("id"), c.Param("expense_id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Expense deleted")
+}
+
+func (gc *GroupControllerImpl) ListSettlements(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	settlements, err := gc.service.ListSettlements(c, userID, c.Param("id"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, settlements)
+}
+
+// CreateSettlement records a payment from one member to another.
+func (gc *GroupControllerImpl) CreateSettlement(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var payload models.CreateSettlementPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	settlement, err := gc.service.CreateSettlement(c, userID, c.Param("id"), payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Created(c, settlement)
+}
+
+func (gc *GroupControllerImpl) DeleteSettlement(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := gc.service.DeleteSettlement(c, userID, c.Param("id"), c.Param("settlement_id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Settlement deleted")
+}
+
+// GetBalances returns the balance of each member and who owes whom.
+func (gc *GroupControllerImpl) GetBalances(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	balances, err := gc.service.Balances(c, userID, c.Param("id"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, balances)
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/service"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController interface {
+	Livez(c *gin.Context)
+	Readyz(c *gin.Context)
+}
+
+type HealthControllerImpl struct {
+	service service.HealthService
+}
+
+func NewHealthController(service service.HealthService) HealthController {
+	return &HealthControllerImpl{
+		service: service,
+	}
+}
+
+// RegisterHealthRoutes registers the probes, /health is kept as an alias of
+// /readyz for existing monitors.
+func RegisterHealthRoutes(router gin.IRoutes, controller HealthController) {
+	router.GET("/livez", controller.Livez)
+	router.GET("/readyz", controller.Readyz)
+	router.GET("/health", controller.Readyz)
+}
+
+// Livez only tells that the process serves requests, it never checks
+// dependencies so a database outage does not get the pod restarted.
+func (hc *HealthControllerImpl) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": models.HealthOK})
+}
+
+func (hc *HealthControllerImpl) Readyz(c *gin.Context) {
+	report := hc.service.Ready(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != models.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/service"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	"github.com/gin-gonic/gin"
+)
+
+type LedgerController interface {
+	ListLedgers(c *gin.Context)
+	CreateLedger(c *gin.Context)
+	GetLedger(c *gin.Context)
+	UpdateLedger(c *gin.Context)
+	DeleteLedger(c *gin.Context)
+	ListMembers(c *gin.Context)
+	UpdateMember(c *gin.Context)
+	RemoveMember(c *gin.Context)
+	ListInvitations(c *gin.Context)
+	CreateInvitation(c *gin.Context)
+	RevokeInvitation(c *gin.Context)
+	AcceptInvitation(c *gin.Context)
+	DeclineInvitation(c *gin.Context)
+}
+
+type LedgerControllerImpl struct {
+	service service.LedgerService
+}
+
+func NewLedgerController(service service.LedgerService) LedgerController {
+	return &LedgerControllerImpl{
+		service: service,
+	}
+}
+
+// RegisterLedgerRoutes registers the ledger management routes.
+func RegisterLedgerRoutes(router *gin.RouterGroup, controller LedgerController) {
+	router.GET("", controller.ListLedgers)
+	router.POST("", controller.CreateLedger)
+	router.GET("/:id", controller.GetLedger)
+	router.PATCH("/:id", controller.UpdateLedger)
+	router.DELETE("/:id", controller.DeleteLedger)
+	router.GET("/:id/members", controller.ListMembers)
+	router.PATCH("/:id/members/:user_id", controller.UpdateMember)
+	router.DELETE("/:id/members/:user_id", controller.RemoveMember)
+	router.GET("/:id/invitations", controller.ListInvitations)
+	router.POST("/:id/invitations", controller.CreateInvitation)
+	router.DELETE("/:id/invitations/:invitation_id", controller.RevokeInvitation)
+}
+
+// RegisterInvitationRoutes registers the routes invitees answer invitations
+// with.
+func RegisterInvitationRoutes(router *gin.RouterGroup, controller LedgerController) {
+	router.POST("/accept", controller.AcceptInvitation)
+	router.POST("/decline", controller.DeclineInvitation)
+}
+
+func (lc *LedgerControllerImpl) ListLedgers(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ledgers, err := lc.service.ListLedgers(c, userID)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, ledgers)
+}
+
+func (lc *LedgerControllerImpl) CreateLedger(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var payload models.CreateLedgerPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	ledger, err := lc.service.CreateLedger(c, userID, payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Created(c, ledger)
+}
+
+func (lc *LedgerControllerImpl) GetLedger(c *gin.Context) {
+	scope, ok := pathLedgerScope(c)
+	if !ok {
+		return
+	}
+
+	ledger, err := lc.service.GetLedger(c, scope)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, ledger)
+}
+
+// UpdateLedger renames the ledger, only owners can.
+func (lc *LedgerControllerImpl) UpdateLedger(c *gin.Context) {
+	scope, ok := pathLedgerScope(c)
+	if !ok {
+		return
+	}
+	var payload models.UpdateLedgerPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	ledger, err := lc.service.UpdateLedger(c, scope, payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, ledger)
+}
+
+// DeleteLedger deletes a shared ledger and every record in it.
+func (lc *LedgerControllerImpl) DeleteLedger(c *gin.Context) {
+	scope, ok := pathLedgerScope(c)
+	if !ok {
+		return
+	}
+
+	if err := lc.service.DeleteLedger(c, scope); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Ledger deleted")
+}
+
+func (lc *LedgerControllerImpl) ListMembers(c *gin.Context) {
+	scope, ok := pathLedgerScope(c)
+	if !ok {
+		return
+	}
+
+	members, err := lc.service.ListMembers(c, scope)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, members)
+}
+
+// UpdateMember changes the role of a member, only owners can.
+func (lc *LedgerControllerImpl) UpdateMember(c *gin.Context) {
+	scope, ok := pathLedgerScope(c)
+	if !ok {
+		return
+	}
+	var payload models.UpdateLedgerMemberPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	if err := lc.service.UpdateMember(c, scope, c.Param("user_id"), payload); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Member updated")
+}
+
+// RemoveMember removes a member, or lets the current user leave when the
+// user_id is their own.
+func (lc *LedgerControllerImpl) RemoveMember(c *gin.Context) {
+	scope, ok := pathLedgerScope(c)
+	if !ok {
+		return
+	}
+
+	if err := lc.service.RemoveMember(c, scope, c.Param("user_id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Member removed")
+}
+
+func (lc *LedgerControllerImpl) ListInvitations(c *gin.Context) {
+	scope, ok := pathLedgerScope(c)
+	if !ok {
+		return
+	}
+
+	invitations, err := lc.service.ListInvitations(c, scope)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, invitations)
+}
+
+// CreateInvitation invites someone by email, the token is only sent to
+// them.
+func (lc *LedgerControllerImpl) CreateInvitation(c *gin.Context) {
+	scope, ok := pathLedgerScope(c)
+	if !ok {
+		return
+	}
+	var payload models.CreateInvitationPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	invitation, err := lc.service.CreateInvitation(c, scope, payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Created(c, invitation)
+}
+
+func (lc *LedgerControllerImpl) RevokeInvitation(c *gin.Context) {
+	scope, ok := pathLedgerScope(c)
+	if !ok {
+		return
+	}
+
+	if err := lc.service.RevokeInvitation(c, scope, c.Param("invitation_id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Invitation revoked")
+}
+
+func (lc *LedgerControllerImpl) AcceptInvitation(c *gin.Context) {
+	lc.respondToInvitation(c, true)
+}
+
+func (lc *LedgerControllerImpl) DeclineInvitation(c *gin.Context) {
+	lc.respondToInvitation(c, false)
+}
+
+func (lc *LedgerControllerImpl) respondToInvitation(c *gin.Context, accept bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var payload models.InvitationResponsePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	invitation, err := lc.service.RespondToInvitation(c, userID, payload.Token, accept)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, invitation)
+}
+
+// pathLedgerScope is the ledger of the :id path parameter for the current
+// user, the service checks the membership.
+func pathLedgerScope(c *gin.Context) (models.LedgerScope, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return models.LedgerScope{}, false
+	}
+	return models.LedgerScope{LedgerID: c.Param("id"), UserID: userID}, true
+}
@@ -1,7 +1,11 @@
 package controller
 
 import (
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/middlewares"
 	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
 	"github.com/aq-simei/coin-pilot/api/service"
 	responses "github.com/aq-simei/coin-pilot/internal"
 	errors "github.com/aq-simei/coin-pilot/internal/config/error"
@@ -11,11 +15,23 @@ import (
 type RecordController interface {
 	// Add fields and methods as needed for the RecordController
 	GetRecords(ctx *gin.Context)
+	GetRecord(ctx *gin.Context)
 	CreateRecord(ctx *gin.Context)
 	UpdateRecord(ctx *gin.Context)
 	DeleteRecord(ctx *gin.Context)
+	ListTrash(ctx *gin.Context)
+	RestoreRecord(ctx *gin.Context)
+	PurgeRecord(ctx *gin.Context)
+	GetRecordHistory(ctx *gin.Context)
+	Bulk(ctx *gin.Context)
+	Changes(ctx *gin.Context)
+	Upload(ctx *gin.Context)
 }
 
+// RecordSourceHeader lets clients tell where a change comes from, only
+// "import" is accepted, everything else is recorded as "api".
+const RecordSourceHeader = "X-Record-Source"
+
 type RecordControllerImpl struct {
 	service service.RecordService
 }
@@ -27,29 +43,31 @@ func NewRecordController(service service.RecordService) RecordController {
 }
 
 func RegisterRecordRoutes(router *gin.RouterGroup, controller RecordController) {
-	router.GET("/list", controller.GetRecords)
-	router.POST("/new", controller.CreateRecord)
+	write := middlewares.RequireLedgerWrite()
+	router.GET("/list", middlewares.RequireScope(models.ScopeRecordsRead), controller.GetRecords)
+	router.POST("/new", middlewares.RequireScope(models.ScopeRecordsWrite), write, controller.CreateRecord)
+	router.POST("/bulk", middlewares.RequireScope(models.ScopeRecordsWrite), write, controller.Bulk)
+	router.GET("/sync", middlewares.RequireScope(models.ScopeRecordsRead), controller.Changes)
+	router.POST("/sync", middlewares.RequireScope(models.ScopeRecordsWrite), write, controller.Upload)
+	router.GET("/:id", middlewares.RequireScope(models.ScopeRecordsRead), controller.GetRecord)
+	router.PUT("/:id", middlewares.RequireScope(models.ScopeRecordsWrite), write, controller.UpdateRecord)
+	router.DELETE("/:id", middlewares.RequireScope(models.ScopeRecordsWrite), write, controller.DeleteRecord)
+	router.GET("/:id/history", middlewares.RequireScope(models.ScopeRecordsRead), controller.GetRecordHistory)
+	router.GET("/trash", middlewares.RequireScope(models.ScopeRecordsRead), controller.ListTrash)
+	router.POST("/trash/:id/restore", middlewares.RequireScope(models.ScopeRecordsWrite), write, controller.RestoreRecord)
+	router.DELETE("/trash/:id", middlewares.RequireScope(models.ScopeRecordsWrite), write, controller.PurgeRecord)
 }
 
 func (rc *RecordControllerImpl) GetRecords(ctx *gin.Context) {
-	// Retrieve user_id from context
-	userID, exists := ctx.Get("user_id")
-	if !exists {
-		responses.Unauthorized(ctx, "User ID not found in token")
-		return
-	}
-
-	// Convert userID to string
-	userIDStr, ok := userID.(string)
-	if !ok || userIDStr == "" {
-		responses.Unauthorized(ctx, "Invalid user ID in token")
+	scope, ok := ledgerScope(ctx)
+	if !ok {
 		return
 	}
 
-	// Fetch records using the userID
-	records, err := rc.service.GetRecords(ctx, userIDStr)
+	// Fetch the records of the ledger
+	records, err := rc.service.GetRecords(ctx.Request.Context(), scope)
 	if err != nil {
-		responses.InternalServerError(ctx, "Failed to retrieve records")
+		writeAppError(ctx, err)
 		return
 	}
 
@@ -58,9 +76,8 @@ func (rc *RecordControllerImpl) GetRecords(ctx *gin.Context) {
 
 func (rc *RecordControllerImpl) CreateRecord(ctx *gin.Context) {
 	var record models.CreateRecordPayload
-	userID, exists := ctx.Get("user_id")
-	if !exists {
-		responses.Unauthorized(ctx, "Must be logged in to create a record")
+	actor, ok := recordActor(ctx)
+	if !ok {
 		return
 	}
 	if err := ctx.ShouldBindJSON(&record); err != nil {
@@ -68,45 +85,261 @@ func (rc *RecordControllerImpl) CreateRecord(ctx *gin.Context) {
 		return
 	}
 
-	createdRecord, err := rc.service.CreateRecord(ctx, record, userID.(string))
+	createdRecord, err := rc.service.CreateRecord(ctx.Request.Context(), actor, record)
 	if err != nil {
-		responses.InternalServerError(ctx, err.Error())
+		writeAppError(ctx, err)
 		return
 	}
 
+	ctx.Header("ETag", recordETag(createdRecord.Version))
 	responses.Success(ctx, createdRecord)
 }
 
+// GetRecord returns the record with its version as ETag, or 304 when the
+// client already has that version.
+func (rc *RecordControllerImpl) GetRecord(ctx *gin.Context) {
+	scope, ok := ledgerScope(ctx)
+	if !ok {
+		return
+	}
+
+	record, err := rc.service.GetRecord(ctx.Request.Context(), scope, ctx.Param("id"))
+	if err != nil {
+		writeAppError(ctx, err)
+		return
+	}
+
+	etag := recordETag(record.Version)
+	ctx.Header("ETag", etag)
+	if ifNoneMatch(ctx, etag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	responses.Success(ctx, record)
+}
+
+// UpdateRecord replaces the record. The If-Match header must carry the ETag
+// the client last read, so concurrent edits are rejected instead of lost.
 func (rc *RecordControllerImpl) UpdateRecord(ctx *gin.Context) {
 	id := ctx.Param("id")
-	var record models.Record
+	actor, ok := recordActor(ctx)
+	if !ok {
+		return
+	}
+	version, present := ifMatchVersion(ctx)
+	if !present {
+		responses.CustomError(ctx, http.StatusPreconditionRequired, "If-Match header is required")
+		return
+	}
+	var record models.UpdateRecordPayload
 	if err := ctx.ShouldBindJSON(&record); err != nil {
 		responses.BadRequest(ctx, "Invalid input")
 		return
 	}
 
-	updatedRecord, err := rc.service.UpdateRecord(ctx, id, record)
+	updatedRecord, err := rc.service.UpdateRecord(ctx.Request.Context(), actor, id, version, record)
 	if err != nil {
-		responses.InternalServerError(ctx, "Failed to update record")
+		if appErr, ok := errors.IsAppError(err); ok {
+			if conflict, ok := appErr.Err.(*repository.RecordVersionConflictError); ok {
+				// Send the current record so the client can merge without
+				// another round trip
+				ctx.Header("ETag", recordETag(conflict.Current.Version))
+				responses.JSON(ctx, http.StatusPreconditionFailed, false, conflict.Current, &responses.ErrorData{
+					Code:    http.StatusPreconditionFailed,
+					Message: appErr.Message,
+				})
+				return
+			}
+		}
+		writeAppError(ctx, err)
 		return
 	}
 
+	ctx.Header("ETag", recordETag(updatedRecord.Version))
 	responses.Success(ctx, updatedRecord)
 }
 
+// DeleteRecord moves the record to the trash.
 func (rc *RecordControllerImpl) DeleteRecord(ctx *gin.Context) {
-	id := ctx.Param("id")
+	actor, ok := recordActor(ctx)
+	if !ok {
+		return
+	}
+
+	if err := rc.service.DeleteRecord(ctx.Request.Context(), actor, ctx.Param("id")); err != nil {
+		writeAppError(ctx, err)
+		return
+	}
+
+	responses.Success(ctx, "Record moved to trash")
+}
+
+func (rc *RecordControllerImpl) ListTrash(ctx *gin.Context) {
+	scope, ok := ledgerScope(ctx)
+	if !ok {
+		return
+	}
+	var filter models.TrashFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		responses.BadRequest(ctx, "Invalid query parameters")
+		return
+	}
+
+	page, err := rc.service.ListTrash(ctx.Request.Context(), scope, filter)
+	if err != nil {
+		writeAppError(ctx, err)
+		return
+	}
+	responses.Success(ctx, page)
+}
+
+func (rc *RecordControllerImpl) RestoreRecord(ctx *gin.Context) {
+	actor, ok := recordActor(ctx)
+	if !ok {
+		return
+	}
+
+	if err := rc.service.RestoreRecord(ctx.Request.Context(), actor, ctx.Param("id")); err != nil {
+		writeAppError(ctx, err)
+		return
+	}
+	responses.Success(ctx, "Record restored")
+}
+
+// PurgeRecord permanently deletes a record, it must be in the trash first.
+func (rc *RecordControllerImpl) PurgeRecord(ctx *gin.Context) {
+	actor, ok := recordActor(ctx)
+	if !ok {
+		return
+	}
+
+	if err := rc.service.PurgeRecord(ctx.Request.Context(), actor, ctx.Param("id")); err != nil {
+		writeAppError(ctx, err)
+		return
+	}
+	responses.Success(ctx, "Record permanently deleted")
+}
+
+// GetRecordHistory lists every change made to the record, newest first.
+func (rc *RecordControllerImpl) GetRecordHistory(ctx *gin.Context) {
+	scope, ok := ledgerScope(ctx)
+	if !ok {
+		return
+	}
+	var filter models.RecordHistoryFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		responses.BadRequest(ctx, "Invalid query parameters")
+		return
+	}
+
+	page, err := rc.service.GetRecordHistory(ctx.Request.Context(), scope, ctx.Param("id"), filter)
+	if err != nil {
+		writeAppError(ctx, err)
+		return
+	}
+	responses.Success(ctx, page)
+}
 
-	if id == "" {
-		errors.NewBadRequest("Record ID is required")
+// Bulk applies many record changes in one transaction, see models.BulkRequest.
+func (rc *RecordControllerImpl) Bulk(ctx *gin.Context) {
+	actor, ok := recordActor(ctx)
+	if !ok {
+		return
+	}
+	var request models.BulkRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		responses.BadRequest(ctx, "Invalid input")
 		return
 	}
 
-	err := rc.service.DeleteRecord(ctx, id)
+	response, err := rc.service.Bulk(ctx.Request.Context(), actor, request)
 	if err != nil {
-		responses.InternalServerError(ctx, "Failed to delete record")
+		if appErr, ok := errors.IsAppError(err); ok && response != nil {
+			// Rolled back, the results tell which operation failed
+			responses.JSON(ctx, appErr.Code, false, response, &responses.ErrorData{
+				Code:    appErr.Code,
+				Message: appErr.Message,
+			})
+			return
+		}
+		writeAppError(ctx, err)
+		return
+	}
+	responses.Success(ctx, response)
+}
+
+// Changes pages through the records changed since the sync token.
+func (rc *RecordControllerImpl) Changes(ctx *gin.Context) {
+	scope, ok := ledgerScope(ctx)
+	if !ok {
+		return
+	}
+	var filter models.SyncFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		responses.BadRequest(ctx, "Invalid query parameters")
 		return
 	}
 
-	responses.Success(ctx, "Deleted") // No content
+	page, err := rc.service.Changes(ctx.Request.Context(), scope, filter)
+	if err != nil {
+		writeAppError(ctx, err)
+		return
+	}
+	responses.Success(ctx, page)
+}
+
+// Upload applies the changes a client made offline.
+func (rc *RecordControllerImpl) Upload(ctx *gin.Context) {
+	actor, ok := recordActor(ctx)
+	if !ok {
+		return
+	}
+	actor.Source = models.SourceSync
+	var request models.SyncUploadRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		responses.BadRequest(ctx, "Invalid input")
+		return
+	}
+
+	response, err := rc.service.Upload(ctx.Request.Context(), actor, request)
+	if err != nil {
+		writeAppError(ctx, err)
+		return
+	}
+	responses.Success(ctx, response)
+}
+
+// recordActor describes who is changing records of which ledger in this
+// request for the record history. Clients importing in bulk mark their
+// requests with the X-Record-Source header.
+func recordActor(ctx *gin.Context) (models.RecordActor, bool) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return models.RecordActor{}, false
+	}
+	actor := models.RecordActor{
+		UserID:   userID,
+		LedgerID: ctx.GetString("ledger_id"),
+		Type:     models.ActorUser,
+		ID:       userID,
+		Source:   models.SourceAPI,
+	}
+	if ctx.GetString("auth_method") == middlewares.AuthMethodAPIKey {
+		actor.Type = models.ActorAPIKey
+		actor.ID = ctx.GetString("api_key_id")
+	}
+	if models.ChangeSource(ctx.GetHeader(RecordSourceHeader)) == models.SourceImport {
+		actor.Source = models.SourceImport
+	}
+	return actor, true
+}
+
+// ledgerScope is the ledger resolved by LedgerMiddleware for the current
+// user.
+func ledgerScope(ctx *gin.Context) (models.LedgerScope, bool) {
+	userID, ok := currentUserID(ctx)
+	if !ok {
+		return models.LedgerScope{}, false
+	}
+	return models.LedgerScope{LedgerID: ctx.GetString("ledger_id"), UserID: userID}, true
 }
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/service"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/gin-gonic/gin"
+)
+
+// failingRecords fails every call with err, the methods not overridden are
+// not used.
+type failingRecords struct {
+	service.RecordService
+	err error
+}
+
+func (s failingRecords) GetRecords(ctx context.Context, scope models.LedgerScope) ([]models.Record, error) {
+	return nil, s.err
+}
+
+func (s failingRecords) CreateRecord(ctx context.Context, actor models.RecordActor, record models.CreateRecordPayload) (*models.Record, error) {
+	return nil, s.err
+}
+
+func TestRecordErrorsKeepTheirStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"bad request", errors.NewBadRequest("amount must be positive"), http.StatusBadRequest},
+		{"not found", errors.NewNotFound("ledger"), http.StatusNotFound},
+		{"conflict", errors.New(http.StatusConflict, "conflict"), http.StatusConflict},
+		{"not an AppError", context.DeadlineExceeded, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewRecordController(failingRecords{err: tt.err})
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set("user_id", "u1")
+				c.Set("ledger_id", "l1")
+			})
+			router.GET("/records", controller.GetRecords)
+			router.POST("/records", controller.CreateRecord)
+
+			for _, req := range []*http.Request{
+				httptest.NewRequest(http.MethodGet, "/records", nil),
+				httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(`{"name":"Rent","date":"2026-10-01T00:00:00Z","type":"expense","amount":100}`)),
+			} {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				if rec.Code != tt.want {
+					t.Errorf("%s /records = %d, want %d", req.Method, rec.Code, tt.want)
+				}
+				if tt.want == http.StatusInternalServerError && strings.Contains(rec.Body.String(), "deadline") {
+					t.Errorf("%s /records leaked the error: %s", req.Method, rec.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package controller
 
 import (
-	"net/http"
+	"math"
+	"strconv"
 
+	"github.com/aq-simei/coin-pilot/api/middlewares"
 	"github.com/aq-simei/coin-pilot/api/models"
 	"github.com/aq-simei/coin-pilot/api/service"
 	responses "github.com/aq-simei/coin-pilot/internal"
@@ -15,6 +17,10 @@ type UserController interface {
 	CreateUser(c *gin.Context)
 	UpdateUser(c *gin.Context)
 	DeleteUser(c *gin.Context)
+	GetMe(c *gin.Context)
+	UpdateMe(c *gin.Context)
+	ChangePassword(c *gin.Context)
+	DeleteMe(c *gin.Context)
 	Login(c *gin.Context)
 	Logout(c *gin.Context)
 }
@@ -23,37 +29,64 @@ type UserControllerImpl struct {
 	service service.UserService
 }
 
-func RegisterUserControllerRoutes(router *gin.RouterGroup, controller UserController) {
-	router.GET("/:id", controller.GetUser)
+// RegisterUserPublicRoutes registers the routes reachable without a token.
+func RegisterUserPublicRoutes(router *gin.RouterGroup, controller UserController) {
 	router.POST("/", controller.CreateUser)
-	router.PUT("/:id", controller.UpdateUser)
-	router.DELETE("/:id", controller.DeleteUser)
 	router.POST("/login", controller.Login)
+}
+
+// RegisterUserSelfRoutes registers the routes acting on the caller's own
+// account, the group must be guarded by JwtMiddleware.
+func RegisterUserSelfRoutes(router *gin.RouterGroup, controller UserController) {
+	router.GET("/me", controller.GetMe)
+	router.PUT("/me", controller.UpdateMe)
+	router.PUT("/me/password", controller.ChangePassword)
+	router.DELETE("/me", controller.DeleteMe)
 	router.POST("/logout", controller.Logout)
 }
 
+// RegisterUserAdminRoutes registers the routes acting on arbitrary users,
+// the group must be guarded by JwtMiddleware and AuditMiddleware.
+func RegisterUserAdminRoutes(router *gin.RouterGroup, controller UserController) {
+	router.GET("/:id", middlewares.RequirePermission(models.PermUsersRead), controller.GetUser)
+	router.PUT("/:id", middlewares.RequirePermission(models.PermUsersManage), controller.UpdateUser)
+	router.DELETE("/:id", middlewares.RequirePermission(models.PermUsersManage), controller.DeleteUser)
+}
+
 func NewUserController(service service.UserService) UserController {
 	return &UserControllerImpl{
 		service: service,
 	}
 }
 
+// currentUserID returns the user_id set by JwtMiddleware, aborting with 401
+// when it is missing.
+func currentUserID(c *gin.Context) (string, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		responses.Unauthorized(c, "User ID not found in token")
+		return "", false
+	}
+	userIDStr, ok := userID.(string)
+	if !ok || userIDStr == "" {
+		responses.Unauthorized(c, "Invalid user ID in token")
+		return "", false
+	}
+	return userIDStr, true
+}
+
 func (uc *UserControllerImpl) GetUser(c *gin.Context) {
 	id := c.Param("id")
 	user, err := uc.service.GetUser(c, id)
 	if err != nil {
-		responses.InternalServerError(c, "Failed to retrieve user")
+		writeAppError(c, err)
 		return
 	}
 	responses.Success(c, user)
 }
 
 func (uc *UserControllerImpl) CreateUser(c *gin.Context) {
-	var userPayload struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var userPayload models.CreateUserPayload
 	if err := c.ShouldBindJSON(&userPayload); err != nil {
 		responses.BadRequest(c, "Invalid input")
 		return
@@ -61,17 +94,7 @@ func (uc *UserControllerImpl) CreateUser(c *gin.Context) {
 
 	err := uc.service.CreateUser(c, userPayload)
 	if err != nil {
-		if appErr, ok := err.(*errors.AppError); ok {
-			switch appErr.Code {
-			case http.StatusConflict:
-				responses.CustomError(c, http.StatusConflict, "User already exists")
-				return
-			case http.StatusInternalServerError:
-				responses.InternalServerError(c, appErr.Message)
-				return
-			}
-		}
-		responses.InternalServerError(c, "Unexpected error occurred")
+		writeAppError(c, err)
 		return
 	}
 
@@ -87,17 +110,80 @@ func (uc *UserControllerImpl) UpdateUser(c *gin.Context) {
 	}
 	err := uc.service.UpdateUser(c, id, userPayload)
 	if err != nil {
-		responses.InternalServerError(c, "Failed to update user")
+		writeAppError(c, err)
 		return
 	}
 	responses.Success(c, "User updated successfully")
 }
 
 func (uc *UserControllerImpl) DeleteUser(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
 	id := c.Param("id")
-	err := uc.service.DeleteUser(c, id)
+	err := uc.service.DeleteUser(c, adminID, id)
 	if err != nil {
-		responses.InternalServerError(c, "Failed to delete user")
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "User deleted successfully")
+}
+
+func (uc *UserControllerImpl) GetMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	user, err := uc.service.GetUser(c, userID)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, user)
+}
+
+func (uc *UserControllerImpl) UpdateMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var profilePayload models.UpdateProfilePayload
+	if err := c.ShouldBindJSON(&profilePayload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+	if err := uc.service.UpdateProfile(c, userID, profilePayload); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "User updated successfully")
+}
+
+func (uc *UserControllerImpl) ChangePassword(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var passwordPayload models.ChangePasswordPayload
+	if err := c.ShouldBindJSON(&passwordPayload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+	if err := uc.service.ChangePassword(c, userID, passwordPayload); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Password changed successfully")
+}
+
+func (uc *UserControllerImpl) DeleteMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if err := uc.service.DeleteUser(c, userID, userID); err != nil {
+		writeAppError(c, err)
 		return
 	}
 	responses.Success(c, "User deleted successfully")
@@ -113,19 +199,14 @@ func (uc *UserControllerImpl) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := uc.service.Login(c, loginPayload.Email, loginPayload.Password)
+	token, err := uc.service.Login(c, loginPayload.Email, loginPayload.Password, c.ClientIP())
 	if err != nil {
-		if appErr, ok := err.(*errors.AppError); ok {
-			switch appErr.Code {
-			case http.StatusUnauthorized:
-				responses.Unauthorized(c, appErr.Message)
-				return
-			case http.StatusInternalServerError:
-				responses.InternalServerError(c, appErr.Message)
-				return
+		if appErr, ok := errors.IsAppError(err); ok {
+			if throttled, ok := appErr.Err.(*service.LoginThrottledError); ok {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
 			}
 		}
-		responses.InternalServerError(c, "Unexpected error occurred")
+		writeAppError(c, err)
 		return
 	}
 
@@ -133,13 +214,12 @@ func (uc *UserControllerImpl) Login(c *gin.Context) {
 }
 
 func (uc *UserControllerImpl) Logout(c *gin.Context) {
-	claims, exists := c.Get("claims")
-	if !exists {
-		responses.Unauthorized(c, "Invalid token")
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
 
-	err := uc.service.Logout(c, claims)
+	err := uc.service.Logout(c, userID)
 	if err != nil {
 		responses.InternalServerError(c, "Failed to logout")
 		return
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/service"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController interface {
+	ListWebhooks(c *gin.Context)
+	CreateWebhook(c *gin.Context)
+	GetWebhook(c *gin.Context)
+	UpdateWebhook(c *gin.Context)
+	DeleteWebhook(c *gin.Context)
+	RotateSecret(c *gin.Context)
+	ListDeliveries(c *gin.Context)
+	GetDelivery(c *gin.Context)
+	Redeliver(c *gin.Context)
+}
+
+type WebhookControllerImpl struct {
+	service service.WebhookService
+}
+
+func NewWebhookController(service service.WebhookService) WebhookController {
+	return &WebhookControllerImpl{
+		service: service,
+	}
+}
+
+// RegisterWebhookRoutes registers the webhook management routes and the
+// delivery log.
+func RegisterWebhookRoutes(router *gin.RouterGroup, controller WebhookController) {
+	router.GET("", controller.ListWebhooks)
+	router.POST("", controller.CreateWebhook)
+	router.GET("/:id", controller.GetWebhook)
+	router.PATCH("/:id", controller.UpdateWebhook)
+	router.DELETE("/:id", controller.DeleteWebhook)
+	router.POST("/:id/secret", controller.RotateSecret)
+	router.GET("/:id/deliveries", controller.ListDeliveries)
+	router.GET("/:id/deliveries/:delivery_id", controller.GetDelivery)
+	router.POST("/:id/deliveries/:delivery_id/redeliver", controller.Redeliver)
+}
+
+func (wc *WebhookControllerImpl) ListWebhooks(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	webhooks, err := wc.service.ListWebhooks(c, userID)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, webhooks)
+}
+
+// CreateWebhook registers an endpoint, the response holds the signing
+// secret.
+func (wc *WebhookControllerImpl) CreateWebhook(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var payload models.CreateWebhookPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	webhook, err := wc.service.CreateWebhook(c, userID, payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Created(c, webhook)
+}
+
+func (wc *WebhookControllerImpl) GetWebhook(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	webhook, err := wc.service.GetWebhook(c, userID, c.Param("id"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, webhook)
+}
+
+func (wc *WebhookControllerImpl) UpdateWebhook(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var payload models.UpdateWebhookPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		responses.BadRequest(c, "Invalid input")
+		return
+	}
+
+	webhook, err := wc.service.UpdateWebhook(c, userID, c.Param("id"), payload)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, webhook)
+}
+
+func (wc *WebhookControllerImpl) DeleteWebhook(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := wc.service.DeleteWebhook(c, userID, c.Param("id")); err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, "Webhook deleted")
+}
+
+// RotateSecret replaces the signing secret and returns the new one.
+func (wc *WebhookControllerImpl) RotateSecret(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	webhook, err := wc.service.RotateSecret(c, userID, c.Param("id"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, webhook)
+}
+
+// ListDeliveries returns the delivery log of a webhook, latest first.
+func (wc *WebhookControllerImpl) ListDeliveries(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	var filter models.WebhookDeliveryFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		responses.BadRequest(c, "Invalid query parameters")
+		return
+	}
+
+	deliveries, err := wc.service.ListDeliveries(c, userID, c.Param("id"), filter)
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, deliveries)
+}
+
+func (wc *WebhookControllerImpl) GetDelivery(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := wc.service.GetDelivery(c, userID, c.Param("id"), c.Param("delivery_id"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Success(c, delivery)
+}
+
+// Redeliver queues the event of a delivery again as a new delivery.
+func (wc *WebhookControllerImpl) Redeliver(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := wc.service.Redeliver(c, userID, c.Param("id"), c.Param("delivery_id"))
+	if err != nil {
+		writeAppError(c, err)
+		return
+	}
+	responses.Created(c, delivery)
+}
@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/aq-simei/coin-pilot/api/service"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/gin-gonic/gin"
+)
+
+// JwtOrApiKeyMiddleware accepts either a JWT or a personal API key. Keys are
+// read from the x-api-key header or from a Bearer token starting with cp_.
+func JwtOrApiKeyMiddleware(jwtManager *security.JWTManager, apiKeyService service.APIKeyService) gin.HandlerFunc {
+	jwtMiddleware := JwtMiddleware(jwtManager)
+	return func(c *gin.Context) {
+		rawKey := c.GetHeader("x-api-key")
+		if rawKey == "" {
+			token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if strings.HasPrefix(token, security.APIKeyPrefix) {
+				rawKey = token
+			}
+		}
+		if rawKey == "" {
+			jwtMiddleware(c)
+			return
+		}
+
+		key, err := apiKeyService.Authenticate(c, rawKey)
+		if err != nil {
+			logger.InfoCtx(c, "API key rejected: %v", err)
+			responses.Unauthorized(c, "Invalid API key")
+			return
+		}
+
+		c.Set("user_id", key.UserID)
+		c.Set("auth_method", AuthMethodAPIKey)
+		c.Set("api_key_id", key.ID)
+		c.Set("api_key_scopes", []string(key.Scopes))
+		c.Next()
+	}
+}
+
+// RequireScope checks the scopes of API key requests. JWT sessions act with
+// the full rights of the user and are let through.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") != AuthMethodAPIKey {
+			c.Next()
+			return
+		}
+		if !slices.Contains(c.GetStringSlice("api_key_scopes"), scope) {
+			logger.InfoCtx(c, "API key %s lacks scope %s", c.GetString("api_key_id"), scope)
+			responses.Forbidden(c, "API key lacks scope "+scope)
+			return
+		}
+		c.Next()
+	}
+}
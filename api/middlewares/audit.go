@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"context"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditMiddleware writes an audit log entry for every request handled by the
+// group, after the handler ran. Handlers may add context through the
+// "audit_details" key.
+func AuditMiddleware(auditRepository repository.AuditRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		entry := &models.AuditLog{
+			ActorID:    c.GetString("user_id"),
+			ActorRole:  models.UserRole(c.GetString("role")),
+			Action:     c.Request.Method + " " + c.FullPath(),
+			TargetID:   c.Param("id"),
+			Details:    c.GetString("audit_details"),
+			StatusCode: c.Writer.Status(),
+			IP:         c.ClientIP(),
+		}
+		// The request context may already be cancelled, the entry must still be written
+		if err := auditRepository.CreateAuditLog(context.WithoutCancel(c.Request.Context()), entry); err != nil {
+			logger.ErrorCtx(c, "failed to write audit log for %s: %v", entry.Action, err)
+		}
+	}
+}
@@ -1,61 +1,99 @@
 package middlewares
 
 import (
-	"net/http"
 	"strings"
 
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
 	responses "github.com/aq-simei/coin-pilot/internal"
-	"github.com/aq-simei/coin-pilot/internal/config/environment"
 	"github.com/aq-simei/coin-pilot/internal/config/logger"
 	"github.com/aq-simei/coin-pilot/internal/config/security"
 	"github.com/gin-gonic/gin"
 )
 
-func ApiKeyMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		apiKey := c.GetHeader("x-api-key")
-		logger.Info("Passing by ApiKeyMiddleware: %v", apiKey)
-		if apiKey == "" || apiKey != environment.GetEnv("API_SECRET") {
-			logger.Info("API key missing or invalid")
-			c.AbortWithStatus(http.StatusForbidden)
-			return
-		}
-		c.Next()
-	}
-}
+const (
+	// AuthMethodJWT marks requests authenticated with a session token
+	AuthMethodJWT = "jwt"
+	// AuthMethodAPIKey marks requests authenticated with a personal API key
+	AuthMethodAPIKey = "api_key"
+)
 
-func JwtMiddleware() gin.HandlerFunc {
+func JwtMiddleware(jwtManager *security.JWTManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
-		logger.Info("Authorization header: %v", authHeader)
 		if authHeader == "" {
-			logger.Info("Authorization header missing")
+			logger.InfoCtx(c, "Authorization header missing")
 			responses.Unauthorized(c, "Authorization header missing")
 			return
 		}
 
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			logger.Info("Authorization header does not satisfy Bearer format")
+			logger.InfoCtx(c, "Authorization header does not satisfy Bearer format")
 			responses.Unauthorized(c, "Invalid authorization format")
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == "" {
-			logger.Info("Token string is empty")
+			logger.InfoCtx(c, "Token string is empty")
 			responses.Unauthorized(c, "Token is missing")
 			return
 		}
 
-		userID, err := security.ParseJWT(tokenString)
+		claims, err := jwtManager.ParseJWT(tokenString)
 		if err != nil {
-			logger.Info("Failed to parse JWT: %v", err)
+			logger.InfoCtx(c, "Failed to parse JWT: %v", err)
 			responses.Unauthorized(c, err.Error())
 			return
 		}
 
-		// Store user_id in context for future use
-		c.Set("user_id", userID)
+		// The role claim may be stale, RequireActiveUser sets the current role
+		c.Set("user_id", claims.UserID)
+		c.Set("auth_method", AuthMethodJWT)
+		c.Next()
+	}
+}
+
+// RequireActiveUser rejects tokens belonging to deleted or suspended users,
+// so suspensions apply before the token expires, and sets the role of the
+// user as stored, so role changes apply right away too. It must run after
+// JwtMiddleware.
+func RequireActiveUser(userRepository repository.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			responses.Unauthorized(c, "User ID not found in token")
+			return
+		}
+
+		user, err := userRepository.GetUser(c, userID)
+		if err != nil {
+			logger.InfoCtx(c, "Failed to load user %s for status check: %v", userID, err)
+			responses.Unauthorized(c, "User not found")
+			return
+		}
+
+		if user.Status == models.StatusSuspended {
+			logger.InfoCtx(c, "Suspended user %s denied access", userID)
+			responses.Forbidden(c, "Account is suspended")
+			return
+		}
+		c.Set("role", string(user.Role))
+		c.Next()
+	}
+}
+
+// RequirePermission only lets through callers whose role grants the
+// permission. It must run after RequireActiveUser, without it no role is set
+// and every permission is denied.
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := models.UserRole(c.GetString("role"))
+		if !role.Can(permission) {
+			logger.InfoCtx(c, "User %s with role %q denied %s", c.GetString("user_id"), role, permission)
+			responses.Forbidden(c, "Insufficient permissions")
+			return
+		}
 		c.Next()
 	}
 }
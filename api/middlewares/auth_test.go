@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/gin-gonic/gin"
+)
+
+// stubUsers serves a single user, the methods not overridden are not used.
+type stubUsers struct {
+	repository.UserRepository
+	user models.User
+}
+
+func (s stubUsers) GetUser(ctx context.Context, id string) (*models.User, error) {
+	user := s.user
+	return &user, nil
+}
+
+func TestRequirePermissionUsesStoredRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtManager := security.NewJWTManager("0123456789abcdef0123456789abcdef", time.Hour)
+
+	tests := []struct {
+		name        string
+		tokenRole   models.UserRole
+		storedRole  models.UserRole
+		checkActive bool
+		want        int
+	}{
+		{"admin", models.RoleAdmin, models.RoleAdmin, true, http.StatusOK},
+		{"admin demoted since the token was issued", models.RoleAdmin, models.RoleUser, true, http.StatusForbidden},
+		{"user promoted since the token was issued", models.RoleUser, models.RoleAdmin, true, http.StatusOK},
+		{"role claim alone", models.RoleAdmin, models.RoleAdmin, false, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers := []gin.HandlerFunc{JwtMiddleware(jwtManager)}
+			if tt.checkActive {
+				handlers = append(handlers, RequireActiveUser(stubUsers{user: models.User{ID: "u1", Role: tt.storedRole, Status: models.StatusActive}}))
+			}
+			handlers = append(handlers, RequirePermission(models.PermUsersManage), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			router := gin.New()
+			router.GET("/admin", handlers...)
+
+			token, err := jwtManager.GenerateJWT("u1", string(tt.tokenRole))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
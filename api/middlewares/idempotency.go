@@ -0,0 +1,192 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses answered from the store
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// replayedHeaders are the response headers stored along with the body.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// responseRecorder keeps a copy of the body written by the handler.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// IdempotencyMiddleware makes mutating requests sent with an Idempotency-Key
+// header safe to retry. The first response is stored per user and key for
+// ttl and replayed to every retry, a retry with another method, path or body
+// gets 422 and one arriving while the first is still running gets 409.
+// Server errors are not stored so the request can be retried. Place it after
+// the auth middleware.
+func IdempotencyMiddleware(store repository.IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		userID := c.GetString("user_id")
+		if key == "" || userID == "" || !isMutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			responses.BadRequest(c, "Idempotency-Key must be at most 255 characters")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			responses.BadRequest(c, "Could not read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := requestHash(c.Request.Method, c.Request.URL.RequestURI(), c.GetHeader(LedgerHeader), body)
+		now := time.Now()
+		entry, claimed, err := store.Claim(c, models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: hash,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		})
+		if err != nil {
+			abortWithAppError(c, err)
+			return
+		}
+		if !claimed {
+			replay(c, entry, hash)
+			return
+		}
+
+		// The client may be gone, the outcome must still be saved
+		ctx := context.WithoutCancel(c.Request.Context())
+		release := func() {
+			if err := store.Release(ctx, userID, key); err != nil {
+				logger.ErrorCtx(ctx, "idempotency key %s stays claimed until it expires: %v", key, err)
+			}
+		}
+		completed := false
+		defer func() {
+			// A panicking handler must not leave the key claimed
+			if !completed {
+				release()
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		completed = true
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			release()
+			return
+		}
+		entry.StatusCode = status
+		entry.ResponseHeaders = storedHeaders(recorder.Header())
+		entry.ResponseBody = recorder.body.Bytes()
+		completedAt := time.Now()
+		entry.CompletedAt = &completedAt
+		if err := store.Complete(ctx, *entry); err != nil {
+			logger.ErrorCtx(ctx, "response for idempotency key %s was not stored: %v", key, err)
+		}
+	}
+}
+
+func replay(c *gin.Context, entry *models.IdempotencyKey, hash string) {
+	switch {
+	case entry.RequestHash != hash:
+		responses.CustomError(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+	case entry.CompletedAt == nil:
+		c.Header("Retry-After", "1")
+		responses.CustomError(c, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+	default:
+		var headers map[string]string
+		if len(entry.ResponseHeaders) > 0 {
+			if err := json.Unmarshal(entry.ResponseHeaders, &headers); err != nil {
+				logger.WarnCtx(c, "unreadable headers stored for idempotency key %s: %v", entry.Key, err)
+			}
+		}
+		for name, value := range headers {
+			c.Header(name, value)
+		}
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Status(entry.StatusCode)
+		if _, err := c.Writer.Write(entry.ResponseBody); err != nil {
+			logger.WarnCtx(c, "failed to replay response for idempotency key %s: %v", entry.Key, err)
+		}
+	}
+	c.Abort()
+}
+
+// requestHash identifies a request so a reused key can be told apart from a
+// retry. The ledger header is part of it, the same body changes another
+// ledger.
+func requestHash(method, uri, ledgerID string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + uri + "\n" + ledgerID + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func storedHeaders(header http.Header) models.JSONDocument {
+	headers := map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	content, _ := json.Marshal(headers)
+	return content
+}
+
+func abortWithAppError(c *gin.Context, err error) {
+	if appErr, ok := errors.IsAppError(err); ok {
+		responses.CustomError(c, appErr.Code, appErr.Message)
+	} else {
+		responses.InternalServerError(c, "")
+	}
+	c.Abort()
+}
@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// LedgerHeader picks the ledger a records request works on, the personal
+// ledger of the user is used without it.
+const LedgerHeader = "X-Ledger-ID"
+
+// LedgerMiddleware resolves the ledger of the request and the role the user
+// has in it, stored as ledger_id and ledger_role. Ledgers the user is not a
+// member of are reported as not found. It must run after the auth middleware.
+func LedgerMiddleware(ledgers repository.LedgerRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		ledgerID := c.GetHeader(LedgerHeader)
+		if ledgerID == "" {
+			ledger, err := ledgers.PersonalLedger(c, userID)
+			if err != nil {
+				responses.InternalServerError(c, "Failed to load ledger")
+				return
+			}
+			c.Set("ledger_id", ledger.ID)
+			c.Set("ledger_role", string(models.LedgerOwner))
+			c.Next()
+			return
+		}
+
+		member, err := ledgers.GetMembership(c, ledgerID, userID)
+		if err != nil {
+			if appErr, ok := errors.IsAppError(err); ok && appErr.Code == http.StatusNotFound {
+				logger.InfoCtx(c, "User %s is not a member of ledger %s", userID, ledgerID)
+				responses.NotFound(c, "Ledger not found")
+				return
+			}
+			responses.InternalServerError(c, "Failed to load ledger")
+			return
+		}
+		c.Set("ledger_id", member.LedgerID)
+		c.Set("ledger_role", string(member.Role))
+		c.Next()
+	}
+}
+
+// RequireLedgerWrite rejects changes from viewers of the ledger. It must run
+// after LedgerMiddleware.
+func RequireLedgerWrite() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.LedgerRole(c.GetString("ledger_role")).CanWrite() {
+			logger.InfoCtx(c, "User %s cannot write to ledger %s", c.GetString("user_id"), c.GetString("ledger_id"))
+			responses.Forbidden(c, "Ledger is read-only for viewers")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware records the count and latency of every request. Requests
+// are labelled by route template, not raw path, to keep cardinality bounded.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		metrics.HTTPRequestsInFlight.Inc()
+		defer metrics.HTTPRequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	responses "github.com/aq-simei/coin-pilot/internal"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitKey identifies the caller: the API key when one was used, then the
+// authenticated user, then the client IP.
+func rateLimitKey(c *gin.Context) string {
+	if keyID := c.GetString("api_key_id"); keyID != "" {
+		return "key:" + keyID
+	}
+	if userID := c.GetString("user_id"); userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// RateLimitMiddleware applies a token bucket per caller to the routes of a
+// group. Buckets are namespaced by name so groups do not share quotas. Place
+// it after the auth middleware to key by user or API key rather than by IP.
+func RateLimitMiddleware(store repository.RateLimitStore, name string, limit models.RateLimit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := name + ":" + rateLimitKey(c)
+		result, err := store.Take(c, key, limit, time.Now())
+		if err != nil {
+			// Fail open, an unavailable store must not take the API down
+			logger.ErrorCtx(c, "rate limiter unavailable for %s: %v", key, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(result.Reset))
+		c.Header("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+ceilSeconds(limit.Period))
+
+		if !result.Allowed {
+			logger.InfoCtx(c, "rate limit exceeded for %s", key)
+			c.Header("Retry-After", ceilSeconds(result.RetryAfter))
+			responses.TooManyRequests(c, "Rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
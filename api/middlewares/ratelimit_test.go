@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitMiddlewareHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", RateLimitMiddleware(repository.NewMemoryRateLimitStore(), "test", models.RateLimit{Requests: 2, Period: time.Minute}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		status     int
+		remaining  string
+		retryAfter string
+	}{
+		{http.StatusOK, "1", ""},
+		{http.StatusOK, "0", ""},
+		{http.StatusTooManyRequests, "0", "30"},
+	}
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != tt.status {
+			t.Fatalf("request %d: status %d, want %d", i, rec.Code, tt.status)
+		}
+		header := rec.Header()
+		if header.Get("RateLimit-Limit") != "2" || header.Get("RateLimit-Policy") != "2;w=60" {
+			t.Fatalf("request %d: limit headers %v", i, header)
+		}
+		if header.Get("RateLimit-Remaining") != tt.remaining || header.Get("Retry-After") != tt.retryAfter {
+			t.Fatalf("request %d: remaining %q retry after %q, want %q and %q", i, header.Get("RateLimit-Remaining"), header.Get("Retry-After"), tt.remaining, tt.retryAfter)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID bounds what is accepted from clients, since the value is
+// echoed back and written to logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return hex.EncodeToString([]byte(time.Now().String()))[:32]
+	}
+	return hex.EncodeToString(buf)
+}
+
+// RequestIDMiddleware reuses the caller's X-Request-ID or generates one, puts
+// it in the request context for logging and returns it in the response.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set("request_id", requestID)
+		c.Request = c.Request.WithContext(logger.ContextWithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// AccessLogMiddleware writes one structured record per request.
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		lvl := slog.LevelInfo
+		switch {
+		case status >= 500:
+			lvl = slog.LevelError
+		case status >= 400:
+			lvl = slog.LevelWarn
+		case probePaths[c.Request.URL.Path]:
+			lvl = slog.LevelDebug
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if userID := c.GetString("user_id"); userID != "" {
+			attrs = append(attrs, slog.String("user_id", userID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		logger.L().LogAttrs(c.Request.Context(), lvl, "request", attrs...)
+	}
+}
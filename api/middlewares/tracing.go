@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// probePaths are polled by infrastructure and would only add noise to traces
+// and access logs.
+var probePaths = map[string]bool{
+	"/health":  true,
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// TracingMiddleware starts a server span per request, continuing the trace of
+// an incoming traceparent header, and stores it in the request context.
+func TracingMiddleware(serviceName string) gin.HandlerFunc {
+	return otelgin.Middleware(serviceName,
+		otelgin.WithFilter(func(r *http.Request) bool {
+			return !probePaths[r.URL.Path]
+		}),
+	)
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// ScopeRecordsRead allows listing records
+	ScopeRecordsRead = "records:read"
+	// ScopeRecordsWrite allows creating, updating and deleting records
+	ScopeRecordsWrite = "records:write"
+	// ScopeReportsRead allows reading reports
+	ScopeReportsRead = "reports:read"
+)
+
+var knownScopes = []string{ScopeRecordsRead, ScopeRecordsWrite, ScopeReportsRead}
+
+// IsValidScope reports whether scope is one an API key may be granted.
+func IsValidScope(scope string) bool {
+	return slices.Contains(knownScopes, scope)
+}
+
+// APIKey is a personal credential for scripts. Only a hash of the secret is
+// stored, the prefix is kept in clear so keys can be told apart and looked up.
+type APIKey struct {
+	ID         string         `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID     string         `gorm:"not null;index" json:"user_id"`
+	Name       string         `gorm:"not null" json:"name"`
+	Prefix     string         `gorm:"not null;uniqueIndex" json:"prefix"`
+	KeyHash    string         `gorm:"not null" json:"-"`
+	Scopes     pq.StringArray `gorm:"type:text[];not null" json:"scopes"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time     `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time      `gorm:"not null;default:current_timestamp" json:"created_at"`
+	User       User           `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+type CreateAPIKeyPayload struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKeyResponse is returned once on creation, it is the only time the
+// full key is visible.
+type CreatedAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
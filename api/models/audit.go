@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// AuditLog is an append-only entry describing an action taken through an
+// admin-only route.
+type AuditLog struct {
+	ID         string    `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	ActorID    string    `gorm:"not null;index" json:"actor_id"`
+	ActorRole  UserRole  `gorm:"not null" json:"actor_role"`
+	Action     string    `gorm:"not null;index" json:"action"`
+	TargetID   string    `gorm:"index" json:"target_id,omitempty"`
+	Details    string    `gorm:"type:text;default:''" json:"details,omitempty"`
+	StatusCode int       `gorm:"not null" json:"status_code"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `gorm:"not null;default:current_timestamp;index" json:"created_at"`
+}
+
+type AuditLogFilter struct {
+	ActorID  string `form:"actor_id"`
+	TargetID string `form:"target_id"`
+	Action   string `form:"action"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+}
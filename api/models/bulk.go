@@ -0,0 +1,116 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type BulkMode string
+
+const (
+	// BulkAtomic applies every operation or none of them
+	BulkAtomic BulkMode = "atomic"
+	// BulkBestEffort applies what it can and reports each failure
+	BulkBestEffort BulkMode = "best_effort"
+)
+
+type BulkOperationType string
+
+const (
+	BulkCreate BulkOperationType = "create"
+	BulkUpdate BulkOperationType = "update"
+	BulkDelete BulkOperationType = "delete"
+)
+
+// MaxBulkItems caps the operations of a request, and the records a filter
+// may match, to keep the transaction short.
+const MaxBulkItems = 500
+
+// BulkOperation is one item of a bulk request. Record is required to create
+// and update, Version to update; it must match the current version like the
+// If-Match header of a single update.
+type BulkOperation struct {
+	Op      BulkOperationType    `json:"op" binding:"required,oneof=create update delete"`
+	ID      string               `json:"id"`
+	Version int64                `json:"version"`
+	Record  *CreateRecordPayload `json:"record"`
+}
+
+// BulkFilter selects the records a patch applies to, every field set must
+// match.
+type BulkFilter struct {
+	IDs  []string   `json:"ids"`
+	Tag  string     `json:"tag"`
+	Type RecordType `json:"type"`
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
+	// Search matches the record name, case insensitive
+	Search string `json:"search"`
+}
+
+func (f BulkFilter) IsEmpty() bool {
+	return len(f.IDs) == 0 && f.Tag == "" && f.Type == "" && f.From == nil && f.To == nil && f.Search == ""
+}
+
+// RecordPatch is applied to every record matching a BulkFilter.
+type RecordPatch struct {
+	AddTags    []string    `json:"add_tags"`
+	RemoveTags []string    `json:"remove_tags"`
+	Type       *RecordType `json:"type"`
+}
+
+func (p RecordPatch) IsEmpty() bool {
+	return len(p.AddTags) == 0 && len(p.RemoveTags) == 0 && p.Type == nil
+}
+
+// Apply changes record in place and reports whether anything changed.
+func (p RecordPatch) Apply(record *Record) bool {
+	tags := make(pq.StringArray, 0, len(record.Tags)+len(p.AddTags))
+	for _, tag := range record.Tags {
+		if !slices.Contains(p.RemoveTags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	for _, tag := range p.AddTags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	changed := !slices.Equal(tags, record.Tags)
+	record.Tags = tags
+	if p.Type != nil && *p.Type != record.Type {
+		record.Type = *p.Type
+		changed = true
+	}
+	return changed
+}
+
+// BulkRequest holds either a list of operations, or a filter and the patch
+// to apply to the records it matches.
+type BulkRequest struct {
+	Mode       BulkMode        `json:"mode"`
+	Operations []BulkOperation `json:"operations" binding:"dive"`
+	Filter     *BulkFilter     `json:"filter"`
+	Patch      *RecordPatch    `json:"patch"`
+}
+
+// BulkResult reports the outcome of one operation, Index is its position in
+// the request. Status is the HTTP status the single call would have had,
+// 424 when an atomic request was rolled back because of another operation.
+type BulkResult struct {
+	Index  int               `json:"index"`
+	Op     BulkOperationType `json:"op"`
+	ID     string            `json:"id,omitempty"`
+	Status int               `json:"status"`
+	Record *Record           `json:"record,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Mode      BulkMode     `json:"mode"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
@@ -0,0 +1,146 @@
+package models
+
+import "time"
+
+type SplitType string
+
+const (
+	// SplitEqual divides the amount evenly between the listed members
+	SplitEqual SplitType = "equal"
+	// SplitExact gives each member an amount in cents, they must add up
+	SplitExact SplitType = "exact"
+	// SplitPercentage gives each member a percentage in basis points, 10000
+	// being 100%
+	SplitPercentage SplitType = "percentage"
+	// SplitShares divides the amount in proportion to whole shares
+	SplitShares SplitType = "shares"
+)
+
+// Group is a set of people sharing expenses, e.g. friends on a trip.
+type Group struct {
+	ID        string        `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	Name      string        `gorm:"not null" json:"name"`
+	CreatedBy string        `gorm:"not null" json:"created_by"`
+	Members   []GroupMember `gorm:"foreignKey:GroupID" json:"members,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// GroupMember is a registered user or, without UserID, a placeholder for
+// someone who has no account.
+type GroupMember struct {
+	ID        string    `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	GroupID   string    `gorm:"not null;index" json:"group_id"`
+	UserID    *string   `json:"user_id,omitempty"`
+	Name      string    `gorm:"not null" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroupExpense is paid by one member and split between several. Amounts
+// are in cents.
+type GroupExpense struct {
+	ID          string              `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	GroupID     string              `gorm:"not null;index" json:"group_id"`
+	Description string              `gorm:"not null" json:"description"`
+	Amount      int64               `gorm:"not null" json:"amount"`
+	Date        time.Time           `gorm:"not null" json:"date"`
+	PaidBy      string              `gorm:"not null" json:"paid_by"` // Group member ID
+	SplitType   SplitType           `gorm:"not null" json:"split_type"`
+	RecordID    *string             `json:"record_id,omitempty"` // Record the expense comes from, if any
+	CreatedBy   string              `gorm:"not null" json:"created_by"`
+	Shares      []GroupExpenseShare `gorm:"foreignKey:ExpenseID" json:"shares"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+// GroupExpenseShare is what a member owes for an expense. Value is the
+// split input, see SplitType.
+type GroupExpenseShare struct {
+	ExpenseID string `gorm:"primaryKey" json:"-"`
+	MemberID  string `gorm:"primaryKey" json:"member_id"`
+	Value     int64  `gorm:"not null" json:"value"`
+	Amount    int64  `gorm:"not null" json:"amount"`
+}
+
+// GroupSettlement is a payment from one member to another that settles
+// debts.
+type GroupSettlement struct {
+	ID        string    `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	GroupID   string    `gorm:"not null;index" json:"group_id"`
+	FromID    string    `gorm:"not null" json:"from_id"`
+	ToID      string    `gorm:"not null" json:"to_id"`
+	Amount    int64     `gorm:"not null" json:"amount"`
+	Date      time.Time `gorm:"not null" json:"date"`
+	Note      string    `json:"note"`
+	CreatedBy string    `gorm:"not null" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateGroupPayload struct {
+	Name string `json:"name" binding:"required,max=100"`
+	// Placeholder members to add besides the creator
+	Members []string `json:"members" binding:"max=50,dive,required,max=100"`
+}
+
+type UpdateGroupPayload struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// AddGroupMemberPayload adds a registered user by email, or a placeholder
+// by name.
+type AddGroupMemberPayload struct {
+	Email string `json:"email" binding:"omitempty,email"`
+	Name  string `json:"name" binding:"max=100"`
+}
+
+type SplitInput struct {
+	MemberID string `json:"member_id" binding:"required"`
+	Value    int64  `json:"value"`
+}
+
+// CreateGroupExpensePayload splits an expense. With equal splits the values
+// are ignored and no splits means every member. With a record_id the
+// description, amount and date default to the record's.
+type CreateGroupExpensePayload struct {
+	Description string       `json:"description" binding:"max=200"`
+	Amount      int64        `json:"amount" binding:"gte=0"`
+	Date        *time.Time   `json:"date"`
+	PaidBy      string       `json:"paid_by" binding:"required"`
+	SplitType   SplitType    `json:"split_type" binding:"required,oneof=equal exact percentage shares"`
+	Splits      []SplitInput `json:"splits" binding:"max=100,dive"`
+	RecordID    string       `json:"record_id"`
+}
+
+type CreateSettlementPayload struct {
+	FromID string     `json:"from_id" binding:"required"`
+	ToID   string     `json:"to_id" binding:"required"`
+	Amount int64      `json:"amount" binding:"required,gt=0"`
+	Date   *time.Time `json:"date"`
+	Note   string     `json:"note" binding:"max=200"`
+}
+
+type GroupExpenseFilter struct {
+	Page     int `form:"page"`
+	PageSize int `form:"page_size"`
+}
+
+// MemberBalance is positive when the member is owed money, negative when
+// they owe.
+type MemberBalance struct {
+	MemberID string `json:"member_id"`
+	Name     string `json:"name"`
+	Balance  int64  `json:"balance"`
+}
+
+// Debt is a payment that settles the group, From pays To.
+type Debt struct {
+	FromID string `json:"from_id"`
+	ToID   string `json:"to_id"`
+	Amount int64  `json:"amount"`
+}
+
+// GroupBalances is the net balance of each member and the fewest payments
+// that settle them.
+type GroupBalances struct {
+	Balances []MemberBalance `json:"balances"`
+	Debts    []Debt          `json:"debts"`
+}
@@ -0,0 +1,18 @@
+package models
+
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// HealthCheck is the outcome of one readiness dependency.
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthReport is returned by /readyz, Status is ok only when every check is.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
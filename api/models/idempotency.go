@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// IdempotencyKey stores the first response to a mutating request sent with
+// an Idempotency-Key header, so retries of it are answered from here instead
+// of running again. CompletedAt is nil while the first request is running.
+type IdempotencyKey struct {
+	UserID          string       `gorm:"primaryKey"`
+	Key             string       `gorm:"primaryKey"`
+	RequestHash     string       `gorm:"not null"`
+	StatusCode      int          `gorm:"not null;default:0"`
+	ResponseHeaders JSONDocument `gorm:"type:jsonb"`
+	ResponseBody    []byte
+	CreatedAt       time.Time `gorm:"not null"`
+	CompletedAt     *time.Time
+	ExpiresAt       time.Time `gorm:"not null;index"`
+}
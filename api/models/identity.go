@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// UserIdentity links an external OIDC account (provider + subject) to a User.
+type UserIdentity struct {
+	ID        string    `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    string    `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject   string    `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"subject"`
+	Email     string    `gorm:"not null" json:"email"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;default:current_timestamp" json:"updated_at"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// PendingLogin is an OIDC login waiting for the provider to redirect back.
+// It is kept in the database so the callback can reach any instance, and is
+// deleted by the callback or once it expires. UserID is set when a logged
+// in user links the provider to their account instead of logging in.
+type PendingLogin struct {
+	State        string `gorm:"primaryKey"`
+	Provider     string `gorm:"not null"`
+	UserID       *string
+	CodeVerifier string    `gorm:"not null"`
+	Nonce        string    `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Kinds of background jobs.
+const (
+	JobInvitationEmail        = "email.ledger_invitation"
+	JobLockoutEmail           = "email.account_locked"
+	JobWebhookDelivery        = "webhook.delivery"
+	JobPurgeTrash             = "purge.trash"
+	JobPurgeIdempotencyKeys   = "purge.idempotency_keys"
+	JobPurgeWebhookDeliveries = "purge.webhook_deliveries"
+	JobPurgeJobs              = "purge.jobs"
+	JobPurgePendingLogins     = "purge.pending_logins"
+	JobPurgeRateLimitBuckets  = "purge.rate_limit_buckets"
+)
+
+type JobStatus string
+
+const (
+	// JobPending is waiting for its run time, its first attempt or a retry
+	JobPending JobStatus = "pending"
+	// JobRunning is claimed by a runner until its lock expires
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	// JobDead ran out of attempts or failed permanently, it stays until an
+	// admin retries it
+	JobDead JobStatus = "dead"
+)
+
+func (s JobStatus) IsValid() bool {
+	switch s {
+	case JobPending, JobRunning, JobSucceeded, JobDead:
+		return true
+	}
+	return false
+}
+
+// Job is a unit of background work run by the job runner. Jobs with the same
+// unique key are only queued once, scheduled jobs use it so every instance
+// can schedule them.
+type Job struct {
+	ID          string       `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	Kind        string       `gorm:"not null" json:"kind"`
+	Payload     JSONDocument `gorm:"type:jsonb;not null" json:"payload"`
+	Status      JobStatus    `gorm:"not null;default:pending" json:"status"`
+	Attempts    int          `gorm:"not null;default:0" json:"attempts"`
+	RunAt       time.Time    `gorm:"not null" json:"run_at"`
+	LockedUntil *time.Time   `json:"locked_until,omitempty"`
+	LastError   string       `gorm:"not null;default:''" json:"last_error,omitempty"`
+	UniqueKey   *string      `json:"unique_key,omitempty"`
+	FinishedAt  *time.Time   `json:"finished_at,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// NewJob returns a job of the given kind with payload encoded as JSON, due
+// right away.
+func NewJob(kind string, payload any) (*Job, error) {
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{Kind: kind, Payload: content, Status: JobPending, RunAt: time.Now()}, nil
+}
+
+// InvitationEmailJob sends the email of a ledger invitation. The token is
+// issued when the email is sent so it is never stored in clear.
+type InvitationEmailJob struct {
+	InvitationID string `json:"invitation_id"`
+}
+
+// LockoutEmailJob tells the owner of an account it was locked.
+type LockoutEmailJob struct {
+	Email string    `json:"email"`
+	Until time.Time `json:"until"`
+}
+
+// WebhookDeliveryJob sends a webhook delivery, the delivery keeps the
+// outcome of every attempt for the delivery log.
+type WebhookDeliveryJob struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+type JobFilter struct {
+	Status   JobStatus `form:"status"`
+	Kind     string    `form:"kind"`
+	Page     int       `form:"page"`
+	PageSize int       `form:"page_size"`
+}
@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+type LedgerRole string
+
+const (
+	// LedgerOwner manages the ledger, its members and invitations
+	LedgerOwner LedgerRole = "owner"
+	// LedgerEditor can change the records of the ledger
+	LedgerEditor LedgerRole = "editor"
+	// LedgerViewer can only read the records of the ledger
+	LedgerViewer LedgerRole = "viewer"
+)
+
+// IsValid reports whether r is a known ledger role.
+func (r LedgerRole) IsValid() bool {
+	return r == LedgerOwner || r == LedgerEditor || r == LedgerViewer
+}
+
+// CanWrite reports whether the role may change records.
+func (r LedgerRole) CanWrite() bool {
+	return r == LedgerOwner || r == LedgerEditor
+}
+
+// Ledger owns records and is shared between its members. Every user has a
+// personal ledger, used when a request does not pick one.
+type Ledger struct {
+	ID             string     `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	Name           string     `gorm:"not null" json:"name"`
+	PersonalUserID *string    `gorm:"uniqueIndex" json:"personal_user_id,omitempty"`
+	Role           LedgerRole `gorm:"->;-:migration" json:"role,omitempty"` // Role of the current user, read from ledger_members
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type LedgerMember struct {
+	LedgerID  string     `gorm:"primaryKey" json:"ledger_id"`
+	UserID    string     `gorm:"primaryKey;index" json:"user_id"`
+	Role      LedgerRole `gorm:"not null" json:"role"`
+	Name      string     `gorm:"->;-:migration" json:"name,omitempty"`
+	Email     string     `gorm:"->;-:migration" json:"email,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationDeclined InvitationStatus = "declined"
+	InvitationRevoked  InvitationStatus = "revoked"
+)
+
+// LedgerInvitation asks someone to join a ledger. The token is emailed to
+// the invitee, only its hash is stored.
+type LedgerInvitation struct {
+	ID          string           `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	LedgerID    string           `gorm:"not null;index" json:"ledger_id"`
+	Email       string           `gorm:"not null;index" json:"email"`
+	Role        LedgerRole       `gorm:"not null" json:"role"`
+	InvitedBy   string           `gorm:"not null" json:"invited_by"`
+	TokenHash   string           `gorm:"not null;uniqueIndex" json:"-"`
+	Status      InvitationStatus `gorm:"not null;default:'pending'" json:"status"`
+	ExpiresAt   time.Time        `gorm:"not null" json:"expires_at"`
+	CreatedAt   time.Time        `json:"created_at"`
+	RespondedAt *time.Time       `json:"responded_at,omitempty"`
+}
+
+// LedgerScope limits record queries to a ledger the user is a member of.
+type LedgerScope struct {
+	LedgerID string
+	UserID   string
+}
+
+type CreateLedgerPayload struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type UpdateLedgerPayload struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type UpdateLedgerMemberPayload struct {
+	Role LedgerRole `json:"role" binding:"required"`
+}
+
+type CreateInvitationPayload struct {
+	Email string     `json:"email" binding:"required,email"`
+	Role  LedgerRole `json:"role" binding:"required"`
+}
+
+type InvitationResponsePayload struct {
+	Token string `json:"token" binding:"required"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempt tracks consecutive failed logins for a key, which is either an
+// email ("email:<address>") or a client IP ("ip:<address>").
+type LoginAttempt struct {
+	Key           string     `gorm:"primaryKey" json:"key"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"not null" json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
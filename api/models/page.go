@@ -0,0 +1,28 @@
+package models
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Page is a single page of a paginated listing.
+type Page[T any] struct {
+	Items    []T   `json:"items"`
+	Total    int64 `json:"total"`
+	Page     int   `json:"page"`
+	PageSize int   `json:"page_size"`
+}
+
+// NormalizePage clamps 1-based page parameters to sane values.
+func NormalizePage(page, pageSize int) (int, int) {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+	if page <= 0 {
+		page = 1
+	}
+	return page, pageSize
+}
@@ -0,0 +1,35 @@
+package models
+
+import "slices"
+
+type Permission string
+
+const (
+	// PermUsersRead allows looking up and searching any user
+	PermUsersRead Permission = "users:read"
+	// PermUsersManage allows changing, suspending and deleting any user
+	PermUsersManage Permission = "users:manage"
+	// PermAuditRead allows reading the admin audit log
+	PermAuditRead Permission = "audit:read"
+	// PermJobsRead allows listing the background jobs
+	PermJobsRead Permission = "jobs:read"
+	// PermJobsManage allows retrying dead background jobs
+	PermJobsManage Permission = "jobs:manage"
+)
+
+var rolePermissions = map[UserRole][]Permission{
+	RoleUser:            {},
+	RoleSupportReadonly: {PermUsersRead, PermAuditRead, PermJobsRead},
+	RoleAdmin:           {PermUsersRead, PermUsersManage, PermAuditRead, PermJobsRead, PermJobsManage},
+}
+
+// Can reports whether the role grants the permission.
+func (r UserRole) Can(permission Permission) bool {
+	return slices.Contains(rolePermissions[r], permission)
+}
+
+// IsValid reports whether the role is one of the known roles.
+func (r UserRole) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
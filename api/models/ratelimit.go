@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit allows Requests per Period, with bursts of up to Requests.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseRateLimit parses limits written as "<requests>/<period>", e.g.
+// "100/1m" or "10/30s".
+func ParseRateLimit(value string) (RateLimit, error) {
+	requests, period, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<period>", value)
+	}
+	count, err := strconv.Atoi(requests)
+	if err != nil || count <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid request count in rate limit %q", value)
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid period in rate limit %q", value)
+	}
+	return RateLimit{Requests: count, Period: duration}, nil
+}
+
+// RefillRate is the number of tokens added back per second.
+func (l RateLimit) RefillRate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// RateLimitBucket is the persisted state of a token bucket.
+type RateLimitBucket struct {
+	Key       string    `gorm:"primaryKey" json:"key"`
+	Tokens    float64   `gorm:"not null" json:"tokens"`
+	UpdatedAt time.Time `gorm:"not null;index" json:"updated_at"`
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the wait until the next token, zero when allowed
+	RetryAfter time.Duration
+	// Reset is the wait until the bucket is full again
+	Reset time.Duration
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"gorm.io/gorm"
 )
 
 type RecordType string
@@ -23,11 +24,13 @@ type Record struct {
 	Tags        pq.StringArray `json:"tags" gorm:"type:text[]"`
 	Type        RecordType     `json:"type" gorm:"type:record_type;not null;index"`
 	Amount      int64          `json:"amount" gorm:"not null"`
+	Version     int64          `json:"version" gorm:"not null;default:1"` // Bumped on every update, exposed as the ETag
 	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
-	DeletedAt   *time.Time     `json:"deleted_at,omitempty" gorm:"index"`
-	UserID      string         `json:"user_id" gorm:"not null;index;constraint:OnDelete:CASCADE"`
-	User        User           `json:"user" gorm:"foreignKey:UserID"` // Foreign key relationship
+	DeletedAt   gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+	UserID      string         `json:"user_id" gorm:"not null;index;constraint:OnDelete:CASCADE"` // Member who created the record
+	User        User           `json:"user" gorm:"foreignKey:UserID"`                             // Foreign key relationship
+	LedgerID    string         `json:"ledger_id" gorm:"not null;index"`                           // Ledger owning the record
 }
 
 type CreateRecordPayload struct {
@@ -38,3 +41,19 @@ type CreateRecordPayload struct {
 	Type        RecordType     `json:"type" binding:"required"`
 	Amount      int64          `json:"amount" binding:"required"`
 }
+
+// UpdateRecordPayload replaces every editable field of a record.
+type UpdateRecordPayload struct {
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description"`
+	Date        time.Time      `json:"date" binding:"required"`
+	Tags        pq.StringArray `json:"tags"`
+	Type        RecordType     `json:"type" binding:"required"`
+	Amount      int64          `json:"amount" binding:"required"`
+}
+
+// TrashFilter pages through the records of a ledger that are in the trash.
+type TrashFilter struct {
+	Page     int `form:"page"`
+	PageSize int `form:"page_size"`
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type HistoryAction string
+
+const (
+	HistoryCreate  HistoryAction = "create"
+	HistoryUpdate  HistoryAction = "update"
+	HistoryDelete  HistoryAction = "delete"
+	HistoryRestore HistoryAction = "restore"
+	HistoryPurge   HistoryAction = "purge"
+)
+
+type ActorType string
+
+const (
+	// ActorUser is a user acting on their own records with a JWT
+	ActorUser ActorType = "user"
+	// ActorAPIKey is a script authenticated with a personal API key
+	ActorAPIKey ActorType = "api_key"
+	// ActorAdmin is an administrator acting on another user's records, e.g.
+	// by deleting their account
+	ActorAdmin ActorType = "admin"
+	// ActorSystem is a background job, e.g. the trash purge
+	ActorSystem ActorType = "system"
+)
+
+type ChangeSource string
+
+const (
+	SourceAPI       ChangeSource = "api"
+	SourceImport    ChangeSource = "import"
+	SourceRetention ChangeSource = "retention"
+	SourceSync      ChangeSource = "sync"
+)
+
+// RecordActor tells who changes records and through what. UserID is the
+// member making the change and LedgerID the ledger it is scoped to.
+type RecordActor struct {
+	UserID   string
+	LedgerID string
+	Type     ActorType
+	ID       string
+	Source   ChangeSource
+}
+
+// Scope returns the ledger scope the actor works in.
+func (a RecordActor) Scope() LedgerScope {
+	return LedgerScope{LedgerID: a.LedgerID, UserID: a.UserID}
+}
+
+// JSONDocument is raw JSON stored in a jsonb column, null when empty.
+type JSONDocument json.RawMessage
+
+func (d JSONDocument) Value() (driver.Value, error) {
+	if len(d) == 0 {
+		return nil, nil
+	}
+	return string(d), nil
+}
+
+func (d *JSONDocument) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*d = nil
+	case []byte:
+		*d = append(JSONDocument(nil), v...)
+	case string:
+		*d = JSONDocument(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONDocument", value)
+	}
+	return nil
+}
+
+func (d JSONDocument) MarshalJSON() ([]byte, error) {
+	if len(d) == 0 {
+		return []byte("null"), nil
+	}
+	return d, nil
+}
+
+func (d *JSONDocument) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = nil
+		return nil
+	}
+	*d = append(JSONDocument(nil), data...)
+	return nil
+}
+
+// RecordHistory is an append-only entry describing one change to a record.
+// Entries outlive the record so purged records keep their history.
+type RecordHistory struct {
+	ID        string        `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	RecordID  string        `gorm:"not null;index" json:"record_id"`
+	UserID    string        `gorm:"not null;index" json:"user_id"`
+	LedgerID  string        `gorm:"index" json:"ledger_id"`
+	Action    HistoryAction `gorm:"not null" json:"action"`
+	ActorType ActorType     `gorm:"not null" json:"actor_type"`
+	ActorID   string        `json:"actor_id,omitempty"`
+	Source    ChangeSource  `gorm:"not null" json:"source"`
+	Before    JSONDocument  `gorm:"type:jsonb" json:"before"`
+	After     JSONDocument  `gorm:"type:jsonb" json:"after"`
+	CreatedAt time.Time     `gorm:"not null;default:current_timestamp;index" json:"created_at"`
+}
+
+func (RecordHistory) TableName() string {
+	return "record_history"
+}
+
+type RecordHistoryFilter struct {
+	Page     int `form:"page"`
+	PageSize int `form:"page_size"`
+}
+
+// Snapshot is the JSON stored in the history, the record without its user.
+func (r Record) Snapshot() (JSONDocument, error) {
+	snapshot := struct {
+		ID          string     `json:"id"`
+		Name        string     `json:"name"`
+		Description string     `json:"description"`
+		Date        time.Time  `json:"date"`
+		Tags        []string   `json:"tags"`
+		Type        RecordType `json:"type"`
+		Amount      int64      `json:"amount"`
+		UserID      string     `json:"user_id"`
+		LedgerID    string     `json:"ledger_id"`
+		Version     int64      `json:"version"`
+		DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	}{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Date:        r.Date,
+		Tags:        r.Tags,
+		Type:        r.Type,
+		Amount:      r.Amount,
+		UserID:      r.UserID,
+		LedgerID:    r.LedgerID,
+		Version:     r.Version,
+	}
+	if r.DeletedAt.Valid {
+		snapshot.DeletedAt = &r.DeletedAt.Time
+	}
+	content, err := json.Marshal(snapshot)
+	return JSONDocument(content), err
+}
@@ -0,0 +1,105 @@
+package models
+
+import "time"
+
+// SyncStrategy decides what happens when a change uploaded by a client was
+// made on an older version of the record than the server has.
+type SyncStrategy string
+
+const (
+	// SyncReportConflicts leaves the server record alone and returns it
+	SyncReportConflicts SyncStrategy = "report_conflicts"
+	// SyncLastWriterWins keeps whichever change was made last
+	SyncLastWriterWins SyncStrategy = "last_writer_wins"
+)
+
+type SyncChangeType string
+
+const (
+	SyncCreated SyncChangeType = "created"
+	SyncUpdated SyncChangeType = "updated"
+	SyncDeleted SyncChangeType = "deleted"
+)
+
+const (
+	DefaultSyncPageSize = 200
+	MaxSyncPageSize     = 500
+)
+
+type SyncFilter struct {
+	Token string `form:"token"`
+	Limit int    `form:"limit"`
+}
+
+// SyncChange is a record that changed since the sync token. Deleted changes
+// are tombstones and only carry the ID and DeletedAt.
+type SyncChange struct {
+	Type      SyncChangeType `json:"type"`
+	ID        string         `json:"id"`
+	Record    *Record        `json:"record,omitempty"`
+	DeletedAt *time.Time     `json:"deleted_at,omitempty"`
+}
+
+// SyncPage is one page of changes. Clients apply it, store NextToken and ask
+// again right away while HasMore is set.
+type SyncPage struct {
+	Changes   []SyncChange `json:"changes"`
+	NextToken string       `json:"next_token"`
+	HasMore   bool         `json:"has_more"`
+}
+
+// SyncUpload is a change made offline. ID is generated by the client for new
+// records, BaseVersion is the version the change was made on, 0 for a record
+// created offline, and UpdatedAt is when the change was made on the device.
+type SyncUpload struct {
+	ID          string               `json:"id" binding:"required,uuid"`
+	Deleted     bool                 `json:"deleted"`
+	BaseVersion int64                `json:"base_version" binding:"min=0"`
+	UpdatedAt   time.Time            `json:"updated_at" binding:"required"`
+	Record      *CreateRecordPayload `json:"record"`
+}
+
+type SyncUploadRequest struct {
+	Strategy SyncStrategy `json:"strategy"`
+	Changes  []SyncUpload `json:"changes" binding:"required,dive"`
+}
+
+type SyncUploadStatus string
+
+const (
+	SyncApplied SyncUploadStatus = "applied"
+	// SyncConflict means the record changed on the server, nothing was done
+	SyncConflict SyncUploadStatus = "conflict"
+	// SyncStale means the server change was made later and was kept
+	SyncStale  SyncUploadStatus = "stale"
+	SyncFailed SyncUploadStatus = "failed"
+)
+
+// SyncUploadResult tells the outcome of one uploaded change. Record is the
+// state of the record on the server afterwards, nil once deleted.
+type SyncUploadResult struct {
+	ID     string           `json:"id"`
+	Status SyncUploadStatus `json:"status"`
+	Record *Record          `json:"record,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+type SyncUploadResponse struct {
+	Strategy SyncStrategy       `json:"strategy"`
+	Results  []SyncUploadResult `json:"results"`
+}
+
+// SyncCursor is what a sync token encodes. Changes are ordered by the ID of
+// the transaction that made them; Xid and ID are the position reached, and
+// Watermark the oldest transaction still running when the round of pages
+// started, where the next round resumes so no late commit is missed. Since
+// is when the previous round started, zero for a first full sync. Tokens
+// only work for the ledger they were issued for.
+type SyncCursor struct {
+	LedgerID   string    `json:"ledger_id,omitempty"`
+	Since      time.Time `json:"since"`
+	Xid        string    `json:"xid"`
+	ID         string    `json:"id"`
+	Watermark  string    `json:"watermark,omitempty"`
+	RoundStart time.Time `json:"round_start"`
+}
@@ -6,35 +6,87 @@ import (
 	"gorm.io/gorm"
 )
 
+type UserRole string
+
+const (
+	// RoleUser is the default role for self-registered users
+	RoleUser UserRole = "user"
+	// RoleAdmin can manage every user account
+	RoleAdmin UserRole = "admin"
+	// RoleSupportReadonly can look up users and audit logs but not change them
+	RoleSupportReadonly UserRole = "support-readonly"
+)
+
+type UserStatus string
+
+const (
+	// StatusActive users can log in and use the API
+	StatusActive UserStatus = "active"
+	// StatusSuspended users are locked out until reactivated by an admin
+	StatusSuspended UserStatus = "suspended"
+)
+
 type User struct {
-	ID        string         `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
-	Name      string         `gorm:"not null" json:"name"`
-	Email     string         `gorm:"unique;not null" json:"email"`
-	Password  string         `gorm:"not null" json:"password,omitempty"`
-	Records   []Record       `gorm:"foreignKey:UserID"` // has-many
-	CreatedAt time.Time      `gorm:"not null;default:current_timestamp" json:"created_at"`
-	UpdatedAt time.Time      `gorm:"not null;default:current_timestamp" json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID       string     `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	Name     string     `gorm:"not null" json:"name"`
+	Email    string     `gorm:"unique;not null" json:"email"`
+	Password string     `gorm:"not null" json:"password,omitempty"`
+	Role     UserRole   `gorm:"not null;default:'user';index" json:"role"`
+	Status   UserStatus `gorm:"not null;default:'active';index" json:"status"`
+	// EmailVerifiedAt is when the email was shown to belong to the user, nil
+	// for password signups. It is cleared when the email changes.
+	EmailVerifiedAt *time.Time     `json:"email_verified_at,omitempty"`
+	Records         []Record       `gorm:"foreignKey:UserID"` // has-many
+	CreatedAt       time.Time      `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"not null;default:current_timestamp" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 type CreateUserPayload struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8"`
 }
 
 type UserResponse struct {
 	ID        string     `json:"id"`
 	Name      string     `json:"name"`
 	Email     string     `json:"email"`
+	Role      UserRole   `json:"role"`
+	Status    UserStatus `json:"status"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
-	Records   []Record   `json:"records,omitempty"` // Include records if needed
 }
 
 type UpdateUserPayload struct {
-	Name     *string `json:"name,omitempty"`
-	Email    *string `json:"email,omitempty"`
-	Password *string `json:"password,omitempty"`
+	Name     *string   `json:"name,omitempty"`
+	Email    *string   `json:"email,omitempty" binding:"omitempty,email"`
+	Password *string   `json:"password,omitempty" binding:"omitempty,min=8"`
+	Role     *UserRole `json:"role,omitempty"`
+}
+
+// UpdateProfilePayload is what a user may change on their own account;
+// passwords go through ChangePasswordPayload instead.
+type UpdateProfilePayload struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty" binding:"omitempty,email"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// UserFilter narrows down admin user searches.
+type UserFilter struct {
+	Query    string     `form:"q"`
+	Role     UserRole   `form:"role"`
+	Status   UserStatus `form:"status"`
+	Page     int        `form:"page"`
+	PageSize int        `form:"page_size"`
+}
+
+type SuspendUserPayload struct {
+	Reason string `json:"reason"`
 }
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	EventRecordCreated  = "record.created"
+	EventRecordUpdated  = "record.updated"
+	EventRecordDeleted  = "record.deleted"
+	EventRecordRestored = "record.restored"
+	// EventImportCompleted is sent when a bulk request marked as an import,
+	// see SourceImport, is committed
+	EventImportCompleted = "import.completed"
+)
+
+// WebhookEvents are the events a webhook can subscribe to. budget.exceeded,
+// also asked for with webhooks, is deferred until budgets exist: there is
+// nothing to exceed yet, and accepting subscriptions to an event that is
+// never sent would only mislead receivers.
+var WebhookEvents = []string{EventRecordCreated, EventRecordUpdated, EventRecordDeleted, EventRecordRestored, EventImportCompleted}
+
+// IsValidWebhookEvent reports whether event is one webhooks can subscribe to.
+func IsValidWebhookEvent(event string) bool {
+	return slices.Contains(WebhookEvents, event)
+}
+
+// Webhook is an endpoint receiving the events of the ledgers its user is a
+// member of. The secret signs the deliveries so it is stored in clear, it is
+// only shown on creation and rotation.
+type Webhook struct {
+	ID          string         `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID      string         `gorm:"not null;index" json:"user_id"`
+	URL         string         `gorm:"not null" json:"url"`
+	Description string         `gorm:"not null;default:''" json:"description"`
+	Events      pq.StringArray `gorm:"type:text[];not null" json:"events"`
+	Secret      string         `gorm:"not null" json:"-"`
+	Active      bool           `gorm:"not null;default:true" json:"active"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+type DeliveryStatus string
+
+const (
+	// DeliveryPending is waiting for its first attempt or a retry
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliverySucceeded got a 2xx response
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryFailed ran out of attempts
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event queued for one webhook, it keeps the outcome
+// of the last attempt. Redelivering creates a new delivery of the same
+// event.
+type WebhookDelivery struct {
+	ID             string         `gorm:"type:string;default:gen_random_uuid();primaryKey" json:"id"`
+	WebhookID      string         `gorm:"not null" json:"webhook_id"`
+	EventID        string         `gorm:"not null" json:"event_id"`
+	Event          string         `gorm:"not null" json:"event"`
+	Payload        JSONDocument   `gorm:"type:jsonb;not null" json:"payload"`
+	Status         DeliveryStatus `gorm:"not null;default:pending" json:"status"`
+	Attempts       int            `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  *time.Time     `json:"next_attempt_at,omitempty"`
+	ResponseStatus *int           `json:"response_status,omitempty"`
+	Error          string         `gorm:"not null;default:''" json:"error,omitempty"`
+	DurationMS     int64          `gorm:"not null;default:0" json:"duration_ms"`
+	DeliveredAt    *time.Time     `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	// URL, Secret and whether the webhook is active, read when sending
+	URL           string `gorm:"->;-:migration" json:"-"`
+	Secret        string `gorm:"->;-:migration" json:"-"`
+	WebhookActive bool   `gorm:"->;-:migration" json:"-"`
+}
+
+// DeliveryAttempt is the outcome of sending a delivery once. Status is 0
+// when no response was received.
+type DeliveryAttempt struct {
+	Status   int
+	Error    string
+	Duration time.Duration
+}
+
+// Succeeded reports whether the endpoint acknowledged the delivery.
+func (a DeliveryAttempt) Succeeded() bool {
+	return a.Status >= 200 && a.Status < 300
+}
+
+// WebhookEvent is the body POSTed to webhooks.
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	LedgerID  string          `json:"ledger_id"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// RecordEventData is the data of record events, Record is the record after
+// the change.
+type RecordEventData struct {
+	Record JSONDocument `json:"record"`
+	Actor  EventActor   `json:"actor"`
+}
+
+// ImportEventData is the data of import.completed.
+type ImportEventData struct {
+	Mode      BulkMode   `json:"mode"`
+	Succeeded int        `json:"succeeded"`
+	Failed    int        `json:"failed"`
+	Actor     EventActor `json:"actor"`
+}
+
+// EventActor tells who caused an event.
+type EventActor struct {
+	UserID string       `json:"user_id"`
+	Type   ActorType    `json:"type"`
+	Source ChangeSource `json:"source"`
+}
+
+type CreateWebhookPayload struct {
+	URL         string   `json:"url" binding:"required,url,max=2048"`
+	Description string   `json:"description" binding:"max=200"`
+	Events      []string `json:"events" binding:"required,min=1"`
+}
+
+// UpdateWebhookPayload changes the fields that are set.
+type UpdateWebhookPayload struct {
+	URL         *string  `json:"url" binding:"omitempty,url,max=2048"`
+	Description *string  `json:"description" binding:"omitempty,max=200"`
+	Events      []string `json:"events" binding:"omitempty,min=1"`
+	Active      *bool    `json:"active"`
+}
+
+// WebhookSecretResponse is returned on creation and secret rotation, the
+// only times the secret is visible.
+type WebhookSecretResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookDeliveryFilter struct {
+	Status   DeliveryStatus `form:"status" binding:"omitempty,oneof=pending succeeded failed"`
+	Event    string         `form:"event"`
+	Page     int            `form:"page"`
+	PageSize int            `form:"page_size"`
+}
@@ -0,0 +1,121 @@
+// Package openapi serves the hand-maintained OpenAPI 3 description of the
+// /api/v1 routes and checks it against the routes registered in Gin.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BasePath is the server URL of the spec, paths in the spec are relative to it.
+const BasePath = "/api/v1"
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the raw OpenAPI document.
+func Spec() []byte {
+	return spec
+}
+
+// RegisterRoutes serves the spec at /openapi.json and the Swagger UI and Redoc
+// viewers at /docs and /redoc.
+func RegisterRoutes(router gin.IRoutes) {
+	router.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", spec)
+	})
+	router.GET("/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+	})
+	router.GET("/redoc", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(redocUI))
+	})
+}
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+var httpMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"patch": true, "head": true, "options": true, "trace": true,
+}
+
+// CheckRoutes compares the /api/v1 routes registered in Gin with the spec and
+// returns an error listing the routes missing on either side.
+func CheckRoutes(routes gin.RoutesInfo) error {
+	var document struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &document); err != nil {
+		return fmt.Errorf("parsing openapi.json: %w", err)
+	}
+
+	documented := map[string]bool{}
+	for path, operations := range document.Paths {
+		for method := range operations {
+			if httpMethods[method] {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	registered := map[string]bool{}
+	for _, route := range routes {
+		path, ok := strings.CutPrefix(route.Path, BasePath)
+		if !ok {
+			continue
+		}
+		registered[route.Method+" "+ginParam.ReplaceAllString(path, "{$1}")] = true
+	}
+
+	var drift []string
+	for route := range registered {
+		if !documented[route] {
+			drift = append(drift, "undocumented route "+route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			drift = append(drift, "documented route not registered "+route)
+		}
+	}
+	if len(drift) == 0 {
+		return nil
+	}
+	sort.Strings(drift)
+	return fmt.Errorf("openapi.json is out of date with the router:\n  %s", strings.Join(drift, "\n  "))
+}
+
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Coin Pilot API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>`
+
+const redocUI = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Coin Pilot API</title>
+</head>
+<body>
+  <redoc spec-url="/openapi.json"></redoc>
+  <script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+</body>
+</html>`
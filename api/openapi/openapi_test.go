@@ -0,0 +1,43 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSpecIsValidJSON(t *testing.T) {
+	var document map[string]any
+	if err := json.Unmarshal(Spec(), &document); err != nil {
+		t.Fatalf("openapi.json does not parse: %v", err)
+	}
+	if document["openapi"] == nil || document["paths"] == nil {
+		t.Fatal("openapi.json misses the openapi version or the paths")
+	}
+}
+
+func TestCheckRoutesReportsDrift(t *testing.T) {
+	routes := gin.RoutesInfo{
+		{Method: "GET", Path: "/api/v1/records/:id"},
+		{Method: "GET", Path: "/api/v1/not-documented/:id"},
+		// Outside /api/v1, not checked
+		{Method: "GET", Path: "/livez"},
+	}
+	err := CheckRoutes(routes)
+	if err == nil {
+		t.Fatal("drift was not reported")
+	}
+	if !strings.Contains(err.Error(), "undocumented route GET /not-documented/{id}") {
+		t.Errorf("undocumented route missing from %q", err)
+	}
+	if !strings.Contains(err.Error(), "documented route not registered POST /records/new") {
+		t.Errorf("unregistered documented route missing from %q", err)
+	}
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if strings.HasSuffix(line, "GET /records/{id}") || strings.Contains(line, "livez") {
+			t.Errorf("matching or unversioned route reported: %q", line)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string) error
+	TouchAPIKey(ctx context.Context, id string) error
+}
+
+type APIKeyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &APIKeyRepositoryImpl{db: db}
+}
+
+func (r *APIKeyRepositoryImpl) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	if err := r.db.WithContext(ctx).Create(key).Error; err != nil {
+		logger.ErrorCtx(ctx, "error creating api key: %v", err)
+		return errors.New(http.StatusInternalServerError, "error creating api key")
+	}
+	return nil
+}
+
+func (r *APIKeyRepositoryImpl) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&keys)
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error listing api keys: %v", result.Error)
+		return nil, errors.New(http.StatusInternalServerError, "error listing api keys")
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepositoryImpl) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	result := r.db.WithContext(ctx).Where("prefix = ?", prefix).First(key)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, errors.NewNotFound("api key")
+		}
+		logger.ErrorCtx(ctx, "error fetching api key: %v", result.Error)
+		return nil, errors.New(http.StatusInternalServerError, "error fetching api key")
+	}
+	return key, nil
+}
+
+func (r *APIKeyRepositoryImpl) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error revoking api key: %v", result.Error)
+		return errors.New(http.StatusInternalServerError, "error revoking api key")
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("api key")
+	}
+	return nil
+}
+
+func (r *APIKeyRepositoryImpl) TouchAPIKey(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", time.Now())
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error updating api key usage: %v", result.Error)
+		return errors.New(http.StatusInternalServerError, "error updating api key usage")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	CreateAuditLog(ctx context.Context, entry *models.AuditLog) error
+	ListAuditLogs(ctx context.Context, filter models.AuditLogFilter) ([]models.AuditLog, int64, error)
+}
+
+type AuditRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &AuditRepositoryImpl{db: db}
+}
+
+func (r *AuditRepositoryImpl) CreateAuditLog(ctx context.Context, entry *models.AuditLog) error {
+	if err := r.db.WithContext(ctx).Create(entry).Error; err != nil {
+		logger.ErrorCtx(ctx, "error creating audit log: %v", err)
+		return errors.New(http.StatusInternalServerError, "error creating audit log")
+	}
+	return nil
+}
+
+func (r *AuditRepositoryImpl) ListAuditLogs(
+	ctx context.Context,
+	filter models.AuditLogFilter,
+) ([]models.AuditLog, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.AuditLog{})
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action ILIKE ?", "%"+filter.Action+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.ErrorCtx(ctx, "error counting audit logs: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing audit logs")
+	}
+
+	var entries []models.AuditLog
+	limit, offset := paginate(filter.Page, filter.PageSize)
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		logger.ErrorCtx(ctx, "error listing audit logs: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing audit logs")
+	}
+	return entries, total, nil
+}
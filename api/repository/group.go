@@ -0,0 +1,393 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GroupRepository stores groups and their expenses. Every query is scoped to
+// the groups userID is a registered member of.
+type GroupRepository interface {
+	ListGroups(ctx context.Context, userID string) ([]models.Group, error)
+	CreateGroup(ctx context.Context, group *models.Group) error
+	GetGroup(ctx context.Context, userID, groupID string) (*models.Group, error)
+	RenameGroup(ctx context.Context, userID, groupID, name string) error
+	DeleteGroup(ctx context.Context, userID, groupID string) error
+	AddMember(ctx context.Context, userID string, member *models.GroupMember) error
+	RemoveMember(ctx context.Context, userID, groupID, memberID string) error
+	CreateExpense(ctx context.Context, userID string, expense *models.GroupExpense) error
+	ListExpenses(ctx context.Context, userID, groupID string, filter models.GroupExpenseFilter) ([]models.GroupExpense, int64, error)
+	GetExpense(ctx context.Context, userID, groupID, id string) (*models.GroupExpense, error)
+	DeleteExpense(ctx context.Context, userID, groupID, id string) error
+	CreateSettlement(ctx context.Context, userID string, settlement *models.GroupSettlement) error
+	ListSettlements(ctx context.Context, userID, groupID string) ([]models.GroupSettlement, error)
+	DeleteSettlement(ctx context.Context, userID, groupID, id string) error
+	Balances(ctx context.Context, userID, groupID string) ([]models.MemberBalance, error)
+}
+
+var (
+	// errMemberInUse stops removing a member that expenses or settlements
+	// still refer to.
+	errMemberInUse = stderrors.New("member has expenses or settlements, delete them first")
+	// errLastRegisteredMember stops a change that would leave a group nobody
+	// can access.
+	errLastRegisteredMember = stderrors.New("group must keep at least one registered member")
+	// errUnknownMember rejects expenses and settlements naming someone who is
+	// not in the group.
+	errUnknownMember = stderrors.New("every member must belong to the group")
+	// errAlreadyMember rejects adding a user twice.
+	errAlreadyMember = stderrors.New("user is already a member of the group")
+)
+
+type GroupRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewGroupRepository(db *gorm.DB) GroupRepository {
+	return &GroupRepositoryImpl{db: db}
+}
+
+// inGroupOf scopes a query on table to the groups userID is a member of.
+func inGroupOf(table, column, userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(table+"."+column+" IN (SELECT group_id FROM group_members WHERE user_id = ?)", userID)
+	}
+}
+
+// lockGroup locks the group for the rest of the transaction, so member
+// changes and new expenses do not race. It fails with a 404 AppError unless
+// userID is a member.
+func lockGroup(tx *gorm.DB, userID, groupID string) (*models.Group, error) {
+	var group models.Group
+	err := tx.Scopes(inGroupOf("groups", "id", userID)).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&group, "id = ?", groupID).Error
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.NewNotFound("group")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r *GroupRepositoryImpl) ListGroups(ctx context.Context, userID string) ([]models.Group, error) {
+	var groups []models.Group
+	err := r.db.WithContext(ctx).Scopes(inGroupOf("groups", "id", userID)).
+		Preload("Members", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, id") }).
+		Order("created_at DESC").Find(&groups).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error listing groups: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error listing groups")
+	}
+	return groups, nil
+}
+
+func (r *GroupRepositoryImpl) CreateGroup(ctx context.Context, group *models.Group) error {
+	// Members are inserted with the group
+	if err := r.db.WithContext(ctx).Create(group).Error; err != nil {
+		logger.ErrorCtx(ctx, "error creating group: %v", err)
+		return errors.New(http.StatusInternalServerError, "error creating group")
+	}
+	return nil
+}
+
+func (r *GroupRepositoryImpl) GetGroup(ctx context.Context, userID, groupID string) (*models.Group, error) {
+	var group models.Group
+	err := r.db.WithContext(ctx).Scopes(inGroupOf("groups", "id", userID)).
+		Preload("Members", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, id") }).
+		First(&group, "id = ?", groupID).Error
+	if err != nil {
+		return nil, groupError(ctx, "fetching", "group", err)
+	}
+	return &group, nil
+}
+
+func (r *GroupRepositoryImpl) RenameGroup(ctx context.Context, userID, groupID, name string) error {
+	result := r.db.WithContext(ctx).Model(&models.Group{}).Scopes(inGroupOf("groups", "id", userID)).
+		Where("id = ?", groupID).Update("name", name)
+	if result.Error != nil {
+		return groupError(ctx, "renaming", "group", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("group")
+	}
+	return nil
+}
+
+// DeleteGroup deletes the group with its expenses and settlements, the
+// records they came from are kept.
+func (r *GroupRepositoryImpl) DeleteGroup(ctx context.Context, userID, groupID string) error {
+	result := r.db.WithContext(ctx).Scopes(inGroupOf("groups", "id", userID)).
+		Where("id = ?", groupID).Delete(&models.Group{})
+	if result.Error != nil {
+		return groupError(ctx, "deleting", "group", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("group")
+	}
+	return nil
+}
+
+func (r *GroupRepositoryImpl) AddMember(ctx context.Context, userID string, member *models.GroupMember) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockGroup(tx, userID, member.GroupID); err != nil {
+			return err
+		}
+		if member.UserID != nil {
+			var count int64
+			err := tx.Model(&models.GroupMember{}).
+				Where("group_id = ? AND user_id = ?", member.GroupID, *member.UserID).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return errAlreadyMember
+			}
+		}
+		return tx.Create(member).Error
+	})
+	if err != nil {
+		return groupError(ctx, "adding", "group", err)
+	}
+	return nil
+}
+
+// RemoveMember removes a member nothing refers to anymore. Removing their
+// own member leaves the group.
+func (r *GroupRepositoryImpl) RemoveMember(ctx context.Context, userID, groupID, memberID string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockGroup(tx, userID, groupID); err != nil {
+			return err
+		}
+		var member models.GroupMember
+		if err := tx.First(&member, "id = ? AND group_id = ?", memberID, groupID).Error; err != nil {
+			return err
+		}
+
+		var used int64
+		err := tx.Raw(`
+			SELECT
+				(SELECT count(*) FROM group_expenses WHERE paid_by = @member) +
+				(SELECT count(*) FROM group_expense_shares WHERE member_id = @member) +
+				(SELECT count(*) FROM group_settlements WHERE from_id = @member OR to_id = @member)`,
+			map[string]any{"member": memberID},
+		).Scan(&used).Error
+		if err != nil {
+			return err
+		}
+		if used > 0 {
+			return errMemberInUse
+		}
+
+		if member.UserID != nil {
+			var others int64
+			err := tx.Model(&models.GroupMember{}).
+				Where("group_id = ? AND id <> ? AND user_id IS NOT NULL", groupID, memberID).
+				Count(&others).Error
+			if err != nil {
+				return err
+			}
+			if others == 0 {
+				return errLastRegisteredMember
+			}
+		}
+		return tx.Delete(&member).Error
+	})
+	if err != nil {
+		return groupError(ctx, "removing", "member", err)
+	}
+	return nil
+}
+
+// CreateExpense stores the expense with its shares, the payer and every
+// member sharing it must be in the group.
+func (r *GroupRepositoryImpl) CreateExpense(ctx context.Context, userID string, expense *models.GroupExpense) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockGroup(tx, userID, expense.GroupID); err != nil {
+			return err
+		}
+		memberIDs := []string{expense.PaidBy}
+		for _, share := range expense.Shares {
+			memberIDs = append(memberIDs, share.MemberID)
+		}
+		if err := checkMembers(tx, expense.GroupID, memberIDs); err != nil {
+			return err
+		}
+		return tx.Create(expense).Error
+	})
+	if err != nil {
+		return groupError(ctx, "creating", "expense", err)
+	}
+	return nil
+}
+
+func (r *GroupRepositoryImpl) ListExpenses(
+	ctx context.Context,
+	userID, groupID string,
+	filter models.GroupExpenseFilter,
+) ([]models.GroupExpense, int64, error) {
+	if err := r.checkGroup(ctx, userID, groupID); err != nil {
+		return nil, 0, err
+	}
+	query := r.db.WithContext(ctx).Model(&models.GroupExpense{}).Where("group_id = ?", groupID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.ErrorCtx(ctx, "error counting group expenses: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing expenses")
+	}
+
+	var expenses []models.GroupExpense
+	limit, offset := paginate(filter.Page, filter.PageSize)
+	err := query.Preload("Shares").Order("date DESC, created_at DESC, id").Limit(limit).Offset(offset).Find(&expenses).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error listing group expenses: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing expenses")
+	}
+	return expenses, total, nil
+}
+
+func (r *GroupRepositoryImpl) GetExpense(ctx context.Context, userID, groupID, id string) (*models.GroupExpense, error) {
+	var expense models.GroupExpense
+	err := r.db.WithContext(ctx).Scopes(inGroupOf("group_expenses", "group_id", userID)).Preload("Shares").
+		First(&expense, "id = ? AND group_id = ?", id, groupID).Error
+	if err != nil {
+		return nil, groupError(ctx, "fetching", "expense", err)
+	}
+	return &expense, nil
+}
+
+func (r *GroupRepositoryImpl) DeleteExpense(ctx context.Context, userID, groupID, id string) error {
+	result := r.db.WithContext(ctx).Scopes(inGroupOf("group_expenses", "group_id", userID)).
+		Where("id = ? AND group_id = ?", id, groupID).Delete(&models.GroupExpense{})
+	if result.Error != nil {
+		return groupError(ctx, "deleting", "expense", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("expense")
+	}
+	return nil
+}
+
+func (r *GroupRepositoryImpl) CreateSettlement(ctx context.Context, userID string, settlement *models.GroupSettlement) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockGroup(tx, userID, settlement.GroupID); err != nil {
+			return err
+		}
+		if err := checkMembers(tx, settlement.GroupID, []string{settlement.FromID, settlement.ToID}); err != nil {
+			return err
+		}
+		return tx.Create(settlement).Error
+	})
+	if err != nil {
+		return groupError(ctx, "creating", "settlement", err)
+	}
+	return nil
+}
+
+func (r *GroupRepositoryImpl) ListSettlements(ctx context.Context, userID, groupID string) ([]models.GroupSettlement, error) {
+	if err := r.checkGroup(ctx, userID, groupID); err != nil {
+		return nil, err
+	}
+	var settlements []models.GroupSettlement
+	err := r.db.WithContext(ctx).Where("group_id = ?", groupID).Order("date DESC, created_at DESC, id").Find(&settlements).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error listing settlements: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error listing settlements")
+	}
+	return settlements, nil
+}
+
+func (r *GroupRepositoryImpl) DeleteSettlement(ctx context.Context, userID, groupID, id string) error {
+	result := r.db.WithContext(ctx).Scopes(inGroupOf("group_settlements", "group_id", userID)).
+		Where("id = ? AND group_id = ?", id, groupID).Delete(&models.GroupSettlement{})
+	if result.Error != nil {
+		return groupError(ctx, "deleting", "settlement", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("settlement")
+	}
+	return nil
+}
+
+// Balances returns what every member paid and sent minus what they owe and
+// received, positive when the group owes them.
+func (r *GroupRepositoryImpl) Balances(ctx context.Context, userID, groupID string) ([]models.MemberBalance, error) {
+	if err := r.checkGroup(ctx, userID, groupID); err != nil {
+		return nil, err
+	}
+	var balances []models.MemberBalance
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT m.id AS member_id, m.name,
+			COALESCE((SELECT sum(amount) FROM group_expenses WHERE paid_by = m.id), 0)
+			- COALESCE((SELECT sum(amount) FROM group_expense_shares WHERE member_id = m.id), 0)
+			+ COALESCE((SELECT sum(amount) FROM group_settlements WHERE from_id = m.id), 0)
+			- COALESCE((SELECT sum(amount) FROM group_settlements WHERE to_id = m.id), 0) AS balance
+		FROM group_members m
+		WHERE m.group_id = ?
+		ORDER BY m.created_at, m.id`, groupID,
+	).Scan(&balances).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error computing group balances: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error computing balances")
+	}
+	return balances, nil
+}
+
+// checkGroup fails with a 404 unless userID is a member of the group.
+func (r *GroupRepositoryImpl) checkGroup(ctx context.Context, userID, groupID string) error {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.GroupMember{}).
+		Where("group_id = ? AND user_id = ?", groupID, userID).Count(&count).Error
+	if err != nil {
+		return groupError(ctx, "fetching", "group", err)
+	}
+	if count == 0 {
+		return errors.NewNotFound("group")
+	}
+	return nil
+}
+
+// checkMembers fails with errUnknownMember unless every ID is a member of the
+// group.
+func checkMembers(tx *gorm.DB, groupID string, memberIDs []string) error {
+	unique := map[string]bool{}
+	for _, id := range memberIDs {
+		unique[id] = true
+	}
+	var count int64
+	err := tx.Model(&models.GroupMember{}).Where("group_id = ? AND id IN ?", groupID, memberIDs).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count != int64(len(unique)) {
+		return errUnknownMember
+	}
+	return nil
+}
+
+// groupError maps a failed group query to an AppError, resource is what was
+// not found.
+func groupError(ctx context.Context, operation, resource string, err error) error {
+	if _, ok := errors.IsAppError(err); ok {
+		return err
+	}
+	switch {
+	case stderrors.Is(err, gorm.ErrRecordNotFound):
+		return errors.NewNotFound(resource)
+	case stderrors.Is(err, errMemberInUse), stderrors.Is(err, errLastRegisteredMember), stderrors.Is(err, errAlreadyMember):
+		return errors.New(http.StatusConflict, err.Error())
+	case stderrors.Is(err, errUnknownMember):
+		return errors.NewBadRequest(err.Error())
+	}
+	logger.ErrorCtx(ctx, "error %s %s: %v", operation, resource, err)
+	return errors.New(http.StatusInternalServerError, "error "+operation+" "+resource)
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/aq-simei/coin-pilot/internal/config/database"
+	"gorm.io/gorm"
+)
+
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+	PendingMigrations(ctx context.Context) ([]string, error)
+}
+
+type HealthRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewHealthRepository(db *gorm.DB) HealthRepository {
+	return &HealthRepositoryImpl{db: db}
+}
+
+func (r *HealthRepositoryImpl) Ping(ctx context.Context) error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (r *HealthRepositoryImpl) PendingMigrations(ctx context.Context) ([]string, error) {
+	return database.PendingMigrations(r.db.WithContext(ctx))
+}
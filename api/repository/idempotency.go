@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyStore keeps the responses replayed for reused Idempotency-Key
+// headers. It lives in Postgres so retries reaching another instance, or
+// arriving after a restart, are still recognised.
+type IdempotencyStore interface {
+	// Claim reserves the key for a new request. When the key is already
+	// taken and not expired it returns the existing entry and false.
+	Claim(ctx context.Context, entry models.IdempotencyKey) (*models.IdempotencyKey, bool, error)
+	// Complete stores the response of a claimed key.
+	Complete(ctx context.Context, entry models.IdempotencyKey) error
+	// Release forgets a claimed key so the request can be retried.
+	Release(ctx context.Context, userID, key string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type PostgresIdempotencyStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresIdempotencyStore(db *gorm.DB) IdempotencyStore {
+	return &PostgresIdempotencyStore{db: db}
+}
+
+func (s *PostgresIdempotencyStore) Claim(ctx context.Context, entry models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	var existing models.IdempotencyKey
+	claimed := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// An expired entry is as good as none, drop it before claiming
+		result := tx.Where("user_id = ? AND key = ? AND expires_at <= ?", entry.UserID, entry.Key, entry.CreatedAt).
+			Delete(&models.IdempotencyKey{})
+		if result.Error != nil {
+			return result.Error
+		}
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			claimed = true
+			return nil
+		}
+		return tx.First(&existing, "user_id = ? AND key = ?", entry.UserID, entry.Key).Error
+	})
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			// Released between our insert and read, the client can retry
+			return nil, false, errors.New(http.StatusConflict, "idempotency key was released, retry the request")
+		}
+		logger.ErrorCtx(ctx, "error claiming idempotency key: %v", err)
+		return nil, false, errors.New(http.StatusInternalServerError, "error checking idempotency key")
+	}
+	if claimed {
+		return &entry, true, nil
+	}
+	return &existing, false, nil
+}
+
+func (s *PostgresIdempotencyStore) Complete(ctx context.Context, entry models.IdempotencyKey) error {
+	err := s.db.WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("user_id = ? AND key = ?", entry.UserID, entry.Key).
+		Updates(map[string]any{
+			"status_code":      entry.StatusCode,
+			"response_headers": entry.ResponseHeaders,
+			"response_body":    entry.ResponseBody,
+			"completed_at":     entry.CompletedAt,
+		}).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error storing idempotent response: %v", err)
+		return errors.New(http.StatusInternalServerError, "error storing idempotent response")
+	}
+	return nil
+}
+
+func (s *PostgresIdempotencyStore) Release(ctx context.Context, userID, key string) error {
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND key = ? AND completed_at IS NULL", userID, key).
+		Delete(&models.IdempotencyKey{}).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error releasing idempotency key: %v", err)
+		return errors.New(http.StatusInternalServerError, "error releasing idempotency key")
+	}
+	return nil
+}
+
+func (s *PostgresIdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error deleting expired idempotency keys: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
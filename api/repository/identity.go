@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdentityRepository interface {
+	GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error)
+	LinkIdentity(ctx context.Context, identity models.UserIdentity, name string) (*models.User, error)
+	// AttachIdentity links the identity to a user who is already logged in.
+	AttachIdentity(ctx context.Context, userID string, identity models.UserIdentity) (*models.User, error)
+	CreatePendingLogin(ctx context.Context, login *models.PendingLogin) error
+	// TakePendingLogin deletes and returns the login started with state,
+	// unless it expired before now. A state can only be taken once.
+	TakePendingLogin(ctx context.Context, state string, now time.Time) (*models.PendingLogin, error)
+	DeleteExpiredPendingLogins(ctx context.Context, now time.Time) (int64, error)
+}
+
+var (
+	// errAccountUnverified refuses to link a provider to an account whose
+	// email was never verified, whoever signed up with it may not own it.
+	errAccountUnverified = stderrors.New("an account already uses this email, log in with its password and link the provider from there")
+	// errIdentityTaken stops linking a provider account to a second user.
+	errIdentityTaken = stderrors.New("this provider account is linked to another user")
+)
+
+type IdentityRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) IdentityRepository {
+	return &IdentityRepositoryImpl{db: db}
+}
+
+func (r *IdentityRepositoryImpl) GetUserByIdentity(
+	ctx context.Context,
+	provider, subject string,
+) (*models.User, error) {
+	identity := &models.UserIdentity{}
+	result := r.db.WithContext(ctx).Preload("User").
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(identity)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, errors.New(http.StatusNotFound, "identity not found")
+		}
+		logger.ErrorCtx(ctx, "error fetching identity: %v", result.Error)
+		return nil, errors.New(http.StatusInternalServerError, "error fetching identity")
+	}
+	return &identity.User, nil
+}
+
+// LinkIdentity attaches the identity to the user owning identity.Email,
+// creating a password-less user when no account exists yet. Only an account
+// with a verified email is linked, the caller checks the provider verified
+// its side.
+func (r *IdentityRepositoryImpl) LinkIdentity(
+	ctx context.Context,
+	identity models.UserIdentity,
+	name string,
+) (*models.User, error) {
+	user := &models.User{}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("email = ?", identity.Email).First(user)
+		if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+			return result.Error
+		}
+		if result.Error == nil && user.EmailVerifiedAt == nil {
+			return errAccountUnverified
+		}
+		if result.Error == gorm.ErrRecordNotFound {
+			if name == "" {
+				name = identity.Email
+			}
+			now := time.Now()
+			user = &models.User{
+				Name:            name,
+				Email:           identity.Email,
+				EmailVerifiedAt: &now,
+			}
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+		}
+
+		identity.UserID = user.ID
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return nil, identityError(ctx, "linking", err)
+	}
+	return user, nil
+}
+
+func (r *IdentityRepositoryImpl) AttachIdentity(
+	ctx context.Context,
+	userID string,
+	identity models.UserIdentity,
+) (*models.User, error) {
+	user := &models.User{}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		var linked models.UserIdentity
+		result := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).Limit(1).Find(&linked)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			if linked.UserID != userID {
+				return errIdentityTaken
+			}
+			return nil
+		}
+		identity.UserID = userID
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return nil, identityError(ctx, "attaching", err)
+	}
+	return user, nil
+}
+
+func identityError(ctx context.Context, action string, err error) error {
+	switch {
+	case stderrors.Is(err, gorm.ErrRecordNotFound):
+		return errors.NewNotFound("user")
+	case stderrors.Is(err, errAccountUnverified), stderrors.Is(err, errIdentityTaken):
+		return errors.New(http.StatusConflict, err.Error())
+	}
+	logger.ErrorCtx(ctx, "error %s identity: %v", action, err)
+	return errors.New(http.StatusInternalServerError, "error "+action+" identity")
+}
+
+func (r *IdentityRepositoryImpl) CreatePendingLogin(ctx context.Context, login *models.PendingLogin) error {
+	if err := r.db.WithContext(ctx).Create(login).Error; err != nil {
+		logger.ErrorCtx(ctx, "error saving pending login: %v", err)
+		return errors.New(http.StatusInternalServerError, "error saving pending login")
+	}
+	return nil
+}
+
+func (r *IdentityRepositoryImpl) TakePendingLogin(ctx context.Context, state string, now time.Time) (*models.PendingLogin, error) {
+	var logins []models.PendingLogin
+	result := r.db.WithContext(ctx).Clauses(clause.Returning{}).
+		Where("state = ? AND expires_at > ?", state, now).
+		Delete(&logins)
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error taking pending login: %v", result.Error)
+		return nil, errors.New(http.StatusInternalServerError, "error fetching pending login")
+	}
+	if len(logins) == 0 {
+		return nil, errors.New(http.StatusNotFound, "pending login not found")
+	}
+	return &logins[0], nil
+}
+
+func (r *IdentityRepositoryImpl) DeleteExpiredPendingLogins(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&models.PendingLogin{})
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error deleting expired pending logins: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobRepository is the queue of background jobs. Jobs caused by a change
+// are queued by the repository making it, in the same transaction, see
+// enqueueJob.
+type JobRepository interface {
+	Enqueue(ctx context.Context, job *models.Job) error
+	ClaimJobs(ctx context.Context, kinds []string, limit int, lockUntil time.Time) ([]models.Job, error)
+	CompleteJob(ctx context.Context, job *models.Job) error
+	RetryJobAt(ctx context.Context, job *models.Job, runAt time.Time, reason string) error
+	BuryJob(ctx context.Context, job *models.Job, reason string) error
+	ListJobs(ctx context.Context, filter models.JobFilter) ([]models.Job, int64, error)
+	RequeueJob(ctx context.Context, id string) (*models.Job, error)
+	PurgeJobsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type JobRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &JobRepositoryImpl{db: db}
+}
+
+// Enqueue queues the job, a job whose unique key is already queued is
+// dropped.
+func (r *JobRepositoryImpl) Enqueue(ctx context.Context, job *models.Job) error {
+	if err := enqueueJob(r.db.WithContext(ctx), job); err != nil {
+		logger.ErrorCtx(ctx, "error queueing %s job: %v", job.Kind, err)
+		return errors.New(http.StatusInternalServerError, "error queueing job")
+	}
+	return nil
+}
+
+// ClaimJobs picks up to limit due jobs of the given kinds, oldest first, and
+// locks them until lockUntil so no other runner takes them meanwhile. Jobs
+// whose runner died are claimed again once their lock expires. Claiming
+// counts as an attempt.
+func (r *JobRepositoryImpl) ClaimJobs(ctx context.Context, kinds []string, limit int, lockUntil time.Time) ([]models.Job, error) {
+	var jobs []models.Job
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_until = @lock_until, updated_at = now()
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE kind IN @kinds AND (
+				(status = 'pending' AND run_at <= now()) OR
+				(status = 'running' AND locked_until < now())
+			)
+			ORDER BY run_at
+			LIMIT @limit
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		map[string]any{"kinds": kinds, "limit": limit, "lock_until": lockUntil},
+	).Scan(&jobs).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error claiming jobs: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error claiming jobs")
+	}
+	return jobs, nil
+}
+
+func (r *JobRepositoryImpl) CompleteJob(ctx context.Context, job *models.Job) error {
+	return r.finishJob(ctx, job, map[string]any{
+		"status":      models.JobSucceeded,
+		"last_error":  "",
+		"finished_at": time.Now(),
+	})
+}
+
+// RetryJobAt puts a failed job back in the queue until runAt.
+func (r *JobRepositoryImpl) RetryJobAt(ctx context.Context, job *models.Job, runAt time.Time, reason string) error {
+	return r.finishJob(ctx, job, map[string]any{
+		"status":     models.JobPending,
+		"run_at":     runAt,
+		"last_error": reason,
+	})
+}
+
+// BuryJob moves a failed job to the dead letters, it is not run again
+// unless requeued.
+func (r *JobRepositoryImpl) BuryJob(ctx context.Context, job *models.Job, reason string) error {
+	return r.finishJob(ctx, job, map[string]any{
+		"status":      models.JobDead,
+		"last_error":  reason,
+		"finished_at": time.Now(),
+	})
+}
+
+// finishJob releases a claimed job. The attempt count fences it: when the
+// lock expired and another runner claimed the job again, the outcome of the
+// late attempt is dropped.
+func (r *JobRepositoryImpl) finishJob(ctx context.Context, job *models.Job, updates map[string]any) error {
+	updates["locked_until"] = nil
+	updates["updated_at"] = time.Now()
+	result := r.db.WithContext(ctx).Model(&models.Job{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, models.JobRunning, job.Attempts).
+		Updates(updates)
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error saving job %s: %v", job.ID, result.Error)
+		return errors.New(http.StatusInternalServerError, "error saving job")
+	}
+	if result.RowsAffected == 0 {
+		logger.WarnCtx(ctx, "job %s was claimed again before attempt %d finished", job.ID, job.Attempts)
+	}
+	return nil
+}
+
+// ListJobs returns the jobs matching the filter, latest first.
+func (r *JobRepositoryImpl) ListJobs(ctx context.Context, filter models.JobFilter) ([]models.Job, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.Job{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.ErrorCtx(ctx, "error counting jobs: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing jobs")
+	}
+
+	var jobs []models.Job
+	limit, offset := paginate(filter.Page, filter.PageSize)
+	if err := query.Order("created_at DESC, id").Limit(limit).Offset(offset).Find(&jobs).Error; err != nil {
+		logger.ErrorCtx(ctx, "error listing jobs: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing jobs")
+	}
+	return jobs, total, nil
+}
+
+// RequeueJob runs a dead job again right away, with a fresh set of
+// attempts.
+func (r *JobRepositoryImpl) RequeueJob(ctx context.Context, id string) (*models.Job, error) {
+	var job models.Job
+	var conflict bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&job, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if job.Status != models.JobDead {
+			conflict = true
+			return nil
+		}
+		job.Status = models.JobPending
+		job.Attempts = 0
+		job.RunAt = time.Now()
+		job.FinishedAt = nil
+		return tx.Model(&job).Select("status", "attempts", "run_at", "finished_at", "updated_at").Updates(&job).Error
+	})
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NewNotFound("job")
+		}
+		logger.ErrorCtx(ctx, "error requeueing job: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error requeueing job")
+	}
+	if conflict {
+		return nil, errors.New(http.StatusConflict, "only dead jobs can be retried, job is "+string(job.Status))
+	}
+	return &job, nil
+}
+
+// PurgeJobsBefore forgets the jobs that succeeded before the given time.
+// Dead jobs are kept until they are retried.
+func (r *JobRepositoryImpl) PurgeJobsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("status = ? AND finished_at < ?", models.JobSucceeded, before).
+		Delete(&models.Job{})
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error purging jobs: %v", result.Error)
+		return 0, errors.New(http.StatusInternalServerError, "error purging jobs")
+	}
+	return result.RowsAffected, nil
+}
+
+// enqueueJob inserts the job with tx. Called inside the transaction making a
+// change, the job only runs if the change is committed. A job whose unique
+// key is already queued is dropped, job.ID stays empty then.
+func enqueueJob(tx *gorm.DB, job *models.Job) error {
+	if job.Status == "" {
+		job.Status = models.JobPending
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "unique_key"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "unique_key IS NOT NULL"}}},
+		DoNothing:   true,
+	}).Create(job).Error
+}
@@ -0,0 +1,453 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LedgerRepository manages ledgers, their members and invitations.
+type LedgerRepository interface {
+	PersonalLedger(ctx context.Context, userID string) (*models.Ledger, error)
+	GetMembership(ctx context.Context, ledgerID, userID string) (*models.LedgerMember, error)
+	ListLedgers(ctx context.Context, userID string) ([]models.Ledger, error)
+	GetLedger(ctx context.Context, scope models.LedgerScope) (*models.Ledger, error)
+	CreateLedger(ctx context.Context, userID, name string) (*models.Ledger, error)
+	RenameLedger(ctx context.Context, ledgerID, name string) error
+	DeleteLedger(ctx context.Context, ledgerID string) error
+	ListMembers(ctx context.Context, ledgerID string) ([]models.LedgerMember, error)
+	SetMemberRole(ctx context.Context, ledgerID, userID string, role models.LedgerRole) error
+	RemoveMember(ctx context.Context, ledgerID, userID string) error
+	CreateInvitation(ctx context.Context, invitation *models.LedgerInvitation) error
+	IssueInvitationToken(ctx context.Context, id, tokenHash string) (*models.LedgerInvitation, string, error)
+	ListInvitations(ctx context.Context, ledgerID string) ([]models.LedgerInvitation, error)
+	RevokeInvitation(ctx context.Context, ledgerID, id string) error
+	RespondToInvitation(ctx context.Context, tokenHash, userID, email string, accept bool) (*models.LedgerInvitation, error)
+}
+
+// errLastOwner stops a change that would leave a ledger without an owner.
+var errLastOwner = stderrors.New("ledger must keep at least one owner")
+
+type LedgerRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &LedgerRepositoryImpl{db: db}
+}
+
+// PersonalLedger returns the personal ledger of the user, creating it on
+// first use.
+func (r *LedgerRepositoryImpl) PersonalLedger(ctx context.Context, userID string) (*models.Ledger, error) {
+	var ledger models.Ledger
+	err := r.db.WithContext(ctx).First(&ledger, "personal_user_id = ?", userID).Error
+	if err == nil {
+		return &ledger, nil
+	}
+	if !stderrors.Is(err, gorm.ErrRecordNotFound) {
+		logger.ErrorCtx(ctx, "error fetching personal ledger: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error fetching ledger")
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Two first requests can race, the unique personal_user_id lets one win
+		ledger = models.Ledger{Name: "Personal", PersonalUserID: &userID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ledger).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&ledger, "personal_user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		member := models.LedgerMember{LedgerID: ledger.ID, UserID: userID, Role: models.LedgerOwner}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error
+	})
+	if err != nil {
+		logger.ErrorCtx(ctx, "error creating personal ledger: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error creating ledger")
+	}
+	return &ledger, nil
+}
+
+func (r *LedgerRepositoryImpl) GetMembership(ctx context.Context, ledgerID, userID string) (*models.LedgerMember, error) {
+	var member models.LedgerMember
+	err := r.db.WithContext(ctx).First(&member, "ledger_id = ? AND user_id = ?", ledgerID, userID).Error
+	if err != nil {
+		return nil, ledgerError(ctx, "fetching", err)
+	}
+	return &member, nil
+}
+
+func (r *LedgerRepositoryImpl) ListLedgers(ctx context.Context, userID string) ([]models.Ledger, error) {
+	var ledgers []models.Ledger
+	err := r.withRole(ctx, userID).Order("ledgers.personal_user_id IS NULL, ledgers.name, ledgers.id").Find(&ledgers).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error listing ledgers: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error listing ledgers")
+	}
+	return ledgers, nil
+}
+
+func (r *LedgerRepositoryImpl) GetLedger(ctx context.Context, scope models.LedgerScope) (*models.Ledger, error) {
+	var ledger models.Ledger
+	if err := r.withRole(ctx, scope.UserID).First(&ledger, "ledgers.id = ?", scope.LedgerID).Error; err != nil {
+		return nil, ledgerError(ctx, "fetching", err)
+	}
+	return &ledger, nil
+}
+
+// withRole selects the ledgers the user is a member of with the role they
+// have in each.
+func (r *LedgerRepositoryImpl) withRole(ctx context.Context, userID string) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&models.Ledger{}).
+		Select("ledgers.*, ledger_members.role").
+		Joins("JOIN ledger_members ON ledger_members.ledger_id = ledgers.id AND ledger_members.user_id = ?", userID)
+}
+
+func (r *LedgerRepositoryImpl) CreateLedger(ctx context.Context, userID, name string) (*models.Ledger, error) {
+	ledger := &models.Ledger{Name: name}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(ledger).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.LedgerMember{LedgerID: ledger.ID, UserID: userID, Role: models.LedgerOwner}).Error
+	})
+	if err != nil {
+		logger.ErrorCtx(ctx, "error creating ledger: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error creating ledger")
+	}
+	ledger.Role = models.LedgerOwner
+	return ledger, nil
+}
+
+func (r *LedgerRepositoryImpl) RenameLedger(ctx context.Context, ledgerID, name string) error {
+	result := r.db.WithContext(ctx).Model(&models.Ledger{}).Where("id = ?", ledgerID).Update("name", name)
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error renaming ledger: %v", result.Error)
+		return errors.New(http.StatusInternalServerError, "error renaming ledger")
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("ledger")
+	}
+	return nil
+}
+
+// DeleteLedger deletes a shared ledger with its records, personal ledgers
+// cannot be deleted.
+func (r *LedgerRepositoryImpl) DeleteLedger(ctx context.Context, ledgerID string) error {
+	var ledger models.Ledger
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ledger, "id = ?", ledgerID).Error; err != nil {
+			return err
+		}
+		if ledger.PersonalUserID != nil {
+			return nil
+		}
+		return tx.Delete(&ledger).Error
+	})
+	if err != nil {
+		return ledgerError(ctx, "deleting", err)
+	}
+	if ledger.PersonalUserID != nil {
+		return errors.NewBadRequest("personal ledgers cannot be deleted")
+	}
+	return nil
+}
+
+func (r *LedgerRepositoryImpl) ListMembers(ctx context.Context, ledgerID string) ([]models.LedgerMember, error) {
+	var members []models.LedgerMember
+	err := r.db.WithContext(ctx).Model(&models.LedgerMember{}).
+		Select("ledger_members.*, users.name, users.email").
+		Joins("JOIN users ON users.id = ledger_members.user_id").
+		Where("ledger_members.ledger_id = ?", ledgerID).
+		Order("ledger_members.created_at, ledger_members.user_id").
+		Find(&members).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error listing ledger members: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error listing members")
+	}
+	return members, nil
+}
+
+func (r *LedgerRepositoryImpl) SetMemberRole(ctx context.Context, ledgerID, userID string, role models.LedgerRole) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		member, err := lockMember(tx, ledgerID, userID)
+		if err != nil {
+			return err
+		}
+		if member.Role == models.LedgerOwner && role != models.LedgerOwner {
+			if err := ensureAnotherOwner(tx, ledgerID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.LedgerMember{}).Where("ledger_id = ? AND user_id = ?", ledgerID, userID).Update("role", role).Error
+	})
+	if err != nil {
+		return ledgerError(ctx, "updating", err)
+	}
+	return nil
+}
+
+// RemoveMember takes the user out of the ledger, the records they created
+// stay in it.
+func (r *LedgerRepositoryImpl) RemoveMember(ctx context.Context, ledgerID, userID string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		member, err := lockMember(tx, ledgerID, userID)
+		if err != nil {
+			return err
+		}
+		if member.Role == models.LedgerOwner {
+			if err := ensureAnotherOwner(tx, ledgerID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Where("ledger_id = ? AND user_id = ?", ledgerID, userID).Delete(&models.LedgerMember{}).Error
+	})
+	if err != nil {
+		return ledgerError(ctx, "removing", err)
+	}
+	return nil
+}
+
+func lockMember(tx *gorm.DB, ledgerID, userID string) (*models.LedgerMember, error) {
+	// Lock every member row, two owners demoting each other at once must not
+	// both succeed
+	var members []models.LedgerMember
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("ledger_id = ?", ledgerID).Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range members {
+		if members[i].UserID == userID {
+			return &members[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func ensureAnotherOwner(tx *gorm.DB, ledgerID, userID string) error {
+	var owners int64
+	err := tx.Model(&models.LedgerMember{}).
+		Where("ledger_id = ? AND user_id <> ? AND role = ?", ledgerID, userID, models.LedgerOwner).
+		Count(&owners).Error
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+// CreateInvitation stores a pending invitation, an email can only have one
+// pending invitation per ledger. The job sending its email is queued with
+// it.
+func (r *LedgerRepositoryImpl) CreateInvitation(ctx context.Context, invitation *models.LedgerInvitation) error {
+	var conflict string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Serialize invitations to the ledger with its row lock
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Ledger{}, "id = ?", invitation.LedgerID).Error; err != nil {
+			return err
+		}
+		var members int64
+		err := tx.Model(&models.LedgerMember{}).
+			Joins("JOIN users ON users.id = ledger_members.user_id").
+			Where("ledger_members.ledger_id = ? AND lower(users.email) = lower(?)", invitation.LedgerID, invitation.Email).
+			Count(&members).Error
+		if err != nil {
+			return err
+		}
+		if members > 0 {
+			conflict = "user is already a member of the ledger"
+			return nil
+		}
+		var pending int64
+		err = tx.Model(&models.LedgerInvitation{}).
+			Where("ledger_id = ? AND lower(email) = lower(?) AND status = ? AND expires_at > ?",
+				invitation.LedgerID, invitation.Email, models.InvitationPending, time.Now()).
+			Count(&pending).Error
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			conflict = "an invitation is already pending for this email"
+			return nil
+		}
+		if err := tx.Create(invitation).Error; err != nil {
+			return err
+		}
+		job, err := models.NewJob(models.JobInvitationEmail, models.InvitationEmailJob{InvitationID: invitation.ID})
+		if err != nil {
+			return err
+		}
+		return enqueueJob(tx, job)
+	})
+	if err != nil {
+		return ledgerError(ctx, "inviting to", err)
+	}
+	if conflict != "" {
+		return errors.New(http.StatusConflict, conflict)
+	}
+	return nil
+}
+
+// IssueInvitationToken replaces the token of a pending invitation, tokens
+// sent before stop working. It returns the invitation with the name of its
+// ledger, or not found once the invitation was answered, revoked or expired.
+func (r *LedgerRepositoryImpl) IssueInvitationToken(ctx context.Context, id, tokenHash string) (*models.LedgerInvitation, string, error) {
+	var invitation models.LedgerInvitation
+	var ledger models.Ledger
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&invitation).Clauses(clause.Returning{}).
+			Where("id = ? AND status = ? AND expires_at > ?", id, models.InvitationPending, time.Now()).
+			Update("token_hash", tokenHash)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Select("name").First(&ledger, "id = ?", invitation.LedgerID).Error
+	})
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", errors.NewNotFound("invitation")
+		}
+		logger.ErrorCtx(ctx, "error issuing invitation token: %v", err)
+		return nil, "", errors.New(http.StatusInternalServerError, "error issuing invitation token")
+	}
+	return &invitation, ledger.Name, nil
+}
+
+func (r *LedgerRepositoryImpl) ListInvitations(ctx context.Context, ledgerID string) ([]models.LedgerInvitation, error) {
+	var invitations []models.LedgerInvitation
+	err := r.db.WithContext(ctx).Where("ledger_id = ?", ledgerID).Order("created_at DESC").Find(&invitations).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error listing invitations: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error listing invitations")
+	}
+	return invitations, nil
+}
+
+func (r *LedgerRepositoryImpl) RevokeInvitation(ctx context.Context, ledgerID, id string) error {
+	result := r.db.WithContext(ctx).Model(&models.LedgerInvitation{}).
+		Where("id = ? AND ledger_id = ? AND status = ?", id, ledgerID, models.InvitationPending).
+		Updates(map[string]any{"status": models.InvitationRevoked, "responded_at": time.Now()})
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error revoking invitation: %v", result.Error)
+		return errors.New(http.StatusInternalServerError, "error revoking invitation")
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("invitation")
+	}
+	return nil
+}
+
+// RespondToInvitation accepts or declines the invitation with the token. It
+// must have been sent to the email of the user answering it.
+func (r *LedgerRepositoryImpl) RespondToInvitation(
+	ctx context.Context,
+	tokenHash, userID, email string,
+	accept bool,
+) (*models.LedgerInvitation, error) {
+	var invitation models.LedgerInvitation
+	var appErr *errors.AppError
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invitation, "token_hash = ?", tokenHash).Error
+		if err != nil {
+			return err
+		}
+		switch {
+		case !strings.EqualFold(invitation.Email, email):
+			// Do not tell whether the token exists
+			return gorm.ErrRecordNotFound
+		case invitation.Status != models.InvitationPending:
+			appErr = errors.New(http.StatusConflict, "invitation was already "+string(invitation.Status))
+			return nil
+		case invitation.ExpiresAt.Before(time.Now()):
+			appErr = errors.New(http.StatusGone, "invitation has expired")
+			return nil
+		}
+
+		now := time.Now()
+		invitation.Status = models.InvitationDeclined
+		if accept {
+			invitation.Status = models.InvitationAccepted
+			member := models.LedgerMember{LedgerID: invitation.LedgerID, UserID: userID, Role: invitation.Role}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+				return err
+			}
+		}
+		invitation.RespondedAt = &now
+		return tx.Model(&invitation).Updates(map[string]any{"status": invitation.Status, "responded_at": now}).Error
+	})
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NewNotFound("invitation")
+		}
+		logger.ErrorCtx(ctx, "error answering invitation: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error answering invitation")
+	}
+	if appErr != nil {
+		return nil, appErr
+	}
+	return &invitation, nil
+}
+
+// ledgerError maps a failed ledger query to an AppError.
+func ledgerError(ctx context.Context, operation string, err error) error {
+	switch {
+	case stderrors.Is(err, gorm.ErrRecordNotFound):
+		return errors.NewNotFound("ledger")
+	case stderrors.Is(err, errLastOwner):
+		return errors.New(http.StatusConflict, errLastOwner.Error())
+	}
+	logger.ErrorCtx(ctx, "error %s ledger: %v", operation, err)
+	return errors.New(http.StatusInternalServerError, "error "+operation+" ledger")
+}
+
+// readRoles and writeRoles are the member roles allowed to read and change
+// the records of a ledger.
+var (
+	readRoles  = []models.LedgerRole{models.LedgerOwner, models.LedgerEditor, models.LedgerViewer}
+	writeRoles = []models.LedgerRole{models.LedgerOwner, models.LedgerEditor}
+)
+
+// errNotLedgerWriter stops record changes by users who cannot write to the
+// ledger of the actor.
+var errNotLedgerWriter = stderrors.New("not allowed to change the records of this ledger")
+
+// inLedger scopes a query on table to the ledger of the scope, and only
+// while the user is a member of it.
+func inLedger(table string, scope models.LedgerScope) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
+			table+".ledger_id = ? AND EXISTS (SELECT 1 FROM ledger_members WHERE ledger_members.ledger_id = "+table+
+				".ledger_id AND ledger_members.user_id = ? AND ledger_members.role IN ?)",
+			scope.LedgerID, scope.UserID, readRoles,
+		)
+	}
+}
+
+// checkWriter fails with errNotLedgerWriter unless the actor may change the
+// records of their ledger.
+func checkWriter(tx *gorm.DB, actor models.RecordActor) error {
+	var count int64
+	err := tx.Model(&models.LedgerMember{}).
+		Where("ledger_id = ? AND user_id = ? AND role IN ?", actor.LedgerID, actor.UserID, writeRoles).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errNotLedgerWriter
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptStore persists failed login counters. The in-memory store suits
+// a single instance, the Postgres store shares counters between instances.
+type LoginAttemptStore interface {
+	GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// RecordFailure increments the counter for key, restarting from one when
+	// the previous failure happened before windowStart.
+	RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (*models.LoginAttempt, error)
+	LockUntil(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+// memoryStoreSweepSize is the number of tracked keys above which stale
+// entries are dropped, so the map cannot grow without bound.
+const memoryStoreSweepSize = 10000
+
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() LoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: map[string]models.LoginAttempt{}}
+}
+
+func (s *MemoryLoginAttemptStore) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.attempts) >= memoryStoreSweepSize {
+		s.sweep(now, windowStart)
+	}
+	attempt, ok := s.attempts[key]
+	if !ok || attempt.LastFailureAt.Before(windowStart) {
+		attempt = models.LoginAttempt{Key: key}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	s.attempts[key] = attempt
+	return &attempt, nil
+}
+
+// sweep must be called with s.mu held.
+func (s *MemoryLoginAttemptStore) sweep(now, windowStart time.Time) {
+	for key, attempt := range s.attempts {
+		locked := attempt.LockedUntil != nil && attempt.LockedUntil.After(now)
+		if !locked && attempt.LastFailureAt.Before(windowStart) {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+func (s *MemoryLoginAttemptStore) LockUntil(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt := s.attempts[key]
+	attempt.Key = key
+	attempt.LockedUntil = &until
+	s.attempts[key] = attempt
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) ResetLoginAttempts(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+type PostgresLoginAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresLoginAttemptStore(db *gorm.DB) LoginAttemptStore {
+	return &PostgresLoginAttemptStore{db: db}
+}
+
+func (s *PostgresLoginAttemptStore) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	attempt := &models.LoginAttempt{}
+	result := s.db.WithContext(ctx).Where("key = ?", key).First(attempt)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		logger.ErrorCtx(ctx, "error fetching login attempt: %v", result.Error)
+		return nil, errors.New(http.StatusInternalServerError, "error fetching login attempt")
+	}
+	return attempt, nil
+}
+
+func (s *PostgresLoginAttemptStore) RecordFailure(ctx context.Context, key string, now, windowStart time.Time) (*models.LoginAttempt, error) {
+	attempt := &models.LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+	// Single upsert so concurrent instances never lose an increment
+	result := s.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "failures"}, Value: gorm.Expr(
+					"CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END", windowStart,
+				)},
+				{Column: clause.Column{Name: "last_failure_at"}, Value: now},
+			},
+		},
+		clause.Returning{},
+	).Create(attempt)
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error recording login failure: %v", result.Error)
+		return nil, errors.New(http.StatusInternalServerError, "error recording login failure")
+	}
+	return attempt, nil
+}
+
+func (s *PostgresLoginAttemptStore) LockUntil(ctx context.Context, key string, until time.Time) error {
+	result := s.db.WithContext(ctx).Model(&models.LoginAttempt{}).Where("key = ?", key).Update("locked_until", until)
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error locking login key: %v", result.Error)
+		return errors.New(http.StatusInternalServerError, "error locking login key")
+	}
+	return nil
+}
+
+func (s *PostgresLoginAttemptStore) ResetLoginAttempts(ctx context.Context, key string) error {
+	result := s.db.WithContext(ctx).Where("key = ?", key).Delete(&models.LoginAttempt{})
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error resetting login attempts: %v", result.Error)
+		return errors.New(http.StatusInternalServerError, "error resetting login attempts")
+	}
+	return nil
+}
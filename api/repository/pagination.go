@@ -0,0 +1,9 @@
+package repository
+
+import "github.com/aq-simei/coin-pilot/api/models"
+
+// paginate turns 1-based page parameters into a limit and offset.
+func paginate(page, pageSize int) (int, int) {
+	page, pageSize = models.NormalizePage(page, pageSize)
+	return pageSize, (page - 1) * pageSize
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimitStore holds token buckets. The in-memory store suits a single
+// instance, the Postgres store shares buckets between instances.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit models.RateLimit, now time.Time) (models.RateLimitResult, error)
+	// DeleteIdle deletes the buckets last used before cutoff. Callers pick a
+	// cutoff after which every bucket is full, so nothing is lost.
+	DeleteIdle(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// takeToken refills the bucket for the time elapsed since its last update and
+// takes one token from it when available.
+func takeToken(bucket *models.RateLimitBucket, limit models.RateLimit, now time.Time) models.RateLimitResult {
+	capacity := float64(limit.Requests)
+	rate := limit.RefillRate()
+
+	elapsed := now.Sub(bucket.UpdatedAt).Seconds()
+	if elapsed > 0 {
+		bucket.Tokens = math.Min(capacity, bucket.Tokens+elapsed*rate)
+	}
+	bucket.UpdatedAt = now
+
+	result := models.RateLimitResult{Limit: limit.Requests}
+	if bucket.Tokens >= 1 {
+		bucket.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - bucket.Tokens) / rate)
+	}
+	result.Remaining = int(math.Floor(bucket.Tokens))
+	result.Reset = secondsToDuration((capacity - bucket.Tokens) / rate)
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// memoryBucketSweepSize is the number of buckets above which full buckets are
+// dropped, so the map cannot grow without bound.
+const memoryBucketSweepSize = 10000
+
+type memoryBucket struct {
+	bucket models.RateLimitBucket
+	fullAt time.Time
+}
+
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit models.RateLimit, now time.Time) (models.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= memoryBucketSweepSize {
+			s.sweep(now)
+		}
+		entry = &memoryBucket{bucket: models.RateLimitBucket{Key: key, Tokens: float64(limit.Requests), UpdatedAt: now}}
+		s.buckets[key] = entry
+	}
+
+	result := takeToken(&entry.bucket, limit, now)
+	entry.fullAt = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep must be called with s.mu held. A full bucket is identical to a
+// missing one, so dropping it loses nothing.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, entry := range s.buckets {
+		if !entry.fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func (s *MemoryRateLimitStore) DeleteIdle(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, entry := range s.buckets {
+		if entry.bucket.UpdatedAt.Before(cutoff) {
+			delete(s.buckets, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type PostgresRateLimitStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresRateLimitStore(db *gorm.DB) RateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, limit models.RateLimit, now time.Time) (models.RateLimitResult, error) {
+	var result models.RateLimitResult
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		bucket := &models.RateLimitBucket{Key: key, Tokens: float64(limit.Requests), UpdatedAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(bucket).Error; err != nil {
+			return err
+		}
+		// Row lock serializes concurrent takes on the same key across instances
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(bucket, "key = ?", key).Error; err != nil {
+			return err
+		}
+		result = takeToken(bucket, limit, now)
+		return tx.Model(bucket).Updates(map[string]any{
+			"tokens":     bucket.Tokens,
+			"updated_at": bucket.UpdatedAt,
+		}).Error
+	})
+	if err != nil {
+		logger.ErrorCtx(ctx, "error taking rate limit token: %v", err)
+		return models.RateLimitResult{}, errors.New(http.StatusInternalServerError, "error taking rate limit token")
+	}
+	return result, nil
+}
+
+func (s *PostgresRateLimitStore) DeleteIdle(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("updated_at < ?", cutoff).Delete(&models.RateLimitBucket{})
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error deleting idle rate limit buckets: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
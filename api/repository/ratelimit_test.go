@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+func TestTakeToken(t *testing.T) {
+	limit := models.RateLimit{Requests: 10, Period: 10 * time.Second}
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		want       models.RateLimitResult
+		wantTokens float64
+	}{
+		{"full bucket", 10, 0, models.RateLimitResult{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second}, 9},
+		{"empty bucket", 0, 0, models.RateLimitResult{Limit: 10, RetryAfter: time.Second, Reset: 10 * time.Second}, 0},
+		{"half a token refilled", 0, 500 * time.Millisecond, models.RateLimitResult{Limit: 10, RetryAfter: 500 * time.Millisecond, Reset: 9500 * time.Millisecond}, 0.5},
+		{"three tokens refilled", 0, 3 * time.Second, models.RateLimitResult{Allowed: true, Limit: 10, Remaining: 2, Reset: 8 * time.Second}, 2},
+		{"refill stops at capacity", 5, time.Hour, models.RateLimitResult{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second}, 9},
+		{"clock going backwards refills nothing", 2, -5 * time.Second, models.RateLimitResult{Allowed: true, Limit: 10, Remaining: 1, Reset: 9 * time.Second}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := &models.RateLimitBucket{Key: "k", Tokens: tt.tokens, UpdatedAt: start}
+			now := start.Add(tt.elapsed)
+			got := takeToken(bucket, limit, now)
+			if got != tt.want {
+				t.Fatalf("takeToken = %+v, want %+v", got, tt.want)
+			}
+			if bucket.Tokens != tt.wantTokens || !bucket.UpdatedAt.Equal(now) {
+				t.Fatalf("bucket = %+v, want %v tokens updated at %s", bucket, tt.wantTokens, now)
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStoreRefills(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRateLimitStore()
+	limit := models.RateLimit{Requests: 2, Period: 2 * time.Second}
+	start := time.Now()
+	steps := []struct {
+		at      time.Duration
+		allowed bool
+	}{
+		{0, true},
+		{0, true},
+		{0, false},
+		{500 * time.Millisecond, false},
+		{time.Second, true},
+		{time.Second, false},
+		{10 * time.Second, true},
+		{10 * time.Second, true},
+		{10 * time.Second, false},
+	}
+	for i, step := range steps {
+		result, err := store.Take(ctx, "k", limit, start.Add(step.at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != step.allowed {
+			t.Fatalf("take %d at +%s allowed = %v, want %v", i, step.at, result.Allowed, step.allowed)
+		}
+	}
+}
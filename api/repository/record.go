@@ -1,15 +1,49 @@
 package repository
 
 import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// RecordRepository changes records and writes their history in the same
+// transaction, so every committed change has its history entry. Queries are
+// scoped to a ledger the user is a member of, changes also need a role that
+// can write to it.
 type RecordRepository interface {
-	GetRecords(userID string) ([]models.Record, error)
-	CreateRecord(record models.CreateRecordPayload, userID string) (*models.CreateRecordPayload, error)
-	UpdateRecord(id string, record models.Record) (*models.Record, error)
-	DeleteRecord(id string) error
+	GetRecords(ctx context.Context, scope models.LedgerScope) ([]models.Record, error)
+	GetRecord(ctx context.Context, scope models.LedgerScope, id string) (*models.Record, error)
+	CreateRecord(ctx context.Context, actor models.RecordActor, record models.CreateRecordPayload) (*models.Record, error)
+	UpdateRecord(ctx context.Context, actor models.RecordActor, id string, version int64, record models.UpdateRecordPayload) (*models.Record, error)
+	DeleteRecord(ctx context.Context, actor models.RecordActor, id string) error
+	ListTrash(ctx context.Context, scope models.LedgerScope, filter models.TrashFilter) ([]models.Record, int64, error)
+	RestoreRecord(ctx context.Context, actor models.RecordActor, id string) error
+	PurgeRecord(ctx context.Context, actor models.RecordActor, id string) error
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	ListRecordHistory(ctx context.Context, scope models.LedgerScope, recordID string, filter models.RecordHistoryFilter) ([]models.RecordHistory, int64, error)
+	ListChanges(ctx context.Context, scope models.LedgerScope, cursor models.SyncCursor, limit int) ([]models.SyncChange, models.SyncCursor, bool, error)
+	ApplySyncUploads(ctx context.Context, actor models.RecordActor, uploads []models.SyncUpload, strategy models.SyncStrategy) ([]models.SyncUploadResult, error)
+	PurgeTombstonesBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	ApplyBulk(ctx context.Context, actor models.RecordActor, operations []models.BulkOperation, mode models.BulkMode) ([]models.BulkResult, error)
+	PatchMatching(ctx context.Context, actor models.RecordActor, filter models.BulkFilter, patch models.RecordPatch, mode models.BulkMode) ([]models.BulkResult, error)
+}
+
+// RecordVersionConflictError is the cause of the 412 returned when a record
+// changed since the client read it, it carries the current record.
+type RecordVersionConflictError struct {
+	Current models.Record
+}
+
+func (e *RecordVersionConflictError) Error() string {
+	return fmt.Sprintf("record %s is at version %d", e.Current.ID, e.Current.Version)
 }
 
 type RecordRepositoryImpl struct {
@@ -20,56 +54,365 @@ func NewRecordRepository(db *gorm.DB) RecordRepository {
 	return &RecordRepositoryImpl{db: db}
 }
 
-func (r *RecordRepositoryImpl) GetRecords(userID string) ([]models.Record, error) {
+func (r *RecordRepositoryImpl) GetRecords(ctx context.Context, scope models.LedgerScope) ([]models.Record, error) {
 	var records []models.Record
-	result := r.db.Where("user_id = ?", userID).Find(&records)
+	result := r.db.WithContext(ctx).Scopes(inLedger("records", scope)).Find(&records)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	return records, nil
 }
 
-func (r *RecordRepositoryImpl) CreateRecord(record models.CreateRecordPayload, userID string) (*models.CreateRecordPayload, error) {
+func (r *RecordRepositoryImpl) GetRecord(ctx context.Context, scope models.LedgerScope, id string) (*models.Record, error) {
+	var record models.Record
+	if err := r.db.WithContext(ctx).Scopes(inLedger("records", scope)).First(&record, "id = ?", id).Error; err != nil {
+		return nil, recordError(ctx, "getting", err)
+	}
+	return &record, nil
+}
+
+func (r *RecordRepositoryImpl) CreateRecord(ctx context.Context, actor models.RecordActor, record models.CreateRecordPayload) (*models.Record, error) {
+	var newRecord *models.Record
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) (err error) {
+		if err := checkWriter(tx, actor); err != nil {
+			return err
+		}
+		newRecord, err = createRecord(tx, actor, "", record)
+		return err
+	})
+	if err != nil {
+		return nil, recordError(ctx, "creating", err)
+	}
+	return newRecord, nil
+}
+
+// UpdateRecord replaces the record if it is still at version, a version of 0
+// updates whatever version is current.
+func (r *RecordRepositoryImpl) UpdateRecord(
+	ctx context.Context,
+	actor models.RecordActor,
+	id string,
+	version int64,
+	record models.UpdateRecordPayload,
+) (*models.Record, error) {
+	var updatedRecord *models.Record
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) (err error) {
+		if err := checkWriter(tx, actor); err != nil {
+			return err
+		}
+		updatedRecord, err = updateRecord(tx, actor, id, version, record)
+		return err
+	})
+	if err != nil {
+		return nil, updateError(ctx, err)
+	}
+	return updatedRecord, nil
+}
+
+// DeleteRecord moves the record to the trash, it stays restorable until
+// purged.
+func (r *RecordRepositoryImpl) DeleteRecord(ctx context.Context, actor models.RecordActor, id string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkWriter(tx, actor); err != nil {
+			return err
+		}
+		_, err := deleteRecord(tx, actor, id)
+		return err
+	})
+	if err != nil {
+		return recordError(ctx, "deleting", err)
+	}
+	return nil
+}
+
+func (r *RecordRepositoryImpl) ListTrash(
+	ctx context.Context,
+	scope models.LedgerScope,
+	filter models.TrashFilter,
+) ([]models.Record, int64, error) {
+	query := r.db.WithContext(ctx).Unscoped().Model(&models.Record{}).Scopes(inLedger("records", scope)).
+		Where("deleted_at IS NOT NULL")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.ErrorCtx(ctx, "error counting trashed records: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing trash")
+	}
+
+	var records []models.Record
+	limit, offset := paginate(filter.Page, filter.PageSize)
+	if err := query.Order("deleted_at DESC").Limit(limit).Offset(offset).Find(&records).Error; err != nil {
+		logger.ErrorCtx(ctx, "error listing trashed records: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing trash")
+	}
+	return records, total, nil
+}
+
+func (r *RecordRepositoryImpl) RestoreRecord(ctx context.Context, actor models.RecordActor, id string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkWriter(tx, actor); err != nil {
+			return err
+		}
+		record, err := lockTrashedRecord(tx, actor.Scope(), id)
+		if err != nil {
+			return err
+		}
+		before := *record
+		if err := tx.Unscoped().Model(record).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		record.DeletedAt = gorm.DeletedAt{}
+		return writeHistory(tx, actor, models.HistoryRestore, &before, record)
+	})
+	if err != nil {
+		return recordError(ctx, "restoring", err)
+	}
+	return nil
+}
+
+// PurgeRecord permanently deletes a record, only records already in the
+// trash can be purged.
+func (r *RecordRepositoryImpl) PurgeRecord(ctx context.Context, actor models.RecordActor, id string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkWriter(tx, actor); err != nil {
+			return err
+		}
+		record, err := lockTrashedRecord(tx, actor.Scope(), id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(record).Error; err != nil {
+			return err
+		}
+		return writeHistory(tx, actor, models.HistoryPurge, record, nil)
+	})
+	if err != nil {
+		return recordError(ctx, "purging", err)
+	}
+	return nil
+}
+
+// PurgeDeletedBefore permanently deletes every record trashed before cutoff.
+func (r *RecordRepositoryImpl) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	var purged []models.Record
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Clauses(clause.Returning{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Delete(&purged)
+		if result.Error != nil {
+			return result.Error
+		}
+		for i := range purged {
+			actor := models.RecordActor{
+				UserID:   purged[i].UserID,
+				LedgerID: purged[i].LedgerID,
+				Type:     models.ActorSystem,
+				Source:   models.SourceRetention,
+			}
+			if err := writeHistory(tx, actor, models.HistoryPurge, &purged[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.ErrorCtx(ctx, "error purging trash: %v", err)
+		return 0, err
+	}
+	return int64(len(purged)), nil
+}
+
+func (r *RecordRepositoryImpl) ListRecordHistory(
+	ctx context.Context,
+	scope models.LedgerScope,
+	recordID string,
+	filter models.RecordHistoryFilter,
+) ([]models.RecordHistory, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.RecordHistory{}).Scopes(inLedger("record_history", scope)).
+		Where("record_id = ?", recordID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.ErrorCtx(ctx, "error counting record history: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing record history")
+	}
+	if total == 0 {
+		return nil, 0, errors.NewNotFound("record")
+	}
+
+	var entries []models.RecordHistory
+	limit, offset := paginate(filter.Page, filter.PageSize)
+	if err := query.Order("created_at DESC, id").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		logger.ErrorCtx(ctx, "error listing record history: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing record history")
+	}
+	return entries, total, nil
+}
+
+// createRecord inserts the record, with a client generated id when one is
+// given.
+func createRecord(tx *gorm.DB, actor models.RecordActor, id string, record models.CreateRecordPayload) (*models.Record, error) {
 	// Map the CreateRecordPayload to a Record
 	newRecord := &models.Record{
+		ID:          id,
 		Name:        record.Name,
 		Date:        record.Date,
 		Description: record.Description,
 		Tags:        record.Tags,
 		Type:        record.Type,
 		Amount:      record.Amount,
-		UserID:      userID,
+		UserID:      actor.UserID,
+		LedgerID:    actor.LedgerID,
+	}
+	if err := tx.Create(newRecord).Error; err != nil {
+		return nil, err
+	}
+	return newRecord, writeHistory(tx, actor, models.HistoryCreate, nil, newRecord)
+}
+
+func updateRecord(
+	tx *gorm.DB,
+	actor models.RecordActor,
+	id string,
+	version int64,
+	record models.UpdateRecordPayload,
+) (*models.Record, error) {
+	existingRecord, err := lockRecord(tx, actor.Scope(), id)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && existingRecord.Version != version {
+		return nil, &RecordVersionConflictError{Current: *existingRecord}
+	}
+	before := *existingRecord
+	setRecordFields(existingRecord, record)
+	return existingRecord, saveRecord(tx, actor, &before, existingRecord)
+}
+
+// setRecordFields updates the existing record with new values.
+func setRecordFields(existingRecord *models.Record, record models.UpdateRecordPayload) {
+	existingRecord.Name = record.Name
+	existingRecord.Description = record.Description
+	existingRecord.Date = record.Date
+	existingRecord.Tags = record.Tags
+	existingRecord.Type = record.Type
+	existingRecord.Amount = record.Amount
+}
+
+// saveRecord stores the changes made to a record read with lockRecord and
+// bumps its version.
+func saveRecord(tx *gorm.DB, actor models.RecordActor, before, record *models.Record) error {
+	record.Version++
+	if err := tx.Omit(clause.Associations).Save(record).Error; err != nil {
+		return err
+	}
+	return writeHistory(tx, actor, models.HistoryUpdate, before, record)
+}
+
+func deleteRecord(tx *gorm.DB, actor models.RecordActor, id string) (*models.Record, error) {
+	record, err := lockRecord(tx, actor.Scope(), id)
+	if err != nil {
+		return nil, err
+	}
+	before := *record
+	if err := tx.Delete(record).Error; err != nil {
+		return nil, err
+	}
+	// Delete does not fill DeletedAt on the struct
+	if err := tx.Unscoped().First(record, "id = ?", id).Error; err != nil {
+		return nil, err
 	}
-	result := r.db.Create(newRecord)
+	return record, writeHistory(tx, actor, models.HistoryDelete, &before, record)
+}
+
+func lockRecord(tx *gorm.DB, scope models.LedgerScope, id string) (*models.Record, error) {
+	var record models.Record
+	result := tx.Scopes(inLedger("records", scope)).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&record, "id = ?", id)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	return &record, nil
 }
 
-func (r *RecordRepositoryImpl) UpdateRecord(id string, record models.Record) (*models.Record, error) {
-	existingRecord := &models.Record{}
-	result := r.db.First(existingRecord, "id = ?", id)
+func lockTrashedRecord(tx *gorm.DB, scope models.LedgerScope, id string) (*models.Record, error) {
+	var record models.Record
+	result := tx.Unscoped().Scopes(inLedger("records", scope)).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&record, "id = ? AND deleted_at IS NOT NULL", id)
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	return &record, nil
+}
 
-	// Update the existing record with new values
-	existingRecord.Type = record.Type
-	existingRecord.Amount = record.Amount
-	existingRecord.Description = record.Description
+// writeHistory appends the change to record_history, before or after is nil
+// when the record did not exist on that side of the change. Webhooks
+// subscribed to the change are queued along with it.
+func writeHistory(tx *gorm.DB, actor models.RecordActor, action models.HistoryAction, before, after *models.Record) error {
+	entry := models.RecordHistory{
+		UserID:    actor.UserID,
+		Action:    action,
+		ActorType: actor.Type,
+		ActorID:   actor.ID,
+		Source:    actor.Source,
+	}
+	for _, side := range []struct {
+		record *models.Record
+		target *models.JSONDocument
+	}{{before, &entry.Before}, {after, &entry.After}} {
+		if side.record == nil {
+			continue
+		}
+		entry.RecordID = side.record.ID
+		entry.LedgerID = side.record.LedgerID
+		snapshot, err := side.record.Snapshot()
+		if err != nil {
+			return err
+		}
+		*side.target = snapshot
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
 
-	if err := r.db.Save(existingRecord).Error; err != nil {
-		return nil, err
+	event, ok := historyEvents[action]
+	if !ok {
+		return nil
 	}
+	data := models.RecordEventData{
+		Record: entry.After,
+		Actor:  models.EventActor{UserID: actor.UserID, Type: actor.Type, Source: actor.Source},
+	}
+	return enqueueWebhookEvent(tx, entry.LedgerID, event, data)
+}
 
-	return existingRecord, nil
+// historyEvents are the webhook events sent for record changes, purges are
+// not sent.
+var historyEvents = map[models.HistoryAction]string{
+	models.HistoryCreate:  models.EventRecordCreated,
+	models.HistoryUpdate:  models.EventRecordUpdated,
+	models.HistoryDelete:  models.EventRecordDeleted,
+	models.HistoryRestore: models.EventRecordRestored,
 }
 
-func (r *RecordRepositoryImpl) DeleteRecord(id string) error {
-	result := r.db.Delete(&models.Record{}, "id = ?", id)
-	if result.Error != nil {
-		return result.Error
+// updateError maps a failed update to an AppError, a version conflict keeps
+// the current record as its cause.
+func updateError(ctx context.Context, err error) error {
+	var conflict *RecordVersionConflictError
+	if stderrors.As(err, &conflict) {
+		return errors.Wrap(http.StatusPreconditionFailed, "record was modified, reload it and try again", conflict)
 	}
-	return nil
+	return recordError(ctx, "updating", err)
+}
+
+// recordError maps a failed record transaction to an AppError.
+func recordError(ctx context.Context, operation string, err error) error {
+	switch {
+	case stderrors.Is(err, gorm.ErrRecordNotFound):
+		return errors.NewNotFound("record")
+	case stderrors.Is(err, errNotLedgerWriter):
+		return errors.New(http.StatusForbidden, errNotLedgerWriter.Error())
+	}
+	logger.ErrorCtx(ctx, "error %s record: %v", operation, err)
+	return errors.New(http.StatusInternalServerError, "error "+operation+" record")
 }
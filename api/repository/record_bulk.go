@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+)
+
+// errBulkRolledBack aborts the transaction of an atomic bulk request.
+var errBulkRolledBack = stderrors.New("bulk request rolled back")
+
+// ApplyBulk runs the operations in one transaction, each in a savepoint. In
+// atomic mode the first failure rolls everything back, in best-effort mode
+// only the failed operation is undone.
+func (r *RecordRepositoryImpl) ApplyBulk(
+	ctx context.Context,
+	actor models.RecordActor,
+	operations []models.BulkOperation,
+	mode models.BulkMode,
+) ([]models.BulkResult, error) {
+	return r.runBulk(ctx, actor, mode, len(operations), func(tx *gorm.DB, i int) (models.BulkResult, error) {
+		op := operations[i]
+		result := models.BulkResult{Index: i, Op: op.Op, ID: op.ID, Status: http.StatusOK}
+		var err error
+		switch op.Op {
+		case models.BulkCreate:
+			result.Record, err = createRecord(tx, actor, "", *op.Record)
+			result.Status = http.StatusCreated
+		case models.BulkUpdate:
+			result.Record, err = updateRecord(tx, actor, op.ID, op.Version, models.UpdateRecordPayload(*op.Record))
+		case models.BulkDelete:
+			_, err = deleteRecord(tx, actor, op.ID)
+		default:
+			err = fmt.Errorf("unknown bulk operation %q", op.Op)
+		}
+		if result.Record != nil {
+			result.ID = result.Record.ID
+		}
+		return result, err
+	})
+}
+
+// PatchMatching applies the patch to every record matching the filter, up
+// to models.MaxBulkItems of them.
+func (r *RecordRepositoryImpl) PatchMatching(
+	ctx context.Context,
+	actor models.RecordActor,
+	filter models.BulkFilter,
+	patch models.RecordPatch,
+	mode models.BulkMode,
+) ([]models.BulkResult, error) {
+	query := r.db.WithContext(ctx).Model(&models.Record{}).Scopes(inLedger("records", actor.Scope()))
+	if len(filter.IDs) > 0 {
+		query = query.Where("id IN ?", filter.IDs)
+	}
+	if filter.Tag != "" {
+		query = query.Where("? = ANY(tags)", filter.Tag)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.From != nil {
+		query = query.Where("date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("date <= ?", *filter.To)
+	}
+	if filter.Search != "" {
+		query = query.Where("name ILIKE ?", "%"+filter.Search+"%")
+	}
+
+	var ids []string
+	if err := query.Order("date, id").Limit(models.MaxBulkItems+1).Pluck("id", &ids).Error; err != nil {
+		logger.ErrorCtx(ctx, "error matching records for bulk patch: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error matching records")
+	}
+	if len(ids) > models.MaxBulkItems {
+		return nil, errors.NewBadRequest(fmt.Sprintf("filter matches more than %d records, narrow it down", models.MaxBulkItems))
+	}
+
+	return r.runBulk(ctx, actor, mode, len(ids), func(tx *gorm.DB, i int) (models.BulkResult, error) {
+		result := models.BulkResult{Index: i, Op: models.BulkUpdate, ID: ids[i], Status: http.StatusOK}
+		record, err := lockRecord(tx, actor.Scope(), ids[i])
+		if err != nil {
+			return result, err
+		}
+		before := *record
+		if patch.Apply(record) {
+			if err := saveRecord(tx, actor, &before, record); err != nil {
+				return result, err
+			}
+		}
+		result.Record = record
+		return result, nil
+	})
+}
+
+func (r *RecordRepositoryImpl) runBulk(
+	ctx context.Context,
+	actor models.RecordActor,
+	mode models.BulkMode,
+	count int,
+	apply func(tx *gorm.DB, i int) (models.BulkResult, error),
+) ([]models.BulkResult, error) {
+	results := make([]models.BulkResult, 0, count)
+	failed := -1
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkWriter(tx, actor); err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			var result models.BulkResult
+			// The nested transaction is a savepoint, a failure only undoes
+			// this operation
+			err := tx.Transaction(func(savepoint *gorm.DB) (err error) {
+				result, err = apply(savepoint, i)
+				return err
+			})
+			if err != nil {
+				result = bulkFailure(ctx, result, err)
+				if mode == models.BulkAtomic {
+					failed = len(results)
+					results = append(results, result)
+					return errBulkRolledBack
+				}
+			}
+			results = append(results, result)
+		}
+		if actor.Source == models.SourceImport {
+			return enqueueImportCompleted(tx, actor, mode, results)
+		}
+		return nil
+	})
+	if stderrors.Is(err, errBulkRolledBack) && results[failed].Status != http.StatusInternalServerError {
+		for i := range results {
+			if i != failed {
+				results[i].Status = http.StatusFailedDependency
+				results[i].Record = nil
+				results[i].Error = "rolled back"
+			}
+		}
+		return results, errors.New(http.StatusUnprocessableEntity,
+			fmt.Sprintf("operation %d failed: %s", results[failed].Index, results[failed].Error))
+	}
+	if stderrors.Is(err, errNotLedgerWriter) {
+		return nil, errors.New(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		logger.ErrorCtx(ctx, "error applying bulk request: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error applying bulk request")
+	}
+	return results, nil
+}
+
+// bulkFailure fills the status and error of a failed operation the way the
+// single endpoint would have reported them.
+func bulkFailure(ctx context.Context, result models.BulkResult, err error) models.BulkResult {
+	result.Record = nil
+	var conflict *RecordVersionConflictError
+	switch {
+	case stderrors.Is(err, gorm.ErrRecordNotFound):
+		result.Status = http.StatusNotFound
+		result.Error = "record not found"
+	case stderrors.As(err, &conflict):
+		result.Status = http.StatusPreconditionFailed
+		result.Error = "record was modified, reload it and try again"
+		result.Record = &conflict.Current
+	default:
+		logger.ErrorCtx(ctx, "bulk operation %d failed: %v", result.Index, err)
+		result.Status = http.StatusInternalServerError
+		result.Error = "internal error"
+	}
+	return result
+}
+
+// enqueueImportCompleted queues the import.completed webhook event of a
+// bulk request marked as an import.
+func enqueueImportCompleted(tx *gorm.DB, actor models.RecordActor, mode models.BulkMode, results []models.BulkResult) error {
+	data := models.ImportEventData{
+		Mode:  mode,
+		Actor: models.EventActor{UserID: actor.UserID, Type: actor.Type, Source: actor.Source},
+	}
+	for _, result := range results {
+		if result.Status >= http.StatusBadRequest {
+			data.Failed++
+		} else {
+			data.Succeeded++
+		}
+	}
+	return enqueueWebhookEvent(tx, actor.LedgerID, models.EventImportCompleted, data)
+}
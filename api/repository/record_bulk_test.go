@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/testdb"
+	"gorm.io/gorm"
+)
+
+// newBulkActor creates a user with a personal ledger holding one record, and
+// returns the user acting in that ledger along with the record.
+func newBulkActor(t *testing.T, db *gorm.DB) (models.RecordActor, *models.Record) {
+	t.Helper()
+	ctx := context.Background()
+	user := &models.User{Name: "Bulk", Email: testdb.Email("bulk"), Password: "hash"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	ledger, err := NewLedgerRepository(db).PersonalLedger(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actor := models.RecordActor{UserID: user.ID, LedgerID: ledger.ID, Type: models.ActorUser, ID: user.ID, Source: models.SourceAPI}
+
+	results, err := NewRecordRepository(db).ApplyBulk(ctx, actor, []models.BulkOperation{{Op: models.BulkCreate, Record: bulkPayload("Existing")}}, models.BulkAtomic)
+	if err != nil {
+		t.Fatalf("creating the existing record: %v", err)
+	}
+	return actor, results[0].Record
+}
+
+func bulkPayload(name string) *models.CreateRecordPayload {
+	return &models.CreateRecordPayload{Name: name, Date: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), Type: models.TypeExpense, Amount: 100}
+}
+
+func TestApplyBulkSavepoints(t *testing.T) {
+	db := testdb.Open(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		mode         models.BulkMode
+		wantStatuses []int
+		wantErr      int
+		// wantNames are the records of the ledger afterwards
+		wantNames []string
+	}{
+		{
+			name:         "best effort keeps the operations around a failure",
+			mode:         models.BulkBestEffort,
+			wantStatuses: []int{http.StatusCreated, http.StatusPreconditionFailed, http.StatusNotFound, http.StatusOK, http.StatusCreated},
+			wantNames:    []string{"After", "Before", "Renamed"},
+		},
+		{
+			name:         "atomic rolls back everything at the first failure",
+			mode:         models.BulkAtomic,
+			wantStatuses: []int{http.StatusFailedDependency, http.StatusPreconditionFailed},
+			wantErr:      http.StatusUnprocessableEntity,
+			wantNames:    []string{"Existing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actor, existing := newBulkActor(t, db)
+			operations := []models.BulkOperation{
+				{Op: models.BulkCreate, Record: bulkPayload("Before")},
+				{Op: models.BulkUpdate, ID: existing.ID, Version: existing.Version + 1, Record: bulkPayload("Stale")},
+				{Op: models.BulkDelete, ID: "00000000-0000-0000-0000-000000000000"},
+				{Op: models.BulkUpdate, ID: existing.ID, Version: existing.Version, Record: bulkPayload("Renamed")},
+				{Op: models.BulkCreate, Record: bulkPayload("After")},
+			}
+
+			results, err := NewRecordRepository(db).ApplyBulk(ctx, actor, operations, tt.mode)
+			if tt.wantErr != 0 {
+				appErr, ok := errors.IsAppError(err)
+				if !ok || appErr.Code != tt.wantErr {
+					t.Fatalf("ApplyBulk err = %v, want %d", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("ApplyBulk: %v", err)
+			}
+			statuses := make([]int, len(results))
+			for i, result := range results {
+				statuses[i] = result.Status
+			}
+			if !slices.Equal(statuses, tt.wantStatuses) {
+				t.Fatalf("statuses = %v, want %v", statuses, tt.wantStatuses)
+			}
+
+			var names []string
+			err = db.Model(&models.Record{}).Where("ledger_id = ?", actor.LedgerID).Order("name").Pluck("name", &names).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(names, tt.wantNames) {
+				t.Fatalf("ledger holds %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestApplyBulkRequiresWriter(t *testing.T) {
+	db := testdb.Open(t)
+	actor, _ := newBulkActor(t, db)
+	other, _ := newBulkActor(t, db)
+	actor.LedgerID = other.LedgerID
+
+	_, err := NewRecordRepository(db).ApplyBulk(context.Background(), actor, []models.BulkOperation{{Op: models.BulkCreate, Record: bulkPayload("Intruder")}}, models.BulkBestEffort)
+	appErr, ok := errors.IsAppError(err)
+	if !ok || appErr.Code != http.StatusForbidden {
+		t.Fatalf("ApplyBulk in another ledger err = %v, want 403", err)
+	}
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// changedRecord is a row of the changes feed, a live or trashed record or
+// the tombstone of a purged one.
+type changedRecord struct {
+	ID        string
+	SyncXid   string
+	DeletedAt *time.Time
+	Purged    bool
+}
+
+// ListChanges returns up to limit records changed after the cursor, ordered
+// by the transaction that changed them, and the cursor to continue from. A
+// change committing late can be returned twice, never missed.
+func (r *RecordRepositoryImpl) ListChanges(
+	ctx context.Context,
+	scope models.LedgerScope,
+	cursor models.SyncCursor,
+	limit int,
+) ([]models.SyncChange, models.SyncCursor, bool, error) {
+	db := r.db.WithContext(ctx)
+	if cursor.Xid == "" {
+		cursor.Xid = "0"
+	}
+	if cursor.Watermark == "" {
+		// Every transaction older than the watermark has finished, later
+		// ones are looked at again by the next round
+		err := db.Raw("SELECT pg_snapshot_xmin(pg_current_snapshot())::text").Row().Scan(&cursor.Watermark)
+		if err != nil {
+			logger.ErrorCtx(ctx, "error reading sync watermark: %v", err)
+			return nil, cursor, false, errors.New(http.StatusInternalServerError, "error listing changes")
+		}
+		cursor.RoundStart = time.Now()
+	}
+
+	// A first sync only needs the records that still exist
+	full := cursor.Since.IsZero()
+	query := `
+		SELECT id, sync_xid::text AS sync_xid, deleted_at, purged FROM (
+			SELECT id, sync_xid, deleted_at, false AS purged FROM records
+			WHERE ledger_id = @ledger AND (sync_xid, id) > (@xid::xid8, @id)`
+	if full {
+		query += ` AND deleted_at IS NULL`
+	} else {
+		query += `
+			UNION ALL
+			SELECT record_id, sync_xid, deleted_at, true FROM record_tombstones
+			WHERE ledger_id = @ledger AND (sync_xid, record_id) > (@xid::xid8, @id)`
+	}
+	query += `
+		) changes
+		WHERE EXISTS (SELECT 1 FROM ledger_members WHERE ledger_id = @ledger AND user_id = @user)
+		ORDER BY changes.sync_xid, changes.id LIMIT @limit`
+
+	var rows []changedRecord
+	err := db.Raw(query, map[string]any{
+		"ledger": scope.LedgerID,
+		"user":   scope.UserID,
+		"xid":    cursor.Xid,
+		"id":     cursor.ID,
+		"limit":  limit + 1,
+	}).Scan(&rows).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error listing changes: %v", err)
+		return nil, cursor, false, errors.New(http.StatusInternalServerError, "error listing changes")
+	}
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	var liveIDs []string
+	for _, row := range rows {
+		if !row.Purged && row.DeletedAt == nil {
+			liveIDs = append(liveIDs, row.ID)
+		}
+	}
+	records := map[string]*models.Record{}
+	if len(liveIDs) > 0 {
+		var found []models.Record
+		if err := db.Scopes(inLedger("records", scope)).Where("id IN ?", liveIDs).Find(&found).Error; err != nil {
+			logger.ErrorCtx(ctx, "error loading changed records: %v", err)
+			return nil, cursor, false, errors.New(http.StatusInternalServerError, "error listing changes")
+		}
+		for i := range found {
+			records[found[i].ID] = &found[i]
+		}
+	}
+
+	changes := make([]models.SyncChange, 0, len(rows))
+	for _, row := range rows {
+		record, live := records[row.ID]
+		switch {
+		case live && (full || record.CreatedAt.After(cursor.Since)):
+			changes = append(changes, models.SyncChange{Type: models.SyncCreated, ID: row.ID, Record: record})
+		case live:
+			changes = append(changes, models.SyncChange{Type: models.SyncUpdated, ID: row.ID, Record: record})
+		case row.DeletedAt != nil:
+			changes = append(changes, models.SyncChange{Type: models.SyncDeleted, ID: row.ID, DeletedAt: row.DeletedAt})
+		}
+		// A record deleted between both queries shows up in the next round
+	}
+
+	if hasMore {
+		last := rows[len(rows)-1]
+		cursor.Xid, cursor.ID = last.SyncXid, last.ID
+		return changes, cursor, true, nil
+	}
+	return changes, models.SyncCursor{Since: cursor.RoundStart, Xid: cursor.Watermark}, false, nil
+}
+
+// ApplySyncUploads applies changes made offline, each in its own savepoint
+// so one failure does not undo the others.
+func (r *RecordRepositoryImpl) ApplySyncUploads(
+	ctx context.Context,
+	actor models.RecordActor,
+	uploads []models.SyncUpload,
+	strategy models.SyncStrategy,
+) ([]models.SyncUploadResult, error) {
+	results := make([]models.SyncUploadResult, 0, len(uploads))
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkWriter(tx, actor); err != nil {
+			return err
+		}
+		for _, upload := range uploads {
+			var result models.SyncUploadResult
+			err := tx.Transaction(func(savepoint *gorm.DB) (err error) {
+				result, err = applySyncUpload(savepoint, actor, upload, strategy)
+				return err
+			})
+			if err != nil {
+				logger.ErrorCtx(ctx, "sync upload of record %s failed: %v", upload.ID, err)
+				result = models.SyncUploadResult{ID: upload.ID, Status: models.SyncFailed, Error: "internal error"}
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		if stderrors.Is(err, errNotLedgerWriter) {
+			return nil, errors.New(http.StatusForbidden, err.Error())
+		}
+		logger.ErrorCtx(ctx, "error applying sync uploads: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error applying changes")
+	}
+	return results, nil
+}
+
+func applySyncUpload(
+	tx *gorm.DB,
+	actor models.RecordActor,
+	upload models.SyncUpload,
+	strategy models.SyncStrategy,
+) (models.SyncUploadResult, error) {
+	result := models.SyncUploadResult{ID: upload.ID, Status: models.SyncApplied}
+
+	var existing models.Record
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&existing, "id = ?", upload.ID).Error
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		if upload.Deleted {
+			// Created and deleted offline, or already purged here
+			return result, nil
+		}
+		result.Record, err = createRecord(tx, actor, upload.ID, *upload.Record)
+		return result, err
+	}
+	if err != nil {
+		return result, err
+	}
+	if existing.LedgerID != actor.LedgerID {
+		result.Status = models.SyncFailed
+		result.Error = "id is already used by another record"
+		return result, nil
+	}
+
+	trashed := existing.DeletedAt.Valid
+	if upload.Deleted && trashed {
+		return result, nil
+	}
+	if upload.BaseVersion != existing.Version || trashed {
+		// Changed on the server since the client last synced
+		serverChangedAt := existing.UpdatedAt
+		if trashed {
+			serverChangedAt = existing.DeletedAt.Time
+		}
+		if strategy == models.SyncReportConflicts {
+			result.Status = models.SyncConflict
+			result.Record = &existing
+			return result, nil
+		}
+		if !upload.UpdatedAt.After(serverChangedAt) {
+			result.Status = models.SyncStale
+			result.Record = &existing
+			return result, nil
+		}
+	}
+
+	if upload.Deleted {
+		_, err := deleteRecord(tx, actor, upload.ID)
+		return result, err
+	}
+	if trashed {
+		before := existing
+		if err := tx.Unscoped().Model(&existing).Update("deleted_at", nil).Error; err != nil {
+			return result, err
+		}
+		existing.DeletedAt = gorm.DeletedAt{}
+		if err := writeHistory(tx, actor, models.HistoryRestore, &before, &existing); err != nil {
+			return result, err
+		}
+	}
+	before := existing
+	setRecordFields(&existing, models.UpdateRecordPayload(*upload.Record))
+	result.Record = &existing
+	return result, saveRecord(tx, actor, &before, &existing)
+}
+
+// PurgeTombstonesBefore forgets purged records deleted before cutoff, sync
+// tokens older than that must start over with a full sync.
+func (r *RecordRepositoryImpl) PurgeTombstonesBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Exec("DELETE FROM record_tombstones WHERE deleted_at < ?", cutoff)
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error purging record tombstones: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -15,8 +15,11 @@ type UserRepository interface {
 	GetUser(ctx context.Context, id string) (*models.User, error)
 	CreateUser(ctx context.Context, userPayload models.CreateUserPayload) error
 	UpdateUser(ctx context.Context, id string, userPayload models.UpdateUserPayload) error
-	DeleteUser(ctx context.Context, id string) error
+	// DeleteUser deletes the user, actor is who deletes the account.
+	DeleteUser(ctx context.Context, actor models.RecordActor, id string) error
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	SearchUsers(ctx context.Context, filter models.UserFilter) ([]models.User, int64, error)
+	SetUserStatus(ctx context.Context, id string, status models.UserStatus) error
 }
 
 type UserRepositoryImpl struct {
@@ -31,12 +34,12 @@ func (r *UserRepositoryImpl) GetUser(
 	ctx context.Context,
 	id string,
 ) (*models.User, error) {
-	logger.Info("Fetching user with ID: %s", id)
+	logger.DebugCtx(ctx, "Fetching user with ID: %s", id)
 	user := &models.User{}
 	// Use Preload to include the Records field in the result
-	result := r.db.First(user, "id = ?", id)
+	result := r.db.WithContext(ctx).First(user, "id = ?", id)
 	if result.Error != nil {
-		logger.Error("error fetching user: %v", result.Error)
+		logger.ErrorCtx(ctx, "error fetching user: %v", result.Error)
 		if result.Error == gorm.ErrRecordNotFound {
 			return nil, errors.New(http.StatusNotFound, "user not found")
 		}
@@ -51,7 +54,7 @@ func (r *UserRepositoryImpl) CreateUser(
 ) error {
 	hashedPassword, err := security.HashPassword(userPayload.Password)
 	if err != nil {
-		logger.Error("error hashing password: %v", err)
+		logger.ErrorCtx(ctx, "error hashing password: %v", err)
 		return errors.New(http.StatusInternalServerError, "error hashing password")
 	}
 	user := &models.User{
@@ -62,19 +65,19 @@ func (r *UserRepositoryImpl) CreateUser(
 
 	// Check if user already exists
 	existingUser := &models.User{}
-	result := r.db.Where("email = ?", user.Email).First(existingUser)
+	result := r.db.WithContext(ctx).Where("email = ?", user.Email).First(existingUser)
 	if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
-		logger.Error("error checking existing user: %v", result.Error)
+		logger.ErrorCtx(ctx, "error checking existing user: %v", result.Error)
 		return errors.New(http.StatusInternalServerError, "error checking existing user")
 	}
 	if result.Error == nil {
-		logger.Error("attempt to create a user with an existing email: %v", user.Email)
+		logger.ErrorCtx(ctx, "attempt to create a user with an existing email: %v", user.Email)
 		return errors.New(http.StatusConflict, "user already exists")
 	}
 
 	// Create the user
-	if err := r.db.Create(user).Error; err != nil {
-		logger.Error("error creating user: %v", err)
+	if err := r.db.WithContext(ctx).Create(user).Error; err != nil {
+		logger.ErrorCtx(ctx, "error creating user: %v", err)
 		return errors.New(http.StatusInternalServerError, "error creating user")
 	}
 
@@ -94,11 +97,16 @@ func (r *UserRepositoryImpl) UpdateUser(
 	}
 	if userPayload.Email != nil {
 		updateData["email"] = *userPayload.Email
+		// A new email has not been verified, the old one stays verified
+		updateData["email_verified_at"] = gorm.Expr("CASE WHEN email = ? THEN email_verified_at END", *userPayload.Email)
+	}
+	if userPayload.Role != nil {
+		updateData["role"] = *userPayload.Role
 	}
 	if userPayload.Password != nil {
 		hashedPassword, err := security.HashPassword(*userPayload.Password)
 		if err != nil {
-			logger.Error("error hashing password: %v", err)
+			logger.ErrorCtx(ctx, "error hashing password: %v", err)
 			return errors.New(http.StatusInternalServerError, "error hashing password")
 		}
 		updateData["password"] = hashedPassword
@@ -106,18 +114,18 @@ func (r *UserRepositoryImpl) UpdateUser(
 
 	// Check for existing user with the same email (if email is being updated)
 	if email, ok := updateData["email"]; ok {
-		existingUserWithSameEmail := r.db.First(&models.User{}, "email = ? AND id != ?", email, id)
+		existingUserWithSameEmail := r.db.WithContext(ctx).First(&models.User{}, "email = ? AND id != ?", email, id)
 		if existingUserWithSameEmail.Error != nil && existingUserWithSameEmail.Error != gorm.ErrRecordNotFound {
 			return errors.NewInternal("error checking existing user with same email")
 		}
 		if existingUserWithSameEmail.Error == nil {
-			logger.Error("attempt to update a user with an existing email: %v", email)
+			logger.ErrorCtx(ctx, "attempt to update a user with an existing email: %v", email)
 			return errors.New(http.StatusConflict, "invalid email")
 		}
 	}
 
 	// Perform the update
-	result := r.db.Model(&models.User{}).Where("id = ?", id).Updates(updateData)
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(updateData)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -127,21 +135,53 @@ func (r *UserRepositoryImpl) UpdateUser(
 	return nil
 }
 
-func (r *UserRepositoryImpl) DeleteUser(ctx context.Context, id string) error {
-	result := r.db.Where("id = ?", id).Delete(&models.User{})
-	if result.Error != nil {
-		logger.Error("error deleting user: %v", result.Error)
+// DeleteUser deletes the user and moves the records of their personal
+// ledger to the trash, each with a history entry of the actor. Records of
+// shared ledgers stay with the ledger.
+func (r *UserRepositoryImpl) DeleteUser(ctx context.Context, actor models.RecordActor, id string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ledgerIDs []string
+		if err := tx.Model(&models.Ledger{}).Where("personal_user_id = ?", id).Pluck("id", &ledgerIDs).Error; err != nil {
+			return err
+		}
+		for _, ledgerID := range ledgerIDs {
+			var recordIDs []string
+			if err := tx.Model(&models.Record{}).Where("ledger_id = ?", ledgerID).Order("id").Pluck("id", &recordIDs).Error; err != nil {
+				return err
+			}
+			// The owner of the ledger is the member the records are deleted as
+			owner := actor
+			owner.UserID = id
+			owner.LedgerID = ledgerID
+			for _, recordID := range recordIDs {
+				if _, err := deleteRecord(tx, owner, recordID); err != nil {
+					return err
+				}
+			}
+		}
+
+		result := tx.Where("id = ?", id).Delete(&models.User{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.NewNotFound("user_not_found")
+		}
+		logger.ErrorCtx(ctx, "error deleting user: %v", err)
 		return errors.New(http.StatusInternalServerError, "error deleting user")
 	}
-	if result.RowsAffected == 0 {
-		return errors.NewNotFound("user_not_found")
-	}
 	return nil
 }
 
 func (r *UserRepositoryImpl) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	user := &models.User{}
-	result := r.db.Where("email = ?", email).First(user)
+	result := r.db.WithContext(ctx).Where("email = ?", email).First(user)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			return nil, errors.New(http.StatusNotFound, "user not found")
@@ -150,3 +190,46 @@ func (r *UserRepositoryImpl) GetUserByEmail(ctx context.Context, email string) (
 	}
 	return user, nil
 }
+
+func (r *UserRepositoryImpl) SearchUsers(
+	ctx context.Context,
+	filter models.UserFilter,
+) ([]models.User, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.User{})
+	if filter.Query != "" {
+		pattern := "%" + filter.Query + "%"
+		query = query.Where("name ILIKE ? OR email ILIKE ?", pattern, pattern)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.ErrorCtx(ctx, "error counting users: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error searching users")
+	}
+
+	var users []models.User
+	limit, offset := paginate(filter.Page, filter.PageSize)
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		logger.ErrorCtx(ctx, "error searching users: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error searching users")
+	}
+	return users, total, nil
+}
+
+func (r *UserRepositoryImpl) SetUserStatus(ctx context.Context, id string, status models.UserStatus) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("status", status)
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error updating user status: %v", result.Error)
+		return errors.New(http.StatusInternalServerError, "error updating user status")
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("user")
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/internal/testdb"
+)
+
+func TestDeleteUserTrashesPersonalRecords(t *testing.T) {
+	db := testdb.Open(t)
+	owner, record := newBulkActor(t, db)
+	admin := models.RecordActor{Type: models.ActorAdmin, ID: "11111111-1111-1111-1111-111111111111", Source: models.SourceAPI}
+
+	if err := NewUserRepository(db).DeleteUser(context.Background(), admin, owner.UserID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	var trashed models.Record
+	if err := db.Unscoped().First(&trashed, "id = ?", record.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !trashed.DeletedAt.Valid {
+		t.Fatal("the record of the personal ledger was not trashed")
+	}
+	var entry models.RecordHistory
+	if err := db.Where("record_id = ? AND action = ?", record.ID, models.HistoryDelete).First(&entry).Error; err != nil {
+		t.Fatalf("no history of the deletion: %v", err)
+	}
+	if entry.ActorType != models.ActorAdmin || entry.ActorID != admin.ID || entry.UserID != owner.UserID {
+		t.Fatalf("deletion recorded as %s %s for %s, want the admin for the owner", entry.ActorType, entry.ActorID, entry.UserID)
+	}
+
+	if err := NewUserRepository(db).DeleteUser(context.Background(), admin, owner.UserID); err == nil {
+		t.Fatal("deleting the user twice succeeded")
+	}
+}
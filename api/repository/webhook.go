@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+)
+
+// WebhookRepository manages webhooks and the queue of their deliveries.
+// Events are queued by the repositories making the change, in the same
+// transaction, see enqueueWebhookEvent. Each delivery is sent by a job.
+type WebhookRepository interface {
+	ListWebhooks(ctx context.Context, userID string) ([]models.Webhook, error)
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhook(ctx context.Context, userID, id string) (*models.Webhook, error)
+	SaveWebhook(ctx context.Context, webhook *models.Webhook) error
+	DeleteWebhook(ctx context.Context, userID, id string) error
+	ListDeliveries(ctx context.Context, userID, webhookID string, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, int64, error)
+	GetDelivery(ctx context.Context, userID, webhookID, id string) (*models.WebhookDelivery, error)
+	Redeliver(ctx context.Context, userID, webhookID, id string) (*models.WebhookDelivery, error)
+	// GetDeliveryToSend returns the delivery with the URL and secret of its
+	// webhook, whoever owns it.
+	GetDeliveryToSend(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	CompleteDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	PurgeDeliveriesBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type WebhookRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &WebhookRepositoryImpl{db: db}
+}
+
+func (r *WebhookRepositoryImpl) ListWebhooks(ctx context.Context, userID string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&webhooks).Error; err != nil {
+		logger.ErrorCtx(ctx, "error listing webhooks: %v", err)
+		return nil, errors.New(http.StatusInternalServerError, "error listing webhooks")
+	}
+	return webhooks, nil
+}
+
+func (r *WebhookRepositoryImpl) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	if err := r.db.WithContext(ctx).Create(webhook).Error; err != nil {
+		logger.ErrorCtx(ctx, "error creating webhook: %v", err)
+		return errors.New(http.StatusInternalServerError, "error creating webhook")
+	}
+	return nil
+}
+
+func (r *WebhookRepositoryImpl) GetWebhook(ctx context.Context, userID, id string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := r.db.WithContext(ctx).First(&webhook, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, webhookError(ctx, "fetching", "webhook", err)
+	}
+	return &webhook, nil
+}
+
+// SaveWebhook writes every field of a webhook fetched with GetWebhook.
+func (r *WebhookRepositoryImpl) SaveWebhook(ctx context.Context, webhook *models.Webhook) error {
+	result := r.db.WithContext(ctx).Model(webhook).Where("user_id = ?", webhook.UserID).
+		Select("url", "description", "events", "secret", "active", "updated_at").Updates(webhook)
+	if result.Error != nil {
+		return webhookError(ctx, "updating", "webhook", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("webhook")
+	}
+	return nil
+}
+
+// DeleteWebhook deletes the webhook with its delivery log, queued
+// deliveries are dropped.
+func (r *WebhookRepositoryImpl) DeleteWebhook(ctx context.Context, userID, id string) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.Webhook{})
+	if result.Error != nil {
+		return webhookError(ctx, "deleting", "webhook", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.NewNotFound("webhook")
+	}
+	return nil
+}
+
+// ListDeliveries returns the delivery log of a webhook, latest first.
+func (r *WebhookRepositoryImpl) ListDeliveries(
+	ctx context.Context,
+	userID, webhookID string,
+	filter models.WebhookDeliveryFilter,
+) ([]models.WebhookDelivery, int64, error) {
+	if _, err := r.GetWebhook(ctx, userID, webhookID); err != nil {
+		return nil, 0, err
+	}
+	query := r.db.WithContext(ctx).Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Event != "" {
+		query = query.Where("event = ?", filter.Event)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.ErrorCtx(ctx, "error counting webhook deliveries: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing deliveries")
+	}
+
+	var deliveries []models.WebhookDelivery
+	limit, offset := paginate(filter.Page, filter.PageSize)
+	if err := query.Order("created_at DESC, id").Limit(limit).Offset(offset).Find(&deliveries).Error; err != nil {
+		logger.ErrorCtx(ctx, "error listing webhook deliveries: %v", err)
+		return nil, 0, errors.New(http.StatusInternalServerError, "error listing deliveries")
+	}
+	return deliveries, total, nil
+}
+
+func (r *WebhookRepositoryImpl) GetDelivery(ctx context.Context, userID, webhookID, id string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := r.db.WithContext(ctx).Scopes(ofUserWebhook(userID)).
+		First(&delivery, "id = ? AND webhook_id = ?", id, webhookID).Error
+	if err != nil {
+		return nil, webhookError(ctx, "fetching", "delivery", err)
+	}
+	return &delivery, nil
+}
+
+// Redeliver queues the event of a delivery again as a new delivery, sent
+// right away by a new job.
+func (r *WebhookRepositoryImpl) Redeliver(ctx context.Context, userID, webhookID, id string) (*models.WebhookDelivery, error) {
+	original, err := r.GetDelivery(ctx, userID, webhookID, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		WebhookID:     original.WebhookID,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: &now,
+	}
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(delivery).Error; err != nil {
+			return err
+		}
+		return enqueueDeliveryJobs(tx, []string{delivery.ID})
+	})
+	if err != nil {
+		return nil, webhookError(ctx, "creating", "delivery", err)
+	}
+	return delivery, nil
+}
+
+func (r *WebhookRepositoryImpl) GetDeliveryToSend(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := r.db.WithContext(ctx).
+		Select("webhook_deliveries.*, webhooks.url, webhooks.secret, webhooks.active AS webhook_active").
+		Joins("JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id").
+		First(&delivery, "webhook_deliveries.id = ?", id).Error
+	if err != nil {
+		return nil, webhookError(ctx, "fetching", "delivery", err)
+	}
+	return &delivery, nil
+}
+
+// CompleteDelivery stores the outcome of an attempt set on the delivery.
+func (r *WebhookRepositoryImpl) CompleteDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	err := r.db.WithContext(ctx).Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(map[string]any{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"response_status": delivery.ResponseStatus,
+		"error":           delivery.Error,
+		"duration_ms":     delivery.DurationMS,
+		"delivered_at":    delivery.DeliveredAt,
+		"updated_at":      time.Now(),
+	}).Error
+	if err != nil {
+		logger.ErrorCtx(ctx, "error saving webhook delivery: %v", err)
+		return errors.New(http.StatusInternalServerError, "error saving webhook delivery")
+	}
+	return nil
+}
+
+// PurgeDeliveriesBefore forgets the finished deliveries created before the
+// given time.
+func (r *WebhookRepositoryImpl) PurgeDeliveriesBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("status <> ? AND created_at < ?", models.DeliveryPending, before).
+		Delete(&models.WebhookDelivery{})
+	if result.Error != nil {
+		logger.ErrorCtx(ctx, "error purging webhook deliveries: %v", result.Error)
+		return 0, errors.New(http.StatusInternalServerError, "error purging webhook deliveries")
+	}
+	return result.RowsAffected, nil
+}
+
+// enqueueWebhookEvent queues the event for every active webhook subscribed
+// to it whose user is a member of the ledger. Called inside the transaction
+// making the change, the event is only sent if the change is committed.
+func enqueueWebhookEvent(tx *gorm.DB, ledgerID, event string, data any) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var deliveryIDs []string
+	err = tx.Raw(`
+		WITH event AS (SELECT gen_random_uuid() AS id, now() AS created_at)
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, next_attempt_at, created_at, updated_at)
+		SELECT w.id, event.id, @event,
+			jsonb_build_object(
+				'id', event.id,
+				'type', CAST(@event AS text),
+				'created_at', event.created_at,
+				'ledger_id', CAST(@ledger AS text),
+				'data', CAST(@data AS jsonb)
+			),
+			event.created_at, event.created_at, event.created_at
+		FROM webhooks AS w, event
+		WHERE w.active AND @event = ANY(w.events) AND EXISTS (
+			SELECT 1 FROM ledger_members
+			WHERE ledger_members.ledger_id = @ledger AND ledger_members.user_id = w.user_id
+		)
+		RETURNING webhook_deliveries.id`,
+		map[string]any{"event": event, "ledger": ledgerID, "data": string(content)},
+	).Scan(&deliveryIDs).Error
+	if err != nil {
+		return err
+	}
+	return enqueueDeliveryJobs(tx, deliveryIDs)
+}
+
+// enqueueDeliveryJobs queues the job sending each delivery.
+func enqueueDeliveryJobs(tx *gorm.DB, deliveryIDs []string) error {
+	for _, id := range deliveryIDs {
+		job, err := models.NewJob(models.JobWebhookDelivery, models.WebhookDeliveryJob{DeliveryID: id})
+		if err != nil {
+			return err
+		}
+		if err := enqueueJob(tx, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ofUserWebhook scopes deliveries to the webhooks of the user.
+func ofUserWebhook(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)", userID)
+	}
+}
+
+// webhookError maps a failed webhook query to an AppError.
+func webhookError(ctx context.Context, operation, resource string, err error) error {
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.NewNotFound(resource)
+	}
+	logger.ErrorCtx(ctx, "error %s %s: %v", operation, resource, err)
+	return errors.New(http.StatusInternalServerError, "error "+operation+" "+resource)
+}
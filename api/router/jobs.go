@@ -0,0 +1,71 @@
+package router
+
+import (
+	"context"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/api/service"
+	"github.com/aq-simei/coin-pilot/internal/config"
+	"gorm.io/gorm"
+)
+
+// NewJobRunner returns the runner of the background jobs, with the handler
+// of every kind of job, webhook deliveries included, and the periodic
+// purges.
+func NewJobRunner(db *gorm.DB, cfg *config.Config) *service.JobRunner {
+	runner := service.NewJobRunner(repository.NewJobRepository(db), service.NewJobRunnerConfig(cfg.Jobs))
+
+	ledgerService := service.NewLedgerService(repository.NewLedgerRepository(db), repository.NewUserRepository(db), service.LogInvitationMailer{})
+	service.HandleJob(runner, models.JobInvitationEmail, ledgerService.SendInvitationEmail)
+	service.HandleJob(runner, models.JobLockoutEmail, func(ctx context.Context, job models.LockoutEmailJob) error {
+		service.LogLockoutNotifier{}.AccountLocked(ctx, job.Email, job.Until)
+		return nil
+	})
+
+	webhookConfig := service.NewWebhookSenderConfig(cfg.Webhooks)
+	webhookSender := service.NewWebhookSender(repository.NewWebhookRepository(db), webhookConfig)
+	runner.Handle(models.JobWebhookDelivery, webhookSender.Deliver)
+	runner.Retry(models.JobWebhookDelivery, webhookConfig.Retry)
+
+	trashPurger := service.NewTrashPurger(
+		repository.NewRecordRepository(db),
+		time.Duration(cfg.Records.TrashRetention),
+		time.Duration(cfg.Records.TombstoneRetention),
+	)
+	idempotencyPurger := service.NewIdempotencyKeyPurger(repository.NewPostgresIdempotencyStore(db))
+	jobRepository := repository.NewJobRepository(db)
+	identityRepository := repository.NewIdentityRepository(db)
+	type purge struct {
+		kind     string
+		interval config.Duration
+		purge    func(context.Context) error
+	}
+	purges := []purge{
+		{models.JobPurgeTrash, cfg.Records.TrashPurgeInterval, trashPurger.PurgeOnce},
+		{models.JobPurgeIdempotencyKeys, cfg.Idempotency.PurgeInterval, idempotencyPurger.PurgeOnce},
+		{models.JobPurgeWebhookDeliveries, cfg.Webhooks.PurgeInterval, webhookSender.PurgeOnce},
+		{models.JobPurgeJobs, cfg.Jobs.PurgeInterval, func(ctx context.Context) error {
+			_, err := jobRepository.PurgeJobsBefore(ctx, time.Now().Add(-time.Duration(cfg.Jobs.Retention)))
+			return err
+		}},
+		{models.JobPurgePendingLogins, cfg.OIDC.PurgeInterval, func(ctx context.Context) error {
+			_, err := identityRepository.DeleteExpiredPendingLogins(ctx, time.Now())
+			return err
+		}},
+	}
+	// The memory store lives in the process serving the requests and sweeps
+	// itself, only the shared store needs a job
+	if cfg.RateLimit.Store == config.StorePostgres {
+		bucketPurger := service.NewRateLimitBucketPurger(repository.NewPostgresRateLimitStore(db), cfg.RateLimit.LongestPeriod())
+		purges = append(purges, purge{models.JobPurgeRateLimitBuckets, cfg.RateLimit.PurgeInterval, bucketPurger.PurgeOnce})
+	}
+	for _, p := range purges {
+		runner.Handle(p.kind, func(ctx context.Context, _ models.Job) error {
+			return p.purge(ctx)
+		})
+		runner.Every(p.kind, time.Duration(p.interval))
+	}
+	return runner
+}
@@ -1,42 +1,148 @@
 package router
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/aq-simei/coin-pilot/api/controller"
 	"github.com/aq-simei/coin-pilot/api/middlewares"
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/openapi"
 	"github.com/aq-simei/coin-pilot/api/repository"
 	"github.com/aq-simei/coin-pilot/api/service"
+	"github.com/aq-simei/coin-pilot/internal/config"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+	"github.com/aq-simei/coin-pilot/internal/oidc"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func NewRouter(db *gorm.DB) *gin.Engine {
-	router := gin.Default()
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+func NewRouter(db *gorm.DB, cfg *config.Config) *gin.Engine {
+	// Limits are checked by config.Validate, a parse error cannot happen here
+	rateLimit := func(group string) models.RateLimit {
+		limit, _ := cfg.RateLimit.Limit(group)
+		return limit
+	}
+	jwtManager := security.NewJWTManager(cfg.Security.JWTSecret, time.Duration(cfg.Security.JWTTTL))
+
+	var rateLimitStore repository.RateLimitStore
+	if cfg.RateLimit.Store == config.StorePostgres {
+		rateLimitStore = repository.NewPostgresRateLimitStore(db)
+	} else {
+		rateLimitStore = repository.NewMemoryRateLimitStore()
+	}
 
-	r := router.Group("/api/v1")
+	router := gin.New()
+	// Let gin.Context expose the request context values, e.g. the request ID
+	router.ContextWithFallback = true
+	// ClientIP keys rate limits and login lockouts, only proxies we run may
+	// set it through X-Forwarded-For. The list is checked by config.Validate.
+	if err := router.SetTrustedProxies(cfg.App.TrustedProxies); err != nil {
+		logger.Error("invalid trusted proxies: %v", err)
+	}
+	router.Use(middlewares.RequestIDMiddleware())
+	router.Use(middlewares.TracingMiddleware(cfg.Tracing.ServiceName))
+	router.Use(middlewares.MetricsMiddleware())
+	router.Use(middlewares.AccessLogMiddleware())
+	router.Use(gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		logger.ErrorCtx(c.Request.Context(), "panic recovered: %v", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+
+	// Probes, metrics and the docs are not rate limited, only the API is
+	r := router.Group("/api/v1", middlewares.RateLimitMiddleware(rateLimitStore, "global", rateLimit("global")))
 	userHandler := r.Group("/users")
 	recordHandler := r.Group("/records")
+	authHandler := r.Group("/auth")
+	adminHandler := r.Group("/admin")
+	ledgerHandler := r.Group("/ledgers")
+	invitationHandler := r.Group("/invitations")
+	groupHandler := r.Group("/groups")
+	webhookHandler := r.Group("/webhooks")
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "Welcome to the API",
 		})
 	})
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "OK",
-		})
-	})
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
 	userRepository := repository.NewUserRepository(db)
-	userService := service.NewUserService(userRepository)
+	var loginAttemptStore repository.LoginAttemptStore
+	if cfg.Login.AttemptStore == config.StorePostgres {
+		loginAttemptStore = repository.NewPostgresLoginAttemptStore(db)
+	} else {
+		loginAttemptStore = repository.NewMemoryLoginAttemptStore()
+	}
+	jobRepository := repository.NewJobRepository(db)
+	loginGuard := service.NewLoginGuard(loginAttemptStore, service.NewJobLockoutNotifier(jobRepository), service.NewLoginGuardConfig(cfg.Login))
+	userService := service.NewUserService(userRepository, loginGuard, jwtManager)
 	userController := controller.NewUserController(userService)
+	ledgerRepository := repository.NewLedgerRepository(db)
+	ledgerService := service.NewLedgerService(ledgerRepository, userRepository, service.LogInvitationMailer{})
+	ledgerController := controller.NewLedgerController(ledgerService)
 	recordRepository := repository.NewRecordRepository(db)
-	recordService := service.NewRecordService(recordRepository)
+	recordService := service.NewRecordService(recordRepository, time.Duration(cfg.Records.TombstoneRetention))
 	recordController := controller.NewRecordController(recordService)
-	userHandler.Use(middlewares.ApiKeyMiddleware())
-	recordHandler.Use(middlewares.JwtMiddleware())
-	controller.RegisterUserControllerRoutes(userHandler, userController)
+	groupService := service.NewGroupService(repository.NewGroupRepository(db), userRepository, recordRepository)
+	groupController := controller.NewGroupController(groupService)
+	webhookController := controller.NewWebhookController(service.NewWebhookService(repository.NewWebhookRepository(db), cfg.Webhooks.AllowPrivateAddresses))
+	var providers []*oidc.Provider
+	for _, provider := range cfg.OIDC.Providers {
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name:         provider.Name,
+			IssuerURL:    provider.IssuerURL,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+		}, nil))
+	}
+	identityRepository := repository.NewIdentityRepository(db)
+	authService := service.NewAuthService(identityRepository, providers, jwtManager, time.Duration(cfg.OIDC.LoginTTL))
+	authController := controller.NewAuthController(authService)
+	auditRepository := repository.NewAuditRepository(db)
+	adminService := service.NewAdminService(userRepository, auditRepository, jobRepository)
+	adminController := controller.NewAdminController(adminService)
+	apiKeyRepository := repository.NewAPIKeyRepository(db)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepository)
+	apiKeyController := controller.NewAPIKeyController(apiKeyService)
+	idempotency := middlewares.IdempotencyMiddleware(repository.NewPostgresIdempotencyStore(db), time.Duration(cfg.Idempotency.TTL))
+	authRateLimit := middlewares.RateLimitMiddleware(rateLimitStore, "auth", rateLimit("auth"))
+	usersRateLimit := middlewares.RateLimitMiddleware(rateLimitStore, "users", rateLimit("users"))
+	recordHandler.Use(middlewares.JwtOrApiKeyMiddleware(jwtManager, apiKeyService), middlewares.RequireActiveUser(userRepository), middlewares.RateLimitMiddleware(rateLimitStore, "records", rateLimit("records")), idempotency, middlewares.LedgerMiddleware(ledgerRepository))
+	authHandler.Use(authRateLimit)
+	userPublicHandler := userHandler.Group("", authRateLimit)
+	controller.RegisterUserPublicRoutes(userPublicHandler, userController)
+	userSelfHandler := userHandler.Group("", middlewares.JwtMiddleware(jwtManager), middlewares.RequireActiveUser(userRepository), usersRateLimit, idempotency)
+	controller.RegisterUserSelfRoutes(userSelfHandler, userController)
+	controller.RegisterAPIKeyRoutes(userSelfHandler, apiKeyController)
+	userAdminHandler := userHandler.Group("", middlewares.JwtMiddleware(jwtManager), middlewares.RequireActiveUser(userRepository), usersRateLimit, idempotency, middlewares.AuditMiddleware(auditRepository))
+	controller.RegisterUserAdminRoutes(userAdminHandler, userController)
+	adminHandler.Use(middlewares.JwtMiddleware(jwtManager), middlewares.RequireActiveUser(userRepository), middlewares.RateLimitMiddleware(rateLimitStore, "admin", rateLimit("admin")), idempotency, middlewares.AuditMiddleware(auditRepository))
+	controller.RegisterAdminRoutes(adminHandler, adminController)
 	controller.RegisterRecordRoutes(recordHandler, recordController)
+	ledgerHandler.Use(middlewares.JwtMiddleware(jwtManager), middlewares.RequireActiveUser(userRepository), usersRateLimit, idempotency)
+	controller.RegisterLedgerRoutes(ledgerHandler, ledgerController)
+	invitationHandler.Use(middlewares.JwtMiddleware(jwtManager), middlewares.RequireActiveUser(userRepository), usersRateLimit, idempotency)
+	controller.RegisterInvitationRoutes(invitationHandler, ledgerController)
+	groupHandler.Use(middlewares.JwtMiddleware(jwtManager), middlewares.RequireActiveUser(userRepository), usersRateLimit, idempotency, middlewares.LedgerMiddleware(ledgerRepository))
+	controller.RegisterGroupRoutes(groupHandler, groupController)
+	webhookHandler.Use(middlewares.JwtMiddleware(jwtManager), middlewares.RequireActiveUser(userRepository), usersRateLimit, idempotency)
+	controller.RegisterWebhookRoutes(webhookHandler, webhookController)
+	controller.RegisterAuthRoutes(authHandler, authController)
+	authLinkHandler := authHandler.Group("", middlewares.JwtMiddleware(jwtManager), middlewares.RequireActiveUser(userRepository))
+	controller.RegisterAuthLinkRoutes(authLinkHandler, authController)
+
+	healthService := service.NewHealthService(repository.NewHealthRepository(db))
+	controller.RegisterHealthRoutes(router, controller.NewHealthController(healthService))
+	openapi.RegisterRoutes(router)
+
+	// Every /api/v1 route must be described in api/openapi/openapi.json,
+	// TestRoutesMatchSpec fails on drift, this only reminds a running server
+	if err := openapi.CheckRoutes(router.Routes()); err != nil {
+		logger.Warn("%v", err)
+	}
 
 	return router
 }
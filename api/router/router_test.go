@@ -0,0 +1,92 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aq-simei/coin-pilot/api/openapi"
+	"github.com/aq-simei/coin-pilot/internal/config"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// testConfig is the default configuration with the secrets Validate asks
+// for.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Database.DSN = "postgres://coinpilot@localhost/coinpilot_test"
+	cfg.Security.JWTSecret = "0123456789abcdef0123456789abcdef"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid test configuration: %v", err)
+	}
+	return cfg
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Building the router does not query the database
+	router := NewRouter(&gorm.DB{Config: &gorm.Config{}}, testConfig(t))
+	if err := openapi.CheckRoutes(router.Routes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{"no trusted proxy", nil, "10.0.0.7"},
+		{"peer is a trusted proxy", []string{"10.0.0.0/8"}, "203.0.113.9"},
+		{"peer is another host", []string{"192.168.0.1"}, "10.0.0.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.App.TrustedProxies = tt.proxies
+			router := NewRouter(&gorm.DB{Config: &gorm.Config{}}, cfg)
+			router.GET("/client-ip", func(c *gin.Context) {
+				c.String(http.StatusOK, c.ClientIP())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/client-ip", nil)
+			req.RemoteAddr = "10.0.0.7:51234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.9")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.want {
+				t.Fatalf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlobalRateLimitOnlyCoversTheAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := testConfig(t)
+	cfg.RateLimit.Limits["global"] = "1/1m"
+	router := NewRouter(&gorm.DB{Config: &gorm.Config{}}, cfg)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	for _, path := range []string{"/livez", "/metrics", "/openapi.json", "/docs"} {
+		for range 3 {
+			if code := get(path); code != http.StatusOK {
+				t.Fatalf("GET %s = %d, want 200", path, code)
+			}
+		}
+	}
+	if code := get("/api/v1/"); code != http.StatusOK {
+		t.Fatalf("first GET /api/v1/ = %d, want 200", code)
+	}
+	if code := get("/api/v1/"); code != http.StatusTooManyRequests {
+		t.Fatalf("second GET /api/v1/ = %d, want 429", code)
+	}
+}
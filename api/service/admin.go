@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
+)
+
+type AdminService interface {
+	SearchUsers(ctx context.Context, filter models.UserFilter) (*models.Page[models.UserResponse], error)
+	SuspendUser(ctx context.Context, actorID, id string) error
+	ReactivateUser(ctx context.Context, id string) error
+	ListAuditLogs(ctx context.Context, filter models.AuditLogFilter) (*models.Page[models.AuditLog], error)
+	ListJobs(ctx context.Context, filter models.JobFilter) (*models.Page[models.Job], error)
+	RetryJob(ctx context.Context, id string) (*models.Job, error)
+}
+
+type AdminServiceImpl struct {
+	userRepo  repository.UserRepository
+	auditRepo repository.AuditRepository
+	jobRepo   repository.JobRepository
+}
+
+func NewAdminService(userRepo repository.UserRepository, auditRepo repository.AuditRepository, jobRepo repository.JobRepository) AdminService {
+	return &AdminServiceImpl{
+		userRepo:  userRepo,
+		auditRepo: auditRepo,
+		jobRepo:   jobRepo,
+	}
+}
+
+func (s *AdminServiceImpl) SearchUsers(ctx context.Context, filter models.UserFilter) (_ *models.Page[models.UserResponse], err error) {
+	ctx, span := tracing.Start(ctx, "AdminService.SearchUsers")
+	defer func() { tracing.End(span, err) }()
+
+	if filter.Role != "" && !filter.Role.IsValid() {
+		return nil, errors.NewBadRequest("unknown role")
+	}
+	users, total, err := s.userRepo.SearchUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]models.UserResponse, 0, len(users))
+	for i := range users {
+		items = append(items, *toUserResponse(&users[i]))
+	}
+	page, pageSize := models.NormalizePage(filter.Page, filter.PageSize)
+	return &models.Page[models.UserResponse]{
+		Items:    items,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (s *AdminServiceImpl) SuspendUser(ctx context.Context, actorID, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "AdminService.SuspendUser")
+	defer func() { tracing.End(span, err) }()
+
+	if actorID == id {
+		return errors.New(http.StatusConflict, "admins cannot suspend themselves")
+	}
+	return s.userRepo.SetUserStatus(ctx, id, models.StatusSuspended)
+}
+
+func (s *AdminServiceImpl) ReactivateUser(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ReactivateUser")
+	defer func() { tracing.End(span, err) }()
+
+	return s.userRepo.SetUserStatus(ctx, id, models.StatusActive)
+}
+
+func (s *AdminServiceImpl) ListAuditLogs(ctx context.Context, filter models.AuditLogFilter) (_ *models.Page[models.AuditLog], err error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListAuditLogs")
+	defer func() { tracing.End(span, err) }()
+
+	entries, total, err := s.auditRepo.ListAuditLogs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	page, pageSize := models.NormalizePage(filter.Page, filter.PageSize)
+	return &models.Page[models.AuditLog]{
+		Items:    entries,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (s *AdminServiceImpl) ListJobs(ctx context.Context, filter models.JobFilter) (_ *models.Page[models.Job], err error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListJobs")
+	defer func() { tracing.End(span, err) }()
+
+	if filter.Status != "" && !filter.Status.IsValid() {
+		return nil, errors.NewBadRequest("status must be pending, running, succeeded or dead")
+	}
+	jobs, total, err := s.jobRepo.ListJobs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if jobs == nil {
+		jobs = []models.Job{}
+	}
+	page, pageSize := models.NormalizePage(filter.Page, filter.PageSize)
+	return &models.Page[models.Job]{
+		Items:    jobs,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// RetryJob runs a dead job again with a fresh set of attempts.
+func (s *AdminServiceImpl) RetryJob(ctx context.Context, id string) (_ *models.Job, err error) {
+	ctx, span := tracing.Start(ctx, "AdminService.RetryJob")
+	defer func() { tracing.End(span, err) }()
+
+	return s.jobRepo.RequeueJob(ctx, id)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
+)
+
+type APIKeyService interface {
+	CreateAPIKey(ctx context.Context, userID string, payload models.CreateAPIKeyPayload) (*models.CreatedAPIKeyResponse, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string) error
+	Authenticate(ctx context.Context, rawKey string) (*models.APIKey, error)
+}
+
+type APIKeyServiceImpl struct {
+	repo repository.APIKeyRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository) APIKeyService {
+	return &APIKeyServiceImpl{repo: repo}
+}
+
+func (s *APIKeyServiceImpl) CreateAPIKey(ctx context.Context, userID string, payload models.CreateAPIKeyPayload) (_ *models.CreatedAPIKeyResponse, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.CreateAPIKey")
+	defer func() { tracing.End(span, err) }()
+
+	for _, scope := range payload.Scopes {
+		if !models.IsValidScope(scope) {
+			return nil, errors.NewBadRequest("unknown scope: " + scope)
+		}
+	}
+	if payload.ExpiresAt != nil && payload.ExpiresAt.Before(time.Now()) {
+		return nil, errors.NewBadRequest("expires_at must be in the future")
+	}
+
+	rawKey, prefix, err := security.GenerateAPIKey()
+	if err != nil {
+		return nil, errors.Wrap(http.StatusInternalServerError, "failed to generate api key", err)
+	}
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      payload.Name,
+		Prefix:    prefix,
+		KeyHash:   security.HashAPIKey(rawKey),
+		Scopes:    payload.Scopes,
+		ExpiresAt: payload.ExpiresAt,
+	}
+	if err := s.repo.CreateAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedAPIKeyResponse{APIKey: *key, Key: rawKey}, nil
+}
+
+func (s *APIKeyServiceImpl) ListAPIKeys(ctx context.Context, userID string) (_ []models.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.ListAPIKeys")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.ListAPIKeys(ctx, userID)
+}
+
+func (s *APIKeyServiceImpl) RevokeAPIKey(ctx context.Context, userID, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.RevokeAPIKey")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.RevokeAPIKey(ctx, userID, id)
+}
+
+func (s *APIKeyServiceImpl) Authenticate(ctx context.Context, rawKey string) (_ *models.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Authenticate")
+	defer func() { tracing.End(span, err) }()
+
+	prefix, ok := security.APIKeyPrefixOf(rawKey)
+	if !ok {
+		return nil, errors.New(http.StatusUnauthorized, "malformed api key")
+	}
+
+	key, err := s.repo.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok && appErr.Code == http.StatusNotFound {
+			return nil, errors.New(http.StatusUnauthorized, "invalid api key")
+		}
+		return nil, err
+	}
+
+	if !security.CheckAPIKey(key.KeyHash, rawKey) {
+		return nil, errors.New(http.StatusUnauthorized, "invalid api key")
+	}
+	if key.RevokedAt != nil {
+		return nil, errors.New(http.StatusUnauthorized, "api key has been revoked")
+	}
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New(http.StatusUnauthorized, "api key has expired")
+	}
+
+	// Usage tracking is best effort, it must not fail the request
+	if err := s.repo.TouchAPIKey(ctx, key.ID); err != nil {
+		logger.WarnCtx(ctx, "could not record usage of api key %s: %v", key.Prefix, err)
+	}
+	return key, nil
+}
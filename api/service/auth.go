@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+	"github.com/aq-simei/coin-pilot/internal/oidc"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
+)
+
+type AuthService interface {
+	BeginLogin(ctx context.Context, provider string) (string, error)
+	// BeginLink starts a login that links the provider to the user instead,
+	// the only way to link an account whose email was never verified.
+	BeginLink(ctx context.Context, userID, provider string) (string, error)
+	CompleteLogin(ctx context.Context, provider, state, code string) (string, error)
+}
+
+type AuthServiceImpl struct {
+	repo      repository.IdentityRepository
+	providers map[string]*oidc.Provider
+	jwt       *security.JWTManager
+	// loginTTL is how long a login can wait for the provider's callback
+	loginTTL time.Duration
+}
+
+func NewAuthService(repo repository.IdentityRepository, providers []*oidc.Provider, jwt *security.JWTManager, loginTTL time.Duration) AuthService {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+	return &AuthServiceImpl{
+		repo:      repo,
+		providers: byName,
+		jwt:       jwt,
+		loginTTL:  loginTTL,
+	}
+}
+
+func (s *AuthServiceImpl) BeginLogin(ctx context.Context, providerName string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.BeginLogin")
+	defer func() { tracing.End(span, err) }()
+
+	return s.begin(ctx, providerName, nil)
+}
+
+func (s *AuthServiceImpl) BeginLink(ctx context.Context, userID, providerName string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.BeginLink")
+	defer func() { tracing.End(span, err) }()
+
+	return s.begin(ctx, providerName, &userID)
+}
+
+// begin stores a pending login and returns the provider's URL to send the
+// user to, linkTo is the user linking the provider if any.
+func (s *AuthServiceImpl) begin(ctx context.Context, providerName string, linkTo *string) (string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", errors.NewNotFound("provider")
+	}
+
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		return "", errors.Wrap(http.StatusInternalServerError, "failed to generate state", err)
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		return "", errors.Wrap(http.StatusInternalServerError, "failed to generate nonce", err)
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", errors.Wrap(http.StatusInternalServerError, "failed to generate code verifier", err)
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallengeS256(verifier))
+	if err != nil {
+		return "", errors.Wrap(http.StatusBadGateway, "identity provider unavailable", err)
+	}
+
+	now := time.Now()
+	err = s.repo.CreatePendingLogin(ctx, &models.PendingLogin{
+		State:        state,
+		Provider:     providerName,
+		UserID:       linkTo,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(s.loginTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+func (s *AuthServiceImpl) CompleteLogin(ctx context.Context, providerName, state, code string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "AuthService.CompleteLogin")
+	defer func() { tracing.End(span, err) }()
+
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", errors.NewNotFound("provider")
+	}
+
+	// State is single use, remove it before doing anything else
+	login, err := s.repo.TakePendingLogin(ctx, state, time.Now())
+	if err != nil {
+		appErr, ok := errors.IsAppError(err)
+		if !ok || appErr.Code != http.StatusNotFound {
+			return "", err
+		}
+	}
+	if login == nil || login.Provider != providerName {
+		metrics.FailedLogins.WithLabelValues(providerName, metrics.ReasonIdentity).Inc()
+		return "", errors.New(http.StatusUnauthorized, "invalid or expired login state")
+	}
+
+	claims, err := provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		logger.ErrorCtx(ctx, "oidc exchange with %s failed: %v", providerName, err)
+		metrics.FailedLogins.WithLabelValues(providerName, metrics.ReasonIdentity).Inc()
+		return "", errors.New(http.StatusUnauthorized, "could not verify identity")
+	}
+
+	identity := models.UserIdentity{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	var user *models.User
+	if login.UserID != nil {
+		// The user proved who they are when starting the link
+		user, err = s.repo.AttachIdentity(ctx, *login.UserID, identity)
+		if err != nil {
+			return "", err
+		}
+	} else if user, err = s.repo.GetUserByIdentity(ctx, providerName, claims.Subject); err != nil {
+		appErr, ok := err.(*errors.AppError)
+		if !ok || appErr.Code != http.StatusNotFound {
+			return "", err
+		}
+
+		// Only verified emails may be linked to (or create) an account
+		if claims.Email == "" || !claims.EmailVerified {
+			metrics.FailedLogins.WithLabelValues(providerName, metrics.ReasonIdentity).Inc()
+			return "", errors.New(http.StatusForbidden, "email address is not verified by the provider")
+		}
+		user, err = s.repo.LinkIdentity(ctx, identity, claims.Name)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if user.Status == models.StatusSuspended {
+		metrics.FailedLogins.WithLabelValues(providerName, metrics.ReasonSuspended).Inc()
+		return "", errors.New(http.StatusForbidden, "account is suspended")
+	}
+
+	token, err := s.jwt.GenerateJWT(user.ID, string(user.Role))
+	if err != nil {
+		return "", errors.NewInternal("Failed to generate token")
+	}
+	metrics.Logins.WithLabelValues(providerName).Inc()
+	return token, nil
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/aq-simei/coin-pilot/internal/oidc"
+	"github.com/aq-simei/coin-pilot/internal/oidc/oidctest"
+	"github.com/aq-simei/coin-pilot/internal/testdb"
+	"gorm.io/gorm"
+)
+
+var testJWT = security.NewJWTManager("0123456789abcdef0123456789abcdef", time.Hour)
+
+// newTestAuthService logs in with two providers, mock and other, both backed
+// by the same fake provider.
+func newTestAuthService(t *testing.T, loginTTL time.Duration) (AuthService, *oidctest.Server, *gorm.DB) {
+	t.Helper()
+	db := testdb.Open(t)
+	server := oidctest.NewServer(t)
+	providers := []*oidc.Provider{server.Provider("mock"), server.Provider("other")}
+	return NewAuthService(repository.NewIdentityRepository(db), providers, testJWT, loginTTL), server, db
+}
+
+// login runs a whole login with the provider as identity and returns the
+// id of the user logged in.
+func login(t *testing.T, s AuthService, server *oidctest.Server, identity oidctest.Identity) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, err := s.BeginLogin(ctx, "mock")
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	state, code := server.SignIn(t, authURL, identity)
+	token, err := s.CompleteLogin(ctx, "mock", state, code)
+	if err != nil {
+		return "", err
+	}
+	claims, err := testJWT.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("ParseJWT: %v", err)
+	}
+	return claims.UserID, nil
+}
+
+func assertCode(t *testing.T, err error, code int) {
+	t.Helper()
+	appErr, ok := errors.IsAppError(err)
+	if !ok || appErr.Code != code {
+		t.Fatalf("err = %v, want %d", err, code)
+	}
+}
+
+func TestCompleteLoginRejectsBadState(t *testing.T) {
+	ctx := context.Background()
+	identity := oidctest.Identity{Subject: "bad-state", Email: testdb.Email("oidc"), EmailVerified: true}
+
+	tests := []struct {
+		name     string
+		loginTTL time.Duration
+		complete func(s AuthService, state, code string) error
+	}{
+		{"unknown state", time.Minute, func(s AuthService, _, code string) error {
+			_, err := s.CompleteLogin(ctx, "mock", "unknown-state", code)
+			return err
+		}},
+		{"state of another provider", time.Minute, func(s AuthService, state, code string) error {
+			_, err := s.CompleteLogin(ctx, "other", state, code)
+			return err
+		}},
+		{"expired state", -time.Second, func(s AuthService, state, code string) error {
+			_, err := s.CompleteLogin(ctx, "mock", state, code)
+			return err
+		}},
+		{"state used twice", time.Minute, func(s AuthService, state, code string) error {
+			_, _ = s.CompleteLogin(ctx, "mock", state, code)
+			_, err := s.CompleteLogin(ctx, "mock", state, code)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, server, _ := newTestAuthService(t, tt.loginTTL)
+			authURL, err := s.BeginLogin(ctx, "mock")
+			if err != nil {
+				t.Fatalf("BeginLogin: %v", err)
+			}
+			state, code := server.SignIn(t, authURL, identity)
+			assertCode(t, tt.complete(s, state, code), http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestCompleteLoginRejectsUnverifiedEmail(t *testing.T) {
+	s, server, db := newTestAuthService(t, time.Minute)
+	email := testdb.Email("oidc")
+
+	for _, verified := range []any{false, "false", nil} {
+		_, err := login(t, s, server, oidctest.Identity{Subject: "unverified-" + email, Email: email, EmailVerified: verified})
+		assertCode(t, err, http.StatusForbidden)
+	}
+	var users int64
+	if err := db.Model(&models.User{}).Where("email = ?", email).Count(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if users != 0 {
+		t.Fatalf("%d user(s) created for an unverified email", users)
+	}
+}
+
+func TestCompleteLoginLinksUserByEmail(t *testing.T) {
+	s, server, db := newTestAuthService(t, time.Minute)
+	email := testdb.Email("oidc")
+	verifiedAt := time.Now()
+	existing := &models.User{Name: "Ada", Email: email, Password: "hash", EmailVerifiedAt: &verifiedAt}
+	if err := db.Create(existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Providers may change the case of the address
+	identity := oidctest.Identity{Subject: "link-" + email, Email: strings.ToUpper(email), EmailVerified: "true"}
+	userID, err := login(t, s, server, identity)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if userID != existing.ID {
+		t.Fatalf("logged in as %s, want the existing user %s", userID, existing.ID)
+	}
+
+	// Once linked, the subject alone finds the user
+	identity.Email = testdb.Email("changed")
+	if userID, err = login(t, s, server, identity); err != nil || userID != existing.ID {
+		t.Fatalf("second login as %s (%v), want %s", userID, err, existing.ID)
+	}
+}
+
+// An attacker signing up with someone else's email must not get their
+// provider login linked to the attacker's account.
+func TestCompleteLoginRefusesUnverifiedAccount(t *testing.T) {
+	ctx := context.Background()
+	s, server, db := newTestAuthService(t, time.Minute)
+	email := testdb.Email("oidc")
+	squatter := &models.User{Name: "Mallory", Email: email, Password: "hash"}
+	if err := db.Create(squatter).Error; err != nil {
+		t.Fatal(err)
+	}
+	identity := oidctest.Identity{Subject: "victim-" + email, Email: email, EmailVerified: true}
+
+	_, err := login(t, s, server, identity)
+	assertCode(t, err, http.StatusConflict)
+	var identities int64
+	if err := db.Model(&models.UserIdentity{}).Where("user_id = ?", squatter.ID).Count(&identities).Error; err != nil {
+		t.Fatal(err)
+	}
+	if identities != 0 {
+		t.Fatal("the provider was linked to the unverified account")
+	}
+
+	// The owner of the account links the provider after logging in
+	authURL, err := s.BeginLink(ctx, squatter.ID, "mock")
+	if err != nil {
+		t.Fatalf("BeginLink: %v", err)
+	}
+	state, code := server.SignIn(t, authURL, identity)
+	if _, err := s.CompleteLogin(ctx, "mock", state, code); err != nil {
+		t.Fatalf("completing the link: %v", err)
+	}
+	if userID, err := login(t, s, server, identity); err != nil || userID != squatter.ID {
+		t.Fatalf("login after linking as %s (%v), want %s", userID, err, squatter.ID)
+	}
+}
+
+func TestCompleteLinkRefusesIdentityOfAnotherUser(t *testing.T) {
+	ctx := context.Background()
+	s, server, db := newTestAuthService(t, time.Minute)
+	identity := oidctest.Identity{Subject: "taken-" + testdb.Email("oidc"), Email: testdb.Email("oidc"), EmailVerified: true}
+	if _, err := login(t, s, server, identity); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	other := &models.User{Name: "Other", Email: testdb.Email("other"), Password: "hash"}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := s.BeginLink(ctx, other.ID, "mock")
+	if err != nil {
+		t.Fatalf("BeginLink: %v", err)
+	}
+	state, code := server.SignIn(t, authURL, identity)
+	_, err = s.CompleteLogin(ctx, "mock", state, code)
+	assertCode(t, err, http.StatusConflict)
+}
+
+func TestCompleteLoginCreatesUser(t *testing.T) {
+	s, server, db := newTestAuthService(t, time.Minute)
+	email := testdb.Email("oidc")
+
+	userID, err := login(t, s, server, oidctest.Identity{Subject: "new-" + email, Email: email, EmailVerified: true, Name: "Grace"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	user := &models.User{}
+	if err := db.First(user, "id = ?", userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != email || user.Name != "Grace" || user.Role != models.RoleUser || user.EmailVerifiedAt == nil {
+		t.Fatalf("created user = %+v", user)
+	}
+}
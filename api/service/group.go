@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
+)
+
+type GroupService interface {
+	ListGroups(ctx context.Context, userID string) ([]models.Group, error)
+	CreateGroup(ctx context.Context, userID string, payload models.CreateGroupPayload) (*models.Group, error)
+	GetGroup(ctx context.Context, userID, groupID string) (*models.Group, error)
+	UpdateGroup(ctx context.Context, userID, groupID string, payload models.UpdateGroupPayload) (*models.Group, error)
+	DeleteGroup(ctx context.Context, userID, groupID string) error
+	AddMember(ctx context.Context, userID, groupID string, payload models.AddGroupMemberPayload) (*models.GroupMember, error)
+	RemoveMember(ctx context.Context, userID, groupID, memberID string) error
+	CreateExpense(ctx context.Context, scope models.LedgerScope, groupID string, payload models.CreateGroupExpensePayload) (*models.GroupExpense, error)
+	ListExpenses(ctx context.Context, userID, groupID string, filter models.GroupExpenseFilter) (*models.Page[models.GroupExpense], error)
+	GetExpense(ctx context.Context, userID, groupID, id string) (*models.GroupExpense, error)
+	DeleteExpense(ctx context.Context, userID, groupID, id string) error
+	CreateSettlement(ctx context.Context, userID, groupID string, payload models.CreateSettlementPayload) (*models.GroupSettlement, error)
+	ListSettlements(ctx context.Context, userID, groupID string) ([]models.GroupSettlement, error)
+	DeleteSettlement(ctx context.Context, userID, groupID, id string) error
+	Balances(ctx context.Context, userID, groupID string) (*models.GroupBalances, error)
+}
+
+type GroupServiceImpl struct {
+	repo    repository.GroupRepository
+	users   repository.UserRepository
+	records repository.RecordRepository
+	now     func() time.Time
+}
+
+func NewGroupService(repo repository.GroupRepository, users repository.UserRepository, records repository.RecordRepository) GroupService {
+	return &GroupServiceImpl{
+		repo:    repo,
+		users:   users,
+		records: records,
+		now:     time.Now,
+	}
+}
+
+func (s *GroupServiceImpl) ListGroups(ctx context.Context, userID string) (_ []models.Group, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.ListGroups")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.ListGroups(ctx, userID)
+}
+
+// CreateGroup creates a group with the user and the placeholder members of
+// the payload.
+func (s *GroupServiceImpl) CreateGroup(ctx context.Context, userID string, payload models.CreateGroupPayload) (_ *models.Group, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.CreateGroup")
+	defer func() { tracing.End(span, err) }()
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		return nil, errors.NewBadRequest("name must not be blank")
+	}
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &models.Group{
+		Name:      name,
+		CreatedBy: userID,
+		Members:   []models.GroupMember{{UserID: &userID, Name: user.Name}},
+	}
+	for _, member := range payload.Members {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			return nil, errors.NewBadRequest("member names must not be blank")
+		}
+		group.Members = append(group.Members, models.GroupMember{Name: member})
+	}
+	if err := s.repo.CreateGroup(ctx, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (s *GroupServiceImpl) GetGroup(ctx context.Context, userID, groupID string) (_ *models.Group, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.GetGroup")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.GetGroup(ctx, userID, groupID)
+}
+
+func (s *GroupServiceImpl) UpdateGroup(ctx context.Context, userID, groupID string, payload models.UpdateGroupPayload) (_ *models.Group, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.UpdateGroup")
+	defer func() { tracing.End(span, err) }()
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		return nil, errors.NewBadRequest("name must not be blank")
+	}
+	if err := s.repo.RenameGroup(ctx, userID, groupID, name); err != nil {
+		return nil, err
+	}
+	return s.repo.GetGroup(ctx, userID, groupID)
+}
+
+func (s *GroupServiceImpl) DeleteGroup(ctx context.Context, userID, groupID string) (err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.DeleteGroup")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.DeleteGroup(ctx, userID, groupID)
+}
+
+// AddMember adds a registered user found by email, who gets access to the
+// group, or a placeholder with only a name. An unknown email adds a
+// placeholder and the response never says which one was added, so emails
+// cannot be probed for accounts.
+func (s *GroupServiceImpl) AddMember(
+	ctx context.Context,
+	userID, groupID string,
+	payload models.AddGroupMemberPayload,
+) (_ *models.GroupMember, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.AddMember")
+	defer func() { tracing.End(span, err) }()
+
+	member := &models.GroupMember{GroupID: groupID, Name: strings.TrimSpace(payload.Name)}
+	if payload.Email != "" {
+		user, err := s.users.GetUserByEmail(ctx, payload.Email)
+		if err == nil {
+			member.UserID = &user.ID
+		} else if appErr, ok := errors.IsAppError(err); !ok || appErr.Code != http.StatusNotFound {
+			return nil, err
+		}
+		if member.Name == "" {
+			member.Name, _, _ = strings.Cut(payload.Email, "@")
+		}
+	}
+	if member.Name == "" {
+		return nil, errors.NewBadRequest("either email or name is required")
+	}
+	if err := s.repo.AddMember(ctx, userID, member); err != nil {
+		return nil, err
+	}
+	added := *member
+	added.UserID = nil
+	return &added, nil
+}
+
+func (s *GroupServiceImpl) RemoveMember(ctx context.Context, userID, groupID, memberID string) (err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.RemoveMember")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.RemoveMember(ctx, userID, groupID, memberID)
+}
+
+// CreateExpense splits an expense between members. An expense made from a
+// record must be on a record the user can read in the ledger of scope.
+func (s *GroupServiceImpl) CreateExpense(
+	ctx context.Context,
+	scope models.LedgerScope,
+	groupID string,
+	payload models.CreateGroupExpensePayload,
+) (_ *models.GroupExpense, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.CreateExpense")
+	defer func() { tracing.End(span, err) }()
+
+	expense := &models.GroupExpense{
+		GroupID:     groupID,
+		Description: strings.TrimSpace(payload.Description),
+		Amount:      payload.Amount,
+		PaidBy:      payload.PaidBy,
+		SplitType:   payload.SplitType,
+		CreatedBy:   scope.UserID,
+	}
+	if payload.Date != nil {
+		expense.Date = *payload.Date
+	}
+	if payload.RecordID != "" {
+		record, err := s.records.GetRecord(ctx, scope, payload.RecordID)
+		if err != nil {
+			return nil, err
+		}
+		expense.RecordID = &record.ID
+		if expense.Description == "" {
+			expense.Description = record.Name
+		}
+		if expense.Amount == 0 {
+			expense.Amount = record.Amount
+		}
+		if payload.Date == nil {
+			expense.Date = record.Date
+		}
+	}
+	if expense.Date.IsZero() {
+		expense.Date = s.now()
+	}
+	if expense.Description == "" {
+		return nil, errors.NewBadRequest("description is required")
+	}
+	if expense.Amount <= 0 || expense.Amount > maxGroupAmount {
+		return nil, errors.NewBadRequest(fmt.Sprintf("amount must be between 1 and %d cents", int64(maxGroupAmount)))
+	}
+
+	splits := payload.Splits
+	if len(splits) == 0 && payload.SplitType == models.SplitEqual {
+		// Split between everyone
+		group, err := s.repo.GetGroup(ctx, scope.UserID, groupID)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range group.Members {
+			splits = append(splits, models.SplitInput{MemberID: member.ID})
+		}
+	}
+	shares, err := splitExpense(expense.Amount, payload.SplitType, splits)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	expense.Shares = shares
+
+	if err := s.repo.CreateExpense(ctx, scope.UserID, expense); err != nil {
+		return nil, err
+	}
+	return expense, nil
+}
+
+func (s *GroupServiceImpl) ListExpenses(
+	ctx context.Context,
+	userID, groupID string,
+	filter models.GroupExpenseFilter,
+) (_ *models.Page[models.GroupExpense], err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.ListExpenses")
+	defer func() { tracing.End(span, err) }()
+
+	expenses, total, err := s.repo.ListExpenses(ctx, userID, groupID, filter)
+	if err != nil {
+		return nil, err
+	}
+	if expenses == nil {
+		expenses = []models.GroupExpense{}
+	}
+	page, pageSize := models.NormalizePage(filter.Page, filter.PageSize)
+	return &models.Page[models.GroupExpense]{
+		Items:    expenses,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (s *GroupServiceImpl) GetExpense(ctx context.Context, userID, groupID, id string) (_ *models.GroupExpense, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.GetExpense")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.GetExpense(ctx, userID, groupID, id)
+}
+
+func (s *GroupServiceImpl) DeleteExpense(ctx context.Context, userID, groupID, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.DeleteExpense")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.DeleteExpense(ctx, userID, groupID, id)
+}
+
+// CreateSettlement records a payment between two members.
+func (s *GroupServiceImpl) CreateSettlement(
+	ctx context.Context,
+	userID, groupID string,
+	payload models.CreateSettlementPayload,
+) (_ *models.GroupSettlement, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.CreateSettlement")
+	defer func() { tracing.End(span, err) }()
+
+	if payload.FromID == payload.ToID {
+		return nil, errors.NewBadRequest("a member cannot settle with themselves")
+	}
+	if payload.Amount > maxGroupAmount {
+		return nil, errors.NewBadRequest(fmt.Sprintf("amount must be between 1 and %d cents", int64(maxGroupAmount)))
+	}
+	settlement := &models.GroupSettlement{
+		GroupID:   groupID,
+		FromID:    payload.FromID,
+		ToID:      payload.ToID,
+		Amount:    payload.Amount,
+		Date:      s.now(),
+		Note:      strings.TrimSpace(payload.Note),
+		CreatedBy: userID,
+	}
+	if payload.Date != nil {
+		settlement.Date = *payload.Date
+	}
+	if err := s.repo.CreateSettlement(ctx, userID, settlement); err != nil {
+		return nil, err
+	}
+	return settlement, nil
+}
+
+func (s *GroupServiceImpl) ListSettlements(ctx context.Context, userID, groupID string) (_ []models.GroupSettlement, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.ListSettlements")
+	defer func() { tracing.End(span, err) }()
+
+	settlements, err := s.repo.ListSettlements(ctx, userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if settlements == nil {
+		settlements = []models.GroupSettlement{}
+	}
+	return settlements, nil
+}
+
+func (s *GroupServiceImpl) DeleteSettlement(ctx context.Context, userID, groupID, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.DeleteSettlement")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.DeleteSettlement(ctx, userID, groupID, id)
+}
+
+// Balances returns who owes whom, simplified to the fewest payments that
+// settle the group.
+func (s *GroupServiceImpl) Balances(ctx context.Context, userID, groupID string) (_ *models.GroupBalances, err error) {
+	ctx, span := tracing.Start(ctx, "GroupService.Balances")
+	defer func() { tracing.End(span, err) }()
+
+	balances, err := s.repo.Balances(ctx, userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if balances == nil {
+		balances = []models.MemberBalance{}
+	}
+	return &models.GroupBalances{Balances: balances, Debts: simplifyDebts(balances)}, nil
+}
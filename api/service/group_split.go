@@ -0,0 +1,146 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+const (
+	// maxGroupAmount keeps amount times weight within int64, it is ten
+	// billion in cents
+	maxGroupAmount = 1_000_000_000_000
+	// maxShares bounds the weight of a member in a shares split
+	maxShares = 1_000_000
+	// wholePercentage is 100% in basis points
+	wholePercentage = 10_000
+)
+
+// splitExpense computes what each member taking part in the expense owes,
+// see models.SplitType for what the split values mean.
+func splitExpense(amount int64, splitType models.SplitType, splits []models.SplitInput) ([]models.GroupExpenseShare, error) {
+	if len(splits) == 0 {
+		return nil, fmt.Errorf("the expense must be split between at least one member")
+	}
+	seen := map[string]bool{}
+	var total int64
+	for _, split := range splits {
+		if seen[split.MemberID] {
+			return nil, fmt.Errorf("member %s is listed twice", split.MemberID)
+		}
+		seen[split.MemberID] = true
+		if splitType != models.SplitEqual && split.Value < 0 {
+			return nil, fmt.Errorf("split values must not be negative")
+		}
+		total += split.Value
+	}
+
+	weights := make([]int64, len(splits))
+	switch splitType {
+	case models.SplitEqual:
+		for i := range weights {
+			weights[i] = 1
+		}
+	case models.SplitExact:
+		if total != amount {
+			return nil, fmt.Errorf("exact splits add up to %d, the expense is %d", total, amount)
+		}
+	case models.SplitPercentage:
+		if total != wholePercentage {
+			return nil, fmt.Errorf("percentages add up to %d basis points, they must add up to %d", total, wholePercentage)
+		}
+	case models.SplitShares:
+		if total == 0 {
+			return nil, fmt.Errorf("at least one member must have a share")
+		}
+		for _, split := range splits {
+			if split.Value > maxShares {
+				return nil, fmt.Errorf("a member can have at most %d shares", maxShares)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown split type %q", splitType)
+	}
+	if splitType != models.SplitEqual {
+		for i, split := range splits {
+			weights[i] = split.Value
+		}
+	}
+
+	amounts := weights
+	if splitType != models.SplitExact {
+		amounts = allocate(amount, weights)
+	}
+	shares := make([]models.GroupExpenseShare, len(splits))
+	for i, split := range splits {
+		shares[i] = models.GroupExpenseShare{MemberID: split.MemberID, Value: weights[i], Amount: amounts[i]}
+	}
+	return shares, nil
+}
+
+// allocate divides amount in proportion to weights in whole cents. The cents
+// lost by rounding down go to the largest remainders, earlier members first
+// on ties, so the parts always add up to amount.
+func allocate(amount int64, weights []int64) []int64 {
+	var total int64
+	for _, weight := range weights {
+		total += weight
+	}
+	parts := make([]int64, len(weights))
+	remainders := make([]int64, len(weights))
+	left := amount
+	for i, weight := range weights {
+		parts[i] = amount * weight / total
+		remainders[i] = amount * weight % total
+		left -= parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(remainders[b], remainders[a])
+	})
+	for _, i := range order[:left] {
+		parts[i]++
+	}
+	return parts
+}
+
+// simplifyDebts returns payments settling the balances, at most one less
+// than the members who owe or are owed. The largest debts are matched with
+// the largest credits first.
+func simplifyDebts(balances []models.MemberBalance) []models.Debt {
+	var creditors, debtors []models.MemberBalance
+	for _, balance := range balances {
+		switch {
+		case balance.Balance > 0:
+			creditors = append(creditors, balance)
+		case balance.Balance < 0:
+			debtors = append(debtors, models.MemberBalance{MemberID: balance.MemberID, Balance: -balance.Balance})
+		}
+	}
+	largestFirst := func(a, b models.MemberBalance) int {
+		return cmp.Or(cmp.Compare(b.Balance, a.Balance), cmp.Compare(a.MemberID, b.MemberID))
+	}
+	slices.SortFunc(creditors, largestFirst)
+	slices.SortFunc(debtors, largestFirst)
+
+	debts := []models.Debt{}
+	for i, j := 0, 0; i < len(debtors) && j < len(creditors); {
+		amount := min(debtors[i].Balance, creditors[j].Balance)
+		debts = append(debts, models.Debt{FromID: debtors[i].MemberID, ToID: creditors[j].MemberID, Amount: amount})
+		debtors[i].Balance -= amount
+		creditors[j].Balance -= amount
+		if debtors[i].Balance == 0 {
+			i++
+		}
+		if creditors[j].Balance == 0 {
+			j++
+		}
+	}
+	return debts
+}
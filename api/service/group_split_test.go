@@ -0,0 +1,131 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"even", 900, []int64{1, 1, 1}, []int64{300, 300, 300}},
+		{"cents left go to earlier members on ties", 1000, []int64{1, 1, 1}, []int64{334, 333, 333}},
+		{"cents left go to the largest remainders", 100, []int64{1, 2, 4}, []int64{14, 29, 57}},
+		{"zero weight gets nothing", 1001, []int64{0, 1, 1}, []int64{0, 501, 500}},
+		{"basis points", 999, []int64{3333, 3333, 3334}, []int64{333, 333, 333}},
+		{"single member", 4250, []int64{7}, []int64{4250}},
+		{"largest amount and shares", maxGroupAmount, []int64{maxShares, 1}, []int64{999_999_000_001, 999_999}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allocate(tt.amount, tt.weights)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("allocate(%d, %v) = %v, want %v", tt.amount, tt.weights, got, tt.want)
+			}
+			var sum int64
+			for _, part := range got {
+				sum += part
+			}
+			if sum != tt.amount {
+				t.Fatalf("parts add up to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
+
+func TestSplitExpense(t *testing.T) {
+	splits := func(values ...int64) []models.SplitInput {
+		inputs := make([]models.SplitInput, len(values))
+		for i, value := range values {
+			inputs[i] = models.SplitInput{MemberID: string(rune('a' + i)), Value: value}
+		}
+		return inputs
+	}
+	tests := []struct {
+		name      string
+		amount    int64
+		splitType models.SplitType
+		splits    []models.SplitInput
+		want      []int64
+		wantErr   bool
+	}{
+		{"equal ignores values", 1000, models.SplitEqual, splits(5, -3, 0), []int64{334, 333, 333}, false},
+		{"exact", 1000, models.SplitExact, splits(700, 300), []int64{700, 300}, false},
+		{"exact not adding up", 1000, models.SplitExact, splits(700, 299), nil, true},
+		{"percentage", 1000, models.SplitPercentage, splits(5000, 2500, 2500), []int64{500, 250, 250}, false},
+		{"percentage not adding up to 100%", 1000, models.SplitPercentage, splits(5000, 4999), nil, true},
+		{"shares", 1000, models.SplitShares, splits(2, 1, 1), []int64{500, 250, 250}, false},
+		{"shares all zero", 1000, models.SplitShares, splits(0, 0), nil, true},
+		{"too many shares", 1000, models.SplitShares, splits(maxShares+1, 1), nil, true},
+		{"negative value", 1000, models.SplitShares, splits(2, -1), nil, true},
+		{"no member", 1000, models.SplitEqual, nil, nil, true},
+		{"member listed twice", 1000, models.SplitEqual, []models.SplitInput{{MemberID: "a"}, {MemberID: "a"}}, nil, true},
+		{"unknown type", 1000, models.SplitType("ratio"), splits(1), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares, err := splitExpense(tt.amount, tt.splitType, tt.splits)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("splitExpense succeeded with %+v", shares)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitExpense: %v", err)
+			}
+			got := make([]int64, len(shares))
+			for i, share := range shares {
+				got[i] = share.Amount
+				if share.MemberID != tt.splits[i].MemberID {
+					t.Fatalf("share %d is for %s, want %s", i, share.MemberID, tt.splits[i].MemberID)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("amounts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimplifyDebts(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances []models.MemberBalance
+		want     []models.Debt
+	}{
+		{"settled", []models.MemberBalance{{MemberID: "a"}, {MemberID: "b"}}, []models.Debt{}},
+		{
+			"one debtor",
+			[]models.MemberBalance{{MemberID: "a", Balance: 600}, {MemberID: "b", Balance: -300}, {MemberID: "c", Balance: -300}},
+			[]models.Debt{{FromID: "b", ToID: "a", Amount: 300}, {FromID: "c", ToID: "a", Amount: 300}},
+		},
+		{
+			"largest debts meet largest credits",
+			[]models.MemberBalance{{MemberID: "a", Balance: 100}, {MemberID: "b", Balance: 500}, {MemberID: "c", Balance: -450}, {MemberID: "d", Balance: -150}},
+			[]models.Debt{{FromID: "c", ToID: "b", Amount: 450}, {FromID: "d", ToID: "b", Amount: 50}, {FromID: "d", ToID: "a", Amount: 100}},
+		},
+		{
+			"chain collapses",
+			[]models.MemberBalance{{MemberID: "a", Balance: -100}, {MemberID: "b", Balance: 0}, {MemberID: "c", Balance: 100}},
+			[]models.Debt{{FromID: "a", ToID: "c", Amount: 100}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := simplifyDebts(tt.balances)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("simplifyDebts = %+v, want %+v", got, tt.want)
+			}
+			if len(got) >= len(tt.balances) {
+				t.Fatalf("%d payments for %d members", len(got), len(tt.balances))
+			}
+		})
+	}
+}
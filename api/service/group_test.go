@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"testing"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+)
+
+// stubUsers knows a single user, the methods not overridden are not used.
+type stubUsers struct {
+	repository.UserRepository
+}
+
+func (stubUsers) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	if email != "ada@example.com" {
+		return nil, errors.New(http.StatusNotFound, "user not found")
+	}
+	return &models.User{ID: "ada", Name: "Ada Lovelace", Email: email}, nil
+}
+
+// stubMembers keeps the members added instead of storing them.
+type stubMembers struct {
+	repository.GroupRepository
+	added []models.GroupMember
+}
+
+func (r *stubMembers) AddMember(ctx context.Context, userID string, member *models.GroupMember) error {
+	member.ID = "member"
+	r.added = append(r.added, *member)
+	return nil
+}
+
+func TestAddMemberByEmailDoesNotRevealAccounts(t *testing.T) {
+	members := &stubMembers{}
+	s := NewGroupService(members, stubUsers{}, nil)
+
+	tests := []struct {
+		email string
+		want  map[string]any
+	}{
+		{"ada@example.com", map[string]any{"id": "member", "group_id": "group", "name": "ada", "created_at": "0001-01-01T00:00:00Z"}},
+		{"nobody@example.com", map[string]any{"id": "member", "group_id": "group", "name": "nobody", "created_at": "0001-01-01T00:00:00Z"}},
+	}
+	for _, tt := range tests {
+		member, err := s.AddMember(context.Background(), "user", "group", models.AddGroupMemberPayload{Email: tt.email})
+		if err != nil {
+			t.Fatalf("AddMember(%s): %v", tt.email, err)
+		}
+		body, err := json.Marshal(member)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Fatalf("AddMember(%s) = %s, want %v", tt.email, body, tt.want)
+		}
+	}
+
+	// The registered user still gets access to the group
+	if got := members.added[0].UserID; got == nil || *got != "ada" {
+		t.Fatalf("registered member linked to %v, want ada", got)
+	}
+	if members.added[1].UserID != nil {
+		t.Fatalf("unknown email linked to %s", *members.added[1].UserID)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+)
+
+// healthCheckTimeout bounds each readiness check so a hung database cannot
+// hang the probe.
+const healthCheckTimeout = 2 * time.Second
+
+type HealthService interface {
+	Ready(ctx context.Context) *models.HealthReport
+}
+
+type HealthServiceImpl struct {
+	repo repository.HealthRepository
+}
+
+func NewHealthService(repo repository.HealthRepository) HealthService {
+	return &HealthServiceImpl{repo: repo}
+}
+
+// Ready checks that the database answers and that its schema is up to date.
+func (s *HealthServiceImpl) Ready(ctx context.Context) *models.HealthReport {
+	report := &models.HealthReport{Status: models.HealthOK, Checks: map[string]models.HealthCheck{}}
+	check := func(name string, fn func(ctx context.Context) error) {
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			logger.WarnCtx(ctx, "readiness check %s failed: %v", name, err)
+			report.Status = models.HealthUnavailable
+			report.Checks[name] = models.HealthCheck{Status: models.HealthUnavailable, Error: err.Error()}
+			return
+		}
+		report.Checks[name] = models.HealthCheck{Status: models.HealthOK}
+	}
+
+	check("database", s.repo.Ping)
+	if report.Status != models.HealthOK {
+		report.Checks["migrations"] = models.HealthCheck{Status: models.HealthUnavailable, Error: "database unavailable"}
+		return report
+	}
+	check("migrations", func(ctx context.Context) error {
+		pending, err := s.repo.PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migration(s): %s", len(pending), strings.Join(pending, ", "))
+		}
+		return nil
+	})
+	return report
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+)
+
+// IdempotencyKeyPurger deletes stored responses once their key expired. It
+// runs as the purge.idempotency_keys job.
+type IdempotencyKeyPurger struct {
+	store repository.IdempotencyStore
+}
+
+func NewIdempotencyKeyPurger(store repository.IdempotencyStore) *IdempotencyKeyPurger {
+	return &IdempotencyKeyPurger{store: store}
+}
+
+func (p *IdempotencyKeyPurger) PurgeOnce(ctx context.Context) error {
+	purged, err := p.store.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.DebugCtx(ctx, "deleted %d expired idempotency key(s)", purged)
+	}
+	return nil
+}
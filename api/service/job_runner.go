@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/internal/config"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+)
+
+type JobRunnerConfig struct {
+	PollInterval time.Duration
+	Concurrency  int
+	Timeout      time.Duration
+	// Retry applies to the kinds of jobs without a policy of their own
+	Retry RetryPolicy
+}
+
+func NewJobRunnerConfig(cfg config.JobsConfig) JobRunnerConfig {
+	return JobRunnerConfig{
+		PollInterval: time.Duration(cfg.PollInterval),
+		Concurrency:  cfg.Concurrency,
+		Timeout:      time.Duration(cfg.Timeout),
+		Retry: RetryPolicy{
+			MaxAttempts: cfg.MaxAttempts,
+			BaseDelay:   time.Duration(cfg.RetryBaseDelay),
+			MaxDelay:    time.Duration(cfg.RetryMaxDelay),
+		},
+	}
+}
+
+// RetryPolicy is how a failed job is retried: up to MaxAttempts in total,
+// waiting BaseDelay after the first failure, then twice as long each time up
+// to MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Delay is the wait after the given number of failed attempts.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// LastAttempt reports whether a job failing this attempt is not retried.
+func (p RetryPolicy) LastAttempt(attempts int) bool {
+	return attempts >= p.MaxAttempts
+}
+
+// JobHandler runs one attempt of a job. When it returns an error the job is
+// retried later, unless the error is permanent, see PermanentJobError.
+type JobHandler func(ctx context.Context, job models.Job) error
+
+// PermanentJobError is a failure retrying cannot fix, the job is dead right
+// away.
+type PermanentJobError struct {
+	Err error
+}
+
+func (e *PermanentJobError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentJobError) Unwrap() error {
+	return e.Err
+}
+
+// JobRunner runs the queued jobs of the kinds it has handlers for. Several
+// instances can run at once, each job is claimed by one of them.
+type JobRunner struct {
+	repository repository.JobRepository
+	cfg        JobRunnerConfig
+	handlers   map[string]JobHandler
+	retries    map[string]RetryPolicy
+	schedules  []jobSchedule
+	now        func() time.Time
+}
+
+// jobSchedule queues a job of the kind every interval.
+type jobSchedule struct {
+	kind     string
+	interval time.Duration
+}
+
+func NewJobRunner(repository repository.JobRepository, cfg JobRunnerConfig) *JobRunner {
+	return &JobRunner{
+		repository: repository,
+		cfg:        cfg,
+		handlers:   map[string]JobHandler{},
+		retries:    map[string]RetryPolicy{},
+		now:        time.Now,
+	}
+}
+
+// Handle sets the handler of a kind of job. Handlers are set before Run.
+func (r *JobRunner) Handle(kind string, handler JobHandler) {
+	r.handlers[kind] = handler
+}
+
+// Retry sets the retry policy of a kind of job, instead of the one of the
+// config. Policies are set before Run.
+func (r *JobRunner) Retry(kind string, policy RetryPolicy) {
+	r.retries[kind] = policy
+}
+
+// RetryPolicy returns the retry policy of a kind of job.
+func (r *JobRunner) RetryPolicy(kind string) RetryPolicy {
+	if policy, ok := r.retries[kind]; ok {
+		return policy
+	}
+	return r.cfg.Retry
+}
+
+// HandleJob sets a handler taking the payload of the job decoded into T. A
+// payload that cannot be decoded is a permanent failure.
+func HandleJob[T any](r *JobRunner, kind string, handler func(ctx context.Context, payload T) error) {
+	r.Handle(kind, func(ctx context.Context, job models.Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return &PermanentJobError{Err: fmt.Errorf("decoding %s payload: %w", kind, err)}
+		}
+		return handler(ctx, payload)
+	})
+}
+
+// Every queues a job of the kind, with an empty payload, once per interval.
+// Each period has a unique key so the job runs once however many instances
+// schedule it.
+func (r *JobRunner) Every(kind string, interval time.Duration) {
+	r.schedules = append(r.schedules, jobSchedule{kind: kind, interval: interval})
+}
+
+// Run schedules the periodic jobs and runs due jobs every poll interval
+// until ctx is cancelled. It returns once the jobs running are stopped.
+func (r *JobRunner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, schedule := range r.schedules {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runEvery(ctx, schedule.interval, func(ctx context.Context) {
+				r.schedule(ctx, schedule)
+			})
+		}()
+	}
+	runEvery(ctx, r.cfg.PollInterval, r.RunOnce)
+	wg.Wait()
+}
+
+// RunOnce runs due jobs, up to the concurrency at a time, until none are
+// left.
+func (r *JobRunner) RunOnce(ctx context.Context) {
+	kinds := slices.Sorted(maps.Keys(r.handlers))
+	if len(kinds) == 0 {
+		return
+	}
+	for ctx.Err() == nil {
+		// The lock outlasts the jobs of the batch, which run together
+		jobs, err := r.repository.ClaimJobs(ctx, kinds, r.cfg.Concurrency, r.now().Add(r.cfg.Timeout+time.Minute))
+		if err != nil {
+			logger.ErrorCtx(ctx, "claiming jobs failed: %v", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for i := range jobs {
+			wg.Add(1)
+			go func(job *models.Job) {
+				defer wg.Done()
+				r.run(ctx, job)
+			}(&jobs[i])
+		}
+		wg.Wait()
+
+		if len(jobs) < r.cfg.Concurrency {
+			return
+		}
+	}
+}
+
+func (r *JobRunner) schedule(ctx context.Context, schedule jobSchedule) {
+	period := r.now().Truncate(schedule.interval)
+	key := fmt.Sprintf("%s@%d", schedule.kind, period.Unix())
+	job := &models.Job{Kind: schedule.kind, Payload: models.JSONDocument("{}"), RunAt: period, UniqueKey: &key}
+	if err := r.repository.Enqueue(ctx, job); err != nil {
+		logger.ErrorCtx(ctx, "scheduling %s failed: %v", schedule.kind, err)
+	}
+}
+
+// run runs one attempt of the job and stores the outcome. When ctx is
+// cancelled meanwhile the outcome is not stored, the job runs again once its
+// lock expires.
+func (r *JobRunner) run(ctx context.Context, job *models.Job) {
+	policy := r.RetryPolicy(job.Kind)
+	// A job claimed again after its runners died keeps counting attempts
+	if job.Attempts > policy.MaxAttempts {
+		r.bury(ctx, job, "ran out of attempts, its runner stopped before it finished")
+		return
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	err := r.call(jobCtx, job)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+
+	var permanent *PermanentJobError
+	switch {
+	case err == nil:
+		metrics.JobRuns.WithLabelValues(job.Kind, "succeeded").Inc()
+		if err := r.repository.CompleteJob(ctx, job); err != nil {
+			logger.ErrorCtx(ctx, "failed to save job %s: %v", job.ID, err)
+		}
+	case stderrors.As(err, &permanent) || policy.LastAttempt(job.Attempts):
+		r.bury(ctx, job, err.Error())
+	default:
+		metrics.JobRuns.WithLabelValues(job.Kind, "retrying").Inc()
+		logger.WarnCtx(ctx, "%s job %s failed, attempt %d: %v", job.Kind, job.ID, job.Attempts, err)
+		if err := r.repository.RetryJobAt(ctx, job, r.now().Add(policy.Delay(job.Attempts)), err.Error()); err != nil {
+			logger.ErrorCtx(ctx, "failed to save job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// call runs the handler of the job, a panic fails the attempt.
+func (r *JobRunner) call(ctx context.Context, job *models.Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return r.handlers[job.Kind](ctx, *job)
+}
+
+func (r *JobRunner) bury(ctx context.Context, job *models.Job, reason string) {
+	metrics.JobRuns.WithLabelValues(job.Kind, "dead").Inc()
+	logger.ErrorCtx(ctx, "%s job %s is dead after %d attempt(s): %s", job.Kind, job.ID, job.Attempts, reason)
+	if err := r.repository.BuryJob(ctx, job, reason); err != nil {
+		logger.ErrorCtx(ctx, "failed to save job %s: %v", job.ID, err)
+	}
+}
+
+// runEvery calls job right away, then every interval until ctx is cancelled.
+func runEvery(ctx context.Context, interval time.Duration, job func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 8, BaseDelay: 30 * time.Second, MaxDelay: 6 * time.Hour}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+		last     bool
+	}{
+		{1, 30 * time.Second, false},
+		{2, time.Minute, false},
+		{5, 8 * time.Minute, false},
+		{8, 64 * time.Minute, true},
+		{200, 6 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempts); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+		if got := policy.LastAttempt(tt.attempts); got != tt.last {
+			t.Errorf("LastAttempt(%d) = %v, want %v", tt.attempts, got, tt.last)
+		}
+	}
+}
+
+// stubJobs hands out the jobs once and keeps what happens to them, the
+// methods not overridden are not used.
+type stubJobs struct {
+	repository.JobRepository
+	mu      sync.Mutex
+	jobs    []models.Job
+	retried map[string]time.Time
+	buried  []string
+}
+
+func (r *stubJobs) ClaimJobs(ctx context.Context, kinds []string, limit int, lockUntil time.Time) ([]models.Job, error) {
+	jobs := r.jobs
+	r.jobs = nil
+	return jobs, nil
+}
+
+func (r *stubJobs) RetryJobAt(ctx context.Context, job *models.Job, runAt time.Time, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retried[job.ID] = runAt
+	return nil
+}
+
+func (r *stubJobs) BuryJob(ctx context.Context, job *models.Job, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buried = append(r.buried, job.ID)
+	return nil
+}
+
+func TestJobRunnerRetriesWithThePolicyOfTheKind(t *testing.T) {
+	jobs := &stubJobs{
+		jobs: []models.Job{
+			{ID: "default", Kind: models.JobInvitationEmail, Attempts: 2},
+			{ID: "default-last", Kind: models.JobInvitationEmail, Attempts: 3},
+			{ID: "webhook", Kind: models.JobWebhookDelivery, Attempts: 3},
+		},
+		retried: map[string]time.Time{},
+	}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	runner := NewJobRunner(jobs, JobRunnerConfig{
+		Concurrency: 10,
+		Timeout:     time.Minute,
+		Retry:       RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute},
+	})
+	runner.now = func() time.Time { return now }
+	failing := func(ctx context.Context, job models.Job) error {
+		return stderrors.New("unavailable")
+	}
+	runner.Handle(models.JobInvitationEmail, failing)
+	runner.Handle(models.JobWebhookDelivery, failing)
+	runner.Retry(models.JobWebhookDelivery, RetryPolicy{MaxAttempts: 8, BaseDelay: 30 * time.Second, MaxDelay: time.Hour})
+
+	runner.RunOnce(context.Background())
+
+	want := map[string]time.Time{"default": now.Add(2 * time.Second), "webhook": now.Add(2 * time.Minute)}
+	if len(jobs.retried) != len(want) {
+		t.Fatalf("retried %v, want %v", jobs.retried, want)
+	}
+	for id, at := range want {
+		if !jobs.retried[id].Equal(at) {
+			t.Errorf("%s retried at %s, want %s", id, jobs.retried[id], at)
+		}
+	}
+	if len(jobs.buried) != 1 || jobs.buried[0] != "default-last" {
+		t.Fatalf("buried %v, want default-last", jobs.buried)
+	}
+}
+
+func (r *stubJobs) Enqueue(ctx context.Context, job *models.Job) error {
+	return nil
+}
+
+func TestJobRunnerRunWaitsForItsJobs(t *testing.T) {
+	jobs := &stubJobs{jobs: []models.Job{{ID: "slow", Kind: models.JobPurgeTrash, Attempts: 1}}}
+	runner := NewJobRunner(jobs, JobRunnerConfig{PollInterval: time.Hour, Concurrency: 1, Timeout: time.Minute, Retry: RetryPolicy{MaxAttempts: 3}})
+	started := make(chan struct{})
+	finished := false
+	runner.Handle(models.JobPurgeTrash, func(ctx context.Context, job models.Job) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished = true
+		return ctx.Err()
+	})
+	runner.Every(models.JobPurgeJobs, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(stopped)
+	}()
+	<-started
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after ctx was cancelled")
+	}
+	if !finished {
+		t.Fatal("Run returned before the job running stopped")
+	}
+}
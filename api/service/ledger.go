@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
+)
+
+// invitationTTL is how long an invitation can be accepted.
+const invitationTTL = 7 * 24 * time.Hour
+
+// InvitationMailer delivers the token of a new invitation to the invitee.
+type InvitationMailer interface {
+	SendInvitation(ctx context.Context, invitation models.LedgerInvitation, ledgerName, token string) error
+}
+
+// LogInvitationMailer only writes invitations to the log, the token is
+// logged at debug level so invitations can be accepted in development.
+type LogInvitationMailer struct{}
+
+func (LogInvitationMailer) SendInvitation(ctx context.Context, invitation models.LedgerInvitation, ledgerName, token string) error {
+	logger.InfoCtx(ctx, "invitation %s to ledger %q sent to %s", invitation.ID, ledgerName, invitation.Email)
+	logger.DebugCtx(ctx, "invitation %s token: %s", invitation.ID, token)
+	return nil
+}
+
+type LedgerService interface {
+	ListLedgers(ctx context.Context, userID string) ([]models.Ledger, error)
+	CreateLedger(ctx context.Context, userID string, payload models.CreateLedgerPayload) (*models.Ledger, error)
+	GetLedger(ctx context.Context, scope models.LedgerScope) (*models.Ledger, error)
+	UpdateLedger(ctx context.Context, scope models.LedgerScope, payload models.UpdateLedgerPayload) (*models.Ledger, error)
+	DeleteLedger(ctx context.Context, scope models.LedgerScope) error
+	ListMembers(ctx context.Context, scope models.LedgerScope) ([]models.LedgerMember, error)
+	UpdateMember(ctx context.Context, scope models.LedgerScope, memberID string, payload models.UpdateLedgerMemberPayload) error
+	RemoveMember(ctx context.Context, scope models.LedgerScope, memberID string) error
+	CreateInvitation(ctx context.Context, scope models.LedgerScope, payload models.CreateInvitationPayload) (*models.LedgerInvitation, error)
+	SendInvitationEmail(ctx context.Context, job models.InvitationEmailJob) error
+	ListInvitations(ctx context.Context, scope models.LedgerScope) ([]models.LedgerInvitation, error)
+	RevokeInvitation(ctx context.Context, scope models.LedgerScope, id string) error
+	RespondToInvitation(ctx context.Context, userID, token string, accept bool) (*models.LedgerInvitation, error)
+}
+
+type LedgerServiceImpl struct {
+	repo   repository.LedgerRepository
+	users  repository.UserRepository
+	mailer InvitationMailer
+	now    func() time.Time
+}
+
+func NewLedgerService(repo repository.LedgerRepository, users repository.UserRepository, mailer InvitationMailer) LedgerService {
+	if mailer == nil {
+		mailer = LogInvitationMailer{}
+	}
+	return &LedgerServiceImpl{
+		repo:   repo,
+		users:  users,
+		mailer: mailer,
+		now:    time.Now,
+	}
+}
+
+func (s *LedgerServiceImpl) ListLedgers(ctx context.Context, userID string) (_ []models.Ledger, err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.ListLedgers")
+	defer func() { tracing.End(span, err) }()
+
+	// Make sure the personal ledger shows up before its first use
+	if _, err := s.repo.PersonalLedger(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListLedgers(ctx, userID)
+}
+
+func (s *LedgerServiceImpl) CreateLedger(ctx context.Context, userID string, payload models.CreateLedgerPayload) (_ *models.Ledger, err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.CreateLedger")
+	defer func() { tracing.End(span, err) }()
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		return nil, errors.NewBadRequest("name must not be blank")
+	}
+	return s.repo.CreateLedger(ctx, userID, name)
+}
+
+func (s *LedgerServiceImpl) GetLedger(ctx context.Context, scope models.LedgerScope) (_ *models.Ledger, err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.GetLedger")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.GetLedger(ctx, scope)
+}
+
+func (s *LedgerServiceImpl) UpdateLedger(ctx context.Context, scope models.LedgerScope, payload models.UpdateLedgerPayload) (_ *models.Ledger, err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.UpdateLedger")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.requireRole(ctx, scope, models.LedgerOwner); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		return nil, errors.NewBadRequest("name must not be blank")
+	}
+	if err := s.repo.RenameLedger(ctx, scope.LedgerID, name); err != nil {
+		return nil, err
+	}
+	return s.repo.GetLedger(ctx, scope)
+}
+
+func (s *LedgerServiceImpl) DeleteLedger(ctx context.Context, scope models.LedgerScope) (err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.DeleteLedger")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.requireRole(ctx, scope, models.LedgerOwner); err != nil {
+		return err
+	}
+	return s.repo.DeleteLedger(ctx, scope.LedgerID)
+}
+
+func (s *LedgerServiceImpl) ListMembers(ctx context.Context, scope models.LedgerScope) (_ []models.LedgerMember, err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.ListMembers")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.requireRole(ctx, scope); err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(ctx, scope.LedgerID)
+}
+
+func (s *LedgerServiceImpl) UpdateMember(
+	ctx context.Context,
+	scope models.LedgerScope,
+	memberID string,
+	payload models.UpdateLedgerMemberPayload,
+) (err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.UpdateMember")
+	defer func() { tracing.End(span, err) }()
+
+	if !payload.Role.IsValid() {
+		return errors.NewBadRequest("role must be owner, editor or viewer")
+	}
+	if err := s.requireRole(ctx, scope, models.LedgerOwner); err != nil {
+		return err
+	}
+	if err := s.repo.SetMemberRole(ctx, scope.LedgerID, memberID, payload.Role); err != nil {
+		return memberError(err)
+	}
+	return nil
+}
+
+// RemoveMember takes a member out of the ledger. Owners can remove anyone,
+// other members can only leave.
+func (s *LedgerServiceImpl) RemoveMember(ctx context.Context, scope models.LedgerScope, memberID string) (err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.RemoveMember")
+	defer func() { tracing.End(span, err) }()
+
+	if memberID == scope.UserID {
+		if err := s.requireRole(ctx, scope); err != nil {
+			return err
+		}
+	} else if err := s.requireRole(ctx, scope, models.LedgerOwner); err != nil {
+		return err
+	}
+	if err := s.repo.RemoveMember(ctx, scope.LedgerID, memberID); err != nil {
+		return memberError(err)
+	}
+	return nil
+}
+
+func (s *LedgerServiceImpl) CreateInvitation(
+	ctx context.Context,
+	scope models.LedgerScope,
+	payload models.CreateInvitationPayload,
+) (_ *models.LedgerInvitation, err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.CreateInvitation")
+	defer func() { tracing.End(span, err) }()
+
+	if !payload.Role.IsValid() {
+		return nil, errors.NewBadRequest("role must be owner, editor or viewer")
+	}
+	if err := s.requireRole(ctx, scope, models.LedgerOwner); err != nil {
+		return nil, err
+	}
+	ledger, err := s.repo.GetLedger(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	if ledger.PersonalUserID != nil {
+		return nil, errors.NewBadRequest("personal ledgers cannot be shared, create a ledger to share records")
+	}
+
+	// The token sent by email is issued by the invitation job, this one is
+	// never shown and only keeps the hash unique
+	token, err := security.GenerateToken()
+	if err != nil {
+		return nil, errors.Wrap(http.StatusInternalServerError, "failed to generate invitation token", err)
+	}
+	invitation := &models.LedgerInvitation{
+		LedgerID:  scope.LedgerID,
+		Email:     strings.TrimSpace(payload.Email),
+		Role:      payload.Role,
+		InvitedBy: scope.UserID,
+		TokenHash: security.HashToken(token),
+		Status:    models.InvitationPending,
+		ExpiresAt: s.now().Add(invitationTTL),
+	}
+	if err := s.repo.CreateInvitation(ctx, invitation); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// SendInvitationEmail runs the job queued with an invitation. Every attempt
+// issues a new token, so only the last email sent works. Invitations that
+// are no longer pending are skipped.
+func (s *LedgerServiceImpl) SendInvitationEmail(ctx context.Context, job models.InvitationEmailJob) (err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.SendInvitationEmail")
+	defer func() { tracing.End(span, err) }()
+
+	token, err := security.GenerateToken()
+	if err != nil {
+		return err
+	}
+	invitation, ledgerName, err := s.repo.IssueInvitationToken(ctx, job.InvitationID, security.HashToken(token))
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok && appErr.Code == http.StatusNotFound {
+			logger.InfoCtx(ctx, "invitation %s is no longer pending, not sending it", job.InvitationID)
+			return nil
+		}
+		return err
+	}
+	return s.mailer.SendInvitation(ctx, *invitation, ledgerName, token)
+}
+
+func (s *LedgerServiceImpl) ListInvitations(ctx context.Context, scope models.LedgerScope) (_ []models.LedgerInvitation, err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.ListInvitations")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.requireRole(ctx, scope, models.LedgerOwner); err != nil {
+		return nil, err
+	}
+	return s.repo.ListInvitations(ctx, scope.LedgerID)
+}
+
+func (s *LedgerServiceImpl) RevokeInvitation(ctx context.Context, scope models.LedgerScope, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.RevokeInvitation")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.requireRole(ctx, scope, models.LedgerOwner); err != nil {
+		return err
+	}
+	return s.repo.RevokeInvitation(ctx, scope.LedgerID, id)
+}
+
+// RespondToInvitation accepts or declines an invitation, only the user it
+// was sent to can answer it.
+func (s *LedgerServiceImpl) RespondToInvitation(ctx context.Context, userID, token string, accept bool) (_ *models.LedgerInvitation, err error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.RespondToInvitation")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.RespondToInvitation(ctx, security.HashToken(token), userID, user.Email, accept)
+}
+
+// requireRole fails unless the user is a member of the ledger with one of
+// roles, any role when none is given. Non members get a 404 so ledgers they
+// are not in stay invisible.
+func (s *LedgerServiceImpl) requireRole(ctx context.Context, scope models.LedgerScope, roles ...models.LedgerRole) error {
+	member, err := s.repo.GetMembership(ctx, scope.LedgerID, scope.UserID)
+	if err != nil {
+		return err
+	}
+	if len(roles) > 0 && !slices.Contains(roles, member.Role) {
+		return errors.New(http.StatusForbidden, "only ledger owners can do this")
+	}
+	return nil
+}
+
+// memberError reports a missing member as such instead of a missing ledger.
+func memberError(err error) error {
+	if appErr, ok := errors.IsAppError(err); ok && appErr.Code == http.StatusNotFound {
+		return errors.NewNotFound("member")
+	}
+	return err
+}
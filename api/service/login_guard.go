@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/internal/config"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+)
+
+// LoginGuardConfig tunes the brute-force protection of password logins.
+type LoginGuardConfig struct {
+	// MaxFailures consecutive failures for an email lock the account
+	MaxFailures int
+	// MaxIPFailures consecutive failures from one IP lock that IP out
+	MaxIPFailures int
+	// BaseDelay is the wait imposed after the first failure, doubled on
+	// every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutDuration is how long a locked email or IP stays locked
+	LockoutDuration time.Duration
+	// FailureWindow resets the counter when the last failure is older
+	FailureWindow time.Duration
+}
+
+func NewLoginGuardConfig(cfg config.LoginConfig) LoginGuardConfig {
+	return LoginGuardConfig{
+		MaxFailures:     cfg.MaxFailures,
+		MaxIPFailures:   cfg.MaxIPFailures,
+		BaseDelay:       time.Duration(cfg.BaseDelay),
+		MaxDelay:        time.Duration(cfg.MaxDelay),
+		LockoutDuration: time.Duration(cfg.LockoutDuration),
+		FailureWindow:   time.Duration(cfg.FailureWindow),
+	}
+}
+
+// LockoutNotifier is told when an account gets locked, e.g. to email its owner.
+type LockoutNotifier interface {
+	AccountLocked(ctx context.Context, email string, until time.Time)
+}
+
+// LogLockoutNotifier only writes lockouts to the log.
+type LogLockoutNotifier struct{}
+
+func (LogLockoutNotifier) AccountLocked(ctx context.Context, email string, until time.Time) {
+	logger.WarnCtx(ctx, "account %s locked until %s after repeated failed logins", email, until.Format(time.RFC3339))
+}
+
+// JobLockoutNotifier queues the lockout email as a background job, sent by
+// the handler of models.JobLockoutEmail.
+type JobLockoutNotifier struct {
+	jobs repository.JobRepository
+}
+
+func NewJobLockoutNotifier(jobs repository.JobRepository) *JobLockoutNotifier {
+	return &JobLockoutNotifier{jobs: jobs}
+}
+
+func (n *JobLockoutNotifier) AccountLocked(ctx context.Context, email string, until time.Time) {
+	job, err := models.NewJob(models.JobLockoutEmail, models.LockoutEmailJob{Email: email, Until: until})
+	if err == nil {
+		err = n.jobs.Enqueue(ctx, job)
+	}
+	if err != nil {
+		logger.ErrorCtx(ctx, "could not queue the lockout email of %s: %v", email, err)
+	}
+}
+
+// LoginThrottledError is the cause of the 429 returned while a login is
+// throttled, it tells the client when to retry.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("login throttled, retry after %s", e.RetryAfter)
+}
+
+type LoginGuard interface {
+	Check(ctx context.Context, email, ip string) error
+	RecordFailure(ctx context.Context, email, ip string)
+	RecordSuccess(ctx context.Context, email string)
+}
+
+type LoginGuardImpl struct {
+	store    repository.LoginAttemptStore
+	notifier LockoutNotifier
+	config   LoginGuardConfig
+	now      func() time.Time
+}
+
+func NewLoginGuard(store repository.LoginAttemptStore, notifier LockoutNotifier, config LoginGuardConfig) LoginGuard {
+	if notifier == nil {
+		notifier = LogLockoutNotifier{}
+	}
+	return &LoginGuardImpl{
+		store:    store,
+		notifier: notifier,
+		config:   config,
+		now:      time.Now,
+	}
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a 429 AppError when the email or IP is locked or still
+// within its backoff delay.
+func (g *LoginGuardImpl) Check(ctx context.Context, email, ip string) error {
+	now := g.now()
+	var wait time.Duration
+	for _, key := range []string{emailKey(email), ipKey(ip)} {
+		attempt, err := g.store.GetLoginAttempt(ctx, key)
+		if err != nil {
+			// Fail open, an unavailable store must not block every login
+			logger.ErrorCtx(ctx, "login guard could not read %s: %v", key, err)
+			continue
+		}
+		if attempt == nil {
+			continue
+		}
+		wait = max(wait, g.retryAfter(attempt, now))
+	}
+
+	if wait > 0 {
+		return errors.Wrap(http.StatusTooManyRequests, "too many failed login attempts, try again later", &LoginThrottledError{RetryAfter: wait})
+	}
+	return nil
+}
+
+func (g *LoginGuardImpl) retryAfter(attempt *models.LoginAttempt, now time.Time) time.Duration {
+	if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+		return attempt.LockedUntil.Sub(now)
+	}
+	if attempt.Failures == 0 || attempt.LastFailureAt.Before(now.Add(-g.config.FailureWindow)) {
+		return 0
+	}
+
+	delay := g.config.MaxDelay
+	if shift := attempt.Failures - 1; shift < 30 {
+		delay = min(g.config.BaseDelay<<shift, g.config.MaxDelay)
+	}
+	return max(attempt.LastFailureAt.Add(delay).Sub(now), 0)
+}
+
+func (g *LoginGuardImpl) RecordFailure(ctx context.Context, email, ip string) {
+	now := g.now()
+	windowStart := now.Add(-g.config.FailureWindow)
+
+	if attempt, err := g.store.RecordFailure(ctx, emailKey(email), now, windowStart); err != nil {
+		logger.ErrorCtx(ctx, "login guard could not record failure for %s: %v", email, err)
+	} else if attempt.Failures >= g.config.MaxFailures {
+		until := now.Add(g.config.LockoutDuration)
+		if err := g.store.LockUntil(ctx, attempt.Key, until); err != nil {
+			logger.ErrorCtx(ctx, "login guard could not lock %s: %v", email, err)
+		} else if attempt.Failures == g.config.MaxFailures {
+			// Notify once per lockout, not on every attempt made while locked
+			g.notifier.AccountLocked(ctx, email, until)
+		}
+	}
+
+	if attempt, err := g.store.RecordFailure(ctx, ipKey(ip), now, windowStart); err != nil {
+		logger.ErrorCtx(ctx, "login guard could not record failure for ip %s: %v", ip, err)
+	} else if attempt.Failures >= g.config.MaxIPFailures {
+		if err := g.store.LockUntil(ctx, attempt.Key, now.Add(g.config.LockoutDuration)); err != nil {
+			logger.ErrorCtx(ctx, "login guard could not lock ip %s: %v", ip, err)
+		}
+	}
+}
+
+// RecordSuccess clears the email counter. The IP counter is left to expire on
+// its own so a valid account cannot be used to reset it.
+func (g *LoginGuardImpl) RecordSuccess(ctx context.Context, email string) {
+	if err := g.store.ResetLoginAttempts(ctx, emailKey(email)); err != nil {
+		logger.ErrorCtx(ctx, "login guard could not reset %s: %v", email, err)
+	}
+}
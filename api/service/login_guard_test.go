@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+)
+
+var testGuardConfig = LoginGuardConfig{
+	MaxFailures:     3,
+	MaxIPFailures:   5,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutDuration: 15 * time.Minute,
+	FailureWindow:   30 * time.Minute,
+}
+
+func TestLoginGuardRetryAfter(t *testing.T) {
+	g := &LoginGuardImpl{config: testGuardConfig}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	tests := []struct {
+		name    string
+		attempt models.LoginAttempt
+		want    time.Duration
+	}{
+		{"no failure", models.LoginAttempt{}, 0},
+		{"first failure", models.LoginAttempt{Failures: 1, LastFailureAt: now}, time.Second},
+		{"first failure partly waited", models.LoginAttempt{Failures: 1, LastFailureAt: now.Add(-400 * time.Millisecond)}, 600 * time.Millisecond},
+		{"delay doubles", models.LoginAttempt{Failures: 3, LastFailureAt: now}, 4 * time.Second},
+		{"delay capped", models.LoginAttempt{Failures: 8, LastFailureAt: now}, time.Minute},
+		{"shift too large to compute", models.LoginAttempt{Failures: 40, LastFailureAt: now}, time.Minute},
+		{"delay over", models.LoginAttempt{Failures: 3, LastFailureAt: now.Add(-10 * time.Second)}, 0},
+		{"failure outside the window", models.LoginAttempt{Failures: 2, LastFailureAt: now.Add(-31 * time.Minute)}, 0},
+		{"locked", models.LoginAttempt{Failures: 3, LastFailureAt: now, LockedUntil: at(15 * time.Minute)}, 15 * time.Minute},
+		{"lock over", models.LoginAttempt{Failures: 3, LastFailureAt: now.Add(-20 * time.Minute), LockedUntil: at(-5 * time.Minute)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.retryAfter(&tt.attempt, now); got != tt.want {
+				t.Fatalf("retryAfter = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type countingNotifier struct {
+	locked []string
+}
+
+func (n *countingNotifier) AccountLocked(ctx context.Context, email string, until time.Time) {
+	n.locked = append(n.locked, email)
+}
+
+// throttledFor returns the wait of the 429 returned by Check, zero when the
+// login is allowed.
+func throttledFor(t *testing.T, err error) time.Duration {
+	t.Helper()
+	if err == nil {
+		return 0
+	}
+	var throttled *LoginThrottledError
+	appErr, ok := errors.IsAppError(err)
+	if !ok || appErr.Code != http.StatusTooManyRequests || !stderrors.As(err, &throttled) {
+		t.Fatalf("Check err = %v, want a throttled 429", err)
+	}
+	return throttled.RetryAfter
+}
+
+func TestLoginGuardLocksOut(t *testing.T) {
+	ctx := context.Background()
+	notifier := &countingNotifier{}
+	g := NewLoginGuard(repository.NewMemoryLoginAttemptStore(), notifier, testGuardConfig).(*LoginGuardImpl)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+
+	// Each step records a failure then checks the email from another IP
+	steps := []struct {
+		advance time.Duration
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{time.Second, 2 * time.Second},
+		{2 * time.Second, 15 * time.Minute},
+		// Failing while locked extends the lock but notifies once
+		{time.Minute, 15 * time.Minute},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		g.RecordFailure(ctx, "Ada@Example.com", "198.51.100.1")
+		if got := throttledFor(t, g.Check(ctx, "ada@example.com", "203.0.113.1")); got != step.want {
+			t.Fatalf("step %d: throttled for %s, want %s", i, got, step.want)
+		}
+	}
+	if len(notifier.locked) != 1 {
+		t.Fatalf("notified %d times, want once", len(notifier.locked))
+	}
+
+	now = now.Add(15 * time.Minute)
+	if err := g.Check(ctx, "ada@example.com", "203.0.113.1"); err != nil {
+		t.Fatalf("Check after the lockout: %v", err)
+	}
+
+	// The IP made 4 failures, a 5th locks it out for every email
+	now = now.Add(time.Second)
+	g.RecordFailure(ctx, "grace@example.com", "198.51.100.1")
+	g.RecordSuccess(ctx, "grace@example.com")
+	if got := throttledFor(t, g.Check(ctx, "someone@example.com", "198.51.100.1")); got != 15*time.Minute {
+		t.Fatalf("IP throttled for %s, want the lockout", got)
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+)
+
+// RateLimitBucketPurger deletes the buckets nobody used for idleAfter, the
+// longest limit period, by when they are full again and the same as no
+// bucket. It runs as the purge.rate_limit_buckets job.
+type RateLimitBucketPurger struct {
+	store     repository.RateLimitStore
+	idleAfter time.Duration
+}
+
+func NewRateLimitBucketPurger(store repository.RateLimitStore, idleAfter time.Duration) *RateLimitBucketPurger {
+	return &RateLimitBucketPurger{store: store, idleAfter: idleAfter}
+}
+
+func (p *RateLimitBucketPurger) PurgeOnce(ctx context.Context) error {
+	purged, err := p.store.DeleteIdle(ctx, time.Now().Add(-p.idleAfter))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.DebugCtx(ctx, "deleted %d idle rate limit bucket(s)", purged)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+)
+
+func TestRateLimitBucketPurgerKeepsRecentBuckets(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryRateLimitStore()
+	limit := models.RateLimit{Requests: 1, Period: time.Hour}
+	now := time.Now()
+	if _, err := store.Take(ctx, "idle", limit, now.Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Take(ctx, "recent", limit, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewRateLimitBucketPurger(store, limit.Period).PurgeOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The recent bucket is still empty, the idle one was full anyway
+	if result, _ := store.Take(ctx, "recent", limit, now); result.Allowed {
+		t.Fatal("purge refilled a bucket in use")
+	}
+	// Only the idle bucket was last used before now
+	if deleted, _ := store.DeleteIdle(ctx, now); deleted != 0 {
+		t.Fatal("the idle bucket was not purged")
+	}
+}
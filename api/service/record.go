@@ -1,56 +1,156 @@
 package service
 
 import (
+	"context"
+	"time"
+
 	"github.com/aq-simei/coin-pilot/api/models"
 	"github.com/aq-simei/coin-pilot/api/repository"
-	"github.com/gin-gonic/gin"
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
 )
 
 type RecordService interface {
-	GetRecords(ctx *gin.Context, userID string) ([]models.Record, error)
-	CreateRecord(ctx *gin.Context, record models.CreateRecordPayload, userID string) (*models.CreateRecordPayload, error)
-	UpdateRecord(ctx *gin.Context, id string, record models.Record) (*models.Record, error)
-	DeleteRecord(ctx *gin.Context, id string) error
+	GetRecords(ctx context.Context, scope models.LedgerScope) ([]models.Record, error)
+	GetRecord(ctx context.Context, scope models.LedgerScope, id string) (*models.Record, error)
+	CreateRecord(ctx context.Context, actor models.RecordActor, record models.CreateRecordPayload) (*models.Record, error)
+	UpdateRecord(ctx context.Context, actor models.RecordActor, id string, version int64, record models.UpdateRecordPayload) (*models.Record, error)
+	DeleteRecord(ctx context.Context, actor models.RecordActor, id string) error
+	ListTrash(ctx context.Context, scope models.LedgerScope, filter models.TrashFilter) (*models.Page[models.Record], error)
+	RestoreRecord(ctx context.Context, actor models.RecordActor, id string) error
+	PurgeRecord(ctx context.Context, actor models.RecordActor, id string) error
+	GetRecordHistory(ctx context.Context, scope models.LedgerScope, id string, filter models.RecordHistoryFilter) (*models.Page[models.RecordHistory], error)
+	Bulk(ctx context.Context, actor models.RecordActor, request models.BulkRequest) (*models.BulkResponse, error)
+	Changes(ctx context.Context, scope models.LedgerScope, filter models.SyncFilter) (*models.SyncPage, error)
+	Upload(ctx context.Context, actor models.RecordActor, request models.SyncUploadRequest) (*models.SyncUploadResponse, error)
 }
 
 type RecordServiceImpl struct {
 	repository repository.RecordRepository
+	// syncWindow is how long deletions are remembered, older sync tokens
+	// must start over
+	syncWindow time.Duration
 }
 
-func NewRecordService(repository repository.RecordRepository) RecordService {
+func NewRecordService(repository repository.RecordRepository, syncWindow time.Duration) RecordService {
 	return &RecordServiceImpl{
 		repository: repository,
+		syncWindow: syncWindow,
 	}
 }
 
-func (s *RecordServiceImpl) GetRecords(ctx *gin.Context, userID string) ([]models.Record, error) {
-	records, err := s.repository.GetRecords(userID)
+func (s *RecordServiceImpl) GetRecords(ctx context.Context, scope models.LedgerScope) (records []models.Record, err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.GetRecords")
+	defer func() { tracing.End(span, err) }()
+
+	records, err = s.repository.GetRecords(ctx, scope)
 	if err != nil {
 		return nil, err
 	}
 	return records, nil
 }
 
-func (s *RecordServiceImpl) CreateRecord(ctx *gin.Context, record models.CreateRecordPayload, userID string) (*models.CreateRecordPayload, error) {
-	createdRecord, err := s.repository.CreateRecord(record, userID)
+func (s *RecordServiceImpl) GetRecord(ctx context.Context, scope models.LedgerScope, id string) (_ *models.Record, err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.GetRecord")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repository.GetRecord(ctx, scope, id)
+}
+
+func (s *RecordServiceImpl) CreateRecord(ctx context.Context, actor models.RecordActor, record models.CreateRecordPayload) (_ *models.Record, err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.CreateRecord")
+	defer func() { tracing.End(span, err) }()
+
+	createdRecord, err := s.repository.CreateRecord(ctx, actor, record)
 	if err != nil {
 		return nil, err
 	}
+	metrics.RecordsCreated.Inc()
 	return createdRecord, nil
 }
 
-func (s *RecordServiceImpl) UpdateRecord(ctx *gin.Context, id string, record models.Record) (*models.Record, error) {
-	updatedRecord, err := s.repository.UpdateRecord(id, record)
+// UpdateRecord replaces the record, failing with a 412 when it is no longer
+// at version. A version of 0 skips the check.
+func (s *RecordServiceImpl) UpdateRecord(
+	ctx context.Context,
+	actor models.RecordActor,
+	id string,
+	version int64,
+	record models.UpdateRecordPayload,
+) (_ *models.Record, err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.UpdateRecord")
+	defer func() { tracing.End(span, err) }()
+
+	updatedRecord, err := s.repository.UpdateRecord(ctx, actor, id, version, record)
 	if err != nil {
 		return nil, err
 	}
 	return updatedRecord, nil
 }
 
-func (s *RecordServiceImpl) DeleteRecord(ctx *gin.Context, id string) error {
-	err := s.repository.DeleteRecord(id)
+// DeleteRecord moves the record to the trash.
+func (s *RecordServiceImpl) DeleteRecord(ctx context.Context, actor models.RecordActor, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.DeleteRecord")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repository.DeleteRecord(ctx, actor, id)
+}
+
+func (s *RecordServiceImpl) ListTrash(ctx context.Context, scope models.LedgerScope, filter models.TrashFilter) (_ *models.Page[models.Record], err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.ListTrash")
+	defer func() { tracing.End(span, err) }()
+
+	records, total, err := s.repository.ListTrash(ctx, scope, filter)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if records == nil {
+		records = []models.Record{}
+	}
+	page, pageSize := models.NormalizePage(filter.Page, filter.PageSize)
+	return &models.Page[models.Record]{
+		Items:    records,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (s *RecordServiceImpl) RestoreRecord(ctx context.Context, actor models.RecordActor, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.RestoreRecord")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repository.RestoreRecord(ctx, actor, id)
+}
+
+// PurgeRecord permanently deletes a record from the trash.
+func (s *RecordServiceImpl) PurgeRecord(ctx context.Context, actor models.RecordActor, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.PurgeRecord")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repository.PurgeRecord(ctx, actor, id)
+}
+
+// GetRecordHistory lists the changes made to a record, newest first. The
+// history outlives the record, so purged records still have one.
+func (s *RecordServiceImpl) GetRecordHistory(
+	ctx context.Context,
+	scope models.LedgerScope,
+	id string,
+	filter models.RecordHistoryFilter,
+) (_ *models.Page[models.RecordHistory], err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.GetRecordHistory")
+	defer func() { tracing.End(span, err) }()
+
+	entries, total, err := s.repository.ListRecordHistory(ctx, scope, id, filter)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	page, pageSize := models.NormalizePage(filter.Page, filter.PageSize)
+	return &models.Page[models.RecordHistory]{
+		Items:    entries,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
 }
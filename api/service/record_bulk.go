@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
+)
+
+// Bulk applies a list of operations, or a patch to the records matching a
+// filter. When an atomic request is rolled back the response is returned
+// along with the 422 so the client can see which operation failed.
+func (s *RecordServiceImpl) Bulk(
+	ctx context.Context,
+	actor models.RecordActor,
+	request models.BulkRequest,
+) (_ *models.BulkResponse, err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.Bulk")
+	defer func() { tracing.End(span, err) }()
+
+	if request.Mode == "" {
+		request.Mode = models.BulkAtomic
+	}
+	if err := validateBulk(request); err != nil {
+		return nil, err
+	}
+
+	var results []models.BulkResult
+	if len(request.Operations) > 0 {
+		results, err = s.repository.ApplyBulk(ctx, actor, request.Operations, request.Mode)
+	} else {
+		results, err = s.repository.PatchMatching(ctx, actor, *request.Filter, *request.Patch, request.Mode)
+	}
+	if results == nil {
+		if err != nil {
+			return nil, err
+		}
+		results = []models.BulkResult{}
+	}
+
+	response := &models.BulkResponse{Mode: request.Mode, Results: results}
+	created := 0
+	for _, result := range results {
+		if result.Status >= http.StatusBadRequest {
+			response.Failed++
+			continue
+		}
+		response.Succeeded++
+		if result.Op == models.BulkCreate {
+			created++
+		}
+	}
+	if err == nil {
+		metrics.RecordsCreated.Add(float64(created))
+	}
+	return response, err
+}
+
+func validateBulk(request models.BulkRequest) error {
+	if request.Mode != models.BulkAtomic && request.Mode != models.BulkBestEffort {
+		return errors.NewBadRequest(fmt.Sprintf("mode must be %q or %q", models.BulkAtomic, models.BulkBestEffort))
+	}
+	hasPatch := request.Filter != nil || request.Patch != nil
+	if len(request.Operations) > 0 && hasPatch {
+		return errors.NewBadRequest("send either operations or a filter and a patch, not both")
+	}
+	if !hasPatch {
+		if len(request.Operations) == 0 {
+			return errors.NewBadRequest("operations, or a filter and a patch, are required")
+		}
+		if len(request.Operations) > models.MaxBulkItems {
+			return errors.NewBadRequest(fmt.Sprintf("at most %d operations per request", models.MaxBulkItems))
+		}
+		for i, op := range request.Operations {
+			if err := validateBulkOperation(op); err != nil {
+				return errors.NewBadRequest(fmt.Sprintf("operation %d: %s", i, err))
+			}
+		}
+		return nil
+	}
+	if request.Filter == nil || request.Filter.IsEmpty() {
+		return errors.NewBadRequest("filter must set at least one field")
+	}
+	if request.Patch == nil || request.Patch.IsEmpty() {
+		return errors.NewBadRequest("patch must change something")
+	}
+	return nil
+}
+
+func validateBulkOperation(op models.BulkOperation) error {
+	switch op.Op {
+	case models.BulkCreate:
+		if op.Record == nil {
+			return fmt.Errorf("record is required")
+		}
+	case models.BulkUpdate:
+		if op.ID == "" || op.Record == nil {
+			return fmt.Errorf("id and record are required")
+		}
+		if op.Version < 1 {
+			return fmt.Errorf("version is required")
+		}
+	case models.BulkDelete:
+		if op.ID == "" {
+			return fmt.Errorf("id is required")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
+)
+
+// Changes returns the records created, updated or deleted since the sync
+// token, or every record when there is none.
+func (s *RecordServiceImpl) Changes(ctx context.Context, scope models.LedgerScope, filter models.SyncFilter) (_ *models.SyncPage, err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.Changes")
+	defer func() { tracing.End(span, err) }()
+
+	var cursor models.SyncCursor
+	if filter.Token != "" {
+		if cursor, err = decodeSyncToken(filter.Token); err != nil {
+			return nil, errors.NewBadRequest("invalid sync token")
+		}
+		if cursor.LedgerID != "" && cursor.LedgerID != scope.LedgerID {
+			return nil, errors.NewBadRequest("sync token belongs to another ledger")
+		}
+		if !cursor.Since.IsZero() && time.Since(cursor.Since) > s.syncWindow {
+			return nil, errors.New(http.StatusGone, "sync token expired, sync again without a token")
+		}
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = models.DefaultSyncPageSize
+	}
+	limit = min(limit, models.MaxSyncPageSize)
+
+	changes, next, hasMore, err := s.repository.ListChanges(ctx, scope, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	next.LedgerID = scope.LedgerID
+	return &models.SyncPage{Changes: changes, NextToken: encodeSyncToken(next), HasMore: hasMore}, nil
+}
+
+// Upload applies changes made offline, see models.SyncStrategy for what
+// happens to a change made on an outdated record.
+func (s *RecordServiceImpl) Upload(
+	ctx context.Context,
+	actor models.RecordActor,
+	request models.SyncUploadRequest,
+) (_ *models.SyncUploadResponse, err error) {
+	ctx, span := tracing.Start(ctx, "RecordService.Upload")
+	defer func() { tracing.End(span, err) }()
+
+	if request.Strategy == "" {
+		request.Strategy = models.SyncReportConflicts
+	}
+	if request.Strategy != models.SyncReportConflicts && request.Strategy != models.SyncLastWriterWins {
+		return nil, errors.NewBadRequest(fmt.Sprintf("strategy must be %q or %q", models.SyncReportConflicts, models.SyncLastWriterWins))
+	}
+	if len(request.Changes) > models.MaxBulkItems {
+		return nil, errors.NewBadRequest(fmt.Sprintf("at most %d changes per request", models.MaxBulkItems))
+	}
+	for i, change := range request.Changes {
+		if !change.Deleted && change.Record == nil {
+			return nil, errors.NewBadRequest(fmt.Sprintf("change %d: record is required unless deleted", i))
+		}
+	}
+
+	results, err := s.repository.ApplySyncUploads(ctx, actor, request.Changes, request.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	created := 0
+	for _, result := range results {
+		// Every update bumps the version, only new records are at 1
+		if result.Status == models.SyncApplied && result.Record != nil && result.Record.Version == 1 {
+			created++
+		}
+	}
+	metrics.RecordsCreated.Add(float64(created))
+	return &models.SyncUploadResponse{Strategy: request.Strategy, Results: results}, nil
+}
+
+// Sync tokens are opaque to clients, they are the cursor encoded as JSON.
+func encodeSyncToken(cursor models.SyncCursor) string {
+	content, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func decodeSyncToken(token string) (models.SyncCursor, error) {
+	var cursor models.SyncCursor
+	content, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(content, &cursor); err != nil {
+		return cursor, err
+	}
+	if cursor.Xid == "" {
+		return cursor, fmt.Errorf("sync token without a position")
+	}
+	for _, c := range cursor.Xid + cursor.Watermark {
+		if c < '0' || c > '9' {
+			return cursor, fmt.Errorf("invalid transaction id in sync token")
+		}
+	}
+	return cursor, nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+)
+
+func TestSyncTokenRoundTrip(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 123456789, time.UTC)
+	tests := []struct {
+		name   string
+		cursor models.SyncCursor
+	}{
+		{"first page of a full sync", models.SyncCursor{Xid: "0", RoundStart: start}},
+		{"within a round", models.SyncCursor{LedgerID: "ledger", Xid: "9001", ID: "0b6c5e2e-5f1c-4f5e-9a43-2d1f6f9d8a10", Watermark: "8990", RoundStart: start}},
+		{"next round", models.SyncCursor{LedgerID: "ledger", Since: start.Add(-time.Hour), Xid: "18446744073709551615", Watermark: "18446744073709551615", RoundStart: start}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := encodeSyncToken(tt.cursor)
+			got, err := decodeSyncToken(token)
+			if err != nil {
+				t.Fatalf("decodeSyncToken(%q): %v", token, err)
+			}
+			if got.LedgerID != tt.cursor.LedgerID || got.Xid != tt.cursor.Xid || got.ID != tt.cursor.ID || got.Watermark != tt.cursor.Watermark ||
+				!got.Since.Equal(tt.cursor.Since) || !got.RoundStart.Equal(tt.cursor.RoundStart) {
+				t.Fatalf("decoded %+v, want %+v", got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeSyncTokenRejects(t *testing.T) {
+	encode := func(content string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(content))
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"xid":"1"}`))},
+		{"not JSON", encode("xid=1")},
+		{"no position", encode(`{"id":"x"}`)},
+		{"xid not a number", encode(`{"xid":"1 OR 1=1"}`)},
+		{"negative xid", encode(`{"xid":"-1"}`)},
+		{"watermark not a number", encode(`{"xid":"1","watermark":"1e9"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := decodeSyncToken(tt.token); err == nil {
+				t.Fatalf("decodeSyncToken(%q) = %+v, want an error", tt.token, cursor)
+			}
+		})
+	}
+}
+
+// stubChanges answers ListChanges with an empty page, the methods not
+// overridden are not used.
+type stubChanges struct {
+	repository.RecordRepository
+}
+
+func (stubChanges) ListChanges(ctx context.Context, scope models.LedgerScope, cursor models.SyncCursor, limit int) ([]models.SyncChange, models.SyncCursor, bool, error) {
+	return nil, models.SyncCursor{Xid: "42", RoundStart: time.Now()}, false, nil
+}
+
+func TestChangesChecksTheToken(t *testing.T) {
+	s := NewRecordService(stubChanges{}, 24*time.Hour)
+	scope := models.LedgerScope{LedgerID: "ledger", UserID: "user"}
+	tests := []struct {
+		name   string
+		cursor models.SyncCursor
+		want   int
+	}{
+		{"token of the ledger", models.SyncCursor{LedgerID: "ledger", Since: time.Now().Add(-time.Hour), Xid: "1"}, http.StatusOK},
+		{"token of another ledger", models.SyncCursor{LedgerID: "other", Xid: "1"}, http.StatusBadRequest},
+		{"token older than the sync window", models.SyncCursor{LedgerID: "ledger", Since: time.Now().Add(-25 * time.Hour), Xid: "1"}, http.StatusGone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.Changes(context.Background(), scope, models.SyncFilter{Token: encodeSyncToken(tt.cursor)})
+			if tt.want == http.StatusOK {
+				if err != nil {
+					t.Fatalf("Changes: %v", err)
+				}
+				// The next token is bound to the ledger it was issued for
+				next, err := decodeSyncToken(page.NextToken)
+				if err != nil || next.LedgerID != "ledger" || next.Xid != "42" {
+					t.Fatalf("next token decodes to %+v (%v)", next, err)
+				}
+				return
+			}
+			appErr, ok := errors.IsAppError(err)
+			if !ok || appErr.Code != tt.want {
+				t.Fatalf("Changes err = %v, want %d", err, tt.want)
+			}
+		})
+	}
+	if _, err := s.Changes(context.Background(), scope, models.SyncFilter{Token: "garbage"}); err == nil {
+		t.Fatal("Changes accepted a garbage token")
+	}
+}
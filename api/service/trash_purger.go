@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+)
+
+// TrashPurger permanently deletes records that stayed in the trash longer
+// than the retention period, and forgets the tombstones of purged records
+// once no valid sync token can need them. It runs as the purge.trash job.
+type TrashPurger struct {
+	repository         repository.RecordRepository
+	retention          time.Duration
+	tombstoneRetention time.Duration
+}
+
+func NewTrashPurger(repository repository.RecordRepository, retention, tombstoneRetention time.Duration) *TrashPurger {
+	return &TrashPurger{
+		repository:         repository,
+		retention:          retention,
+		tombstoneRetention: tombstoneRetention,
+	}
+}
+
+func (p *TrashPurger) PurgeOnce(ctx context.Context) error {
+	purged, err := p.repository.PurgeDeletedBefore(ctx, time.Now().Add(-p.retention))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.InfoCtx(ctx, "purged %d record(s) trashed more than %s ago", purged, p.retention)
+	}
+
+	forgotten, err := p.repository.PurgeTombstonesBefore(ctx, time.Now().Add(-p.tombstoneRetention))
+	if err != nil {
+		return err
+	}
+	if forgotten > 0 {
+		logger.DebugCtx(ctx, "deleted %d record tombstone(s)", forgotten)
+	}
+	return nil
+}
@@ -8,26 +8,40 @@ import (
 	"github.com/aq-simei/coin-pilot/api/repository"
 	errors "github.com/aq-simei/coin-pilot/internal/config/error"
 	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
 )
 
+// loginMethodPassword labels email and password logins in the login metrics.
+const loginMethodPassword = "password"
+
 type UserService interface {
 	GetUser(ctx context.Context, id string) (any, error)
 	CreateUser(ctx context.Context, userPayload models.CreateUserPayload) error
 	UpdateUser(ctx context.Context, id string, userPayload models.UpdateUserPayload) error
-	DeleteUser(ctx context.Context, id string) error
-	Login(ctx context.Context, email, password string) (string, error)
+	UpdateProfile(ctx context.Context, id string, profilePayload models.UpdateProfilePayload) error
+	ChangePassword(ctx context.Context, id string, passwordPayload models.ChangePasswordPayload) error
+	// DeleteUser deletes the account id on behalf of deletedBy, the user
+	// themself or an admin.
+	DeleteUser(ctx context.Context, deletedBy, id string) error
+	Login(ctx context.Context, email, password, ip string) (string, error)
 	Logout(ctx context.Context, claims any) error
 }
 
 type UserServiceImpl struct {
-	repo repository.UserRepository
+	repo  repository.UserRepository
+	guard LoginGuard
+	jwt   *security.JWTManager
 }
 
-func NewUserService(repo repository.UserRepository) UserService {
-	return &UserServiceImpl{repo: repo}
+func NewUserService(repo repository.UserRepository, guard LoginGuard, jwt *security.JWTManager) UserService {
+	return &UserServiceImpl{repo: repo, guard: guard, jwt: jwt}
 }
 
-func (s *UserServiceImpl) GetUser(ctx context.Context, id string) (any, error) {
+func (s *UserServiceImpl) GetUser(ctx context.Context, id string) (_ any, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUser")
+	defer func() { tracing.End(span, err) }()
+
 	user, err := s.repo.GetUser(ctx, id)
 	if err != nil {
 		// check if it is a AppError
@@ -39,67 +53,137 @@ func (s *UserServiceImpl) GetUser(ctx context.Context, id string) (any, error) {
 			// If it's another type of error, return it as is
 			return nil, errors.Wrap(appErr.Code, appErr.Message, err)
 		}
-	}
-	userResponse := &models.UserResponse{
-		ID:        user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Records:   user.Records,
-	}
-
-	if err != nil {
 		return nil, err
 	}
 
-	return userResponse, nil
+	return toUserResponse(user), nil
 }
 
 func (s *UserServiceImpl) CreateUser(ctx context.Context, userPayload models.CreateUserPayload,
-) error {
+) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer func() { tracing.End(span, err) }()
+
 	return s.repo.CreateUser(ctx, userPayload)
 }
 
 func (s *UserServiceImpl) UpdateUser(ctx context.Context, id string, userPayload models.UpdateUserPayload,
-) error {
-	err := s.repo.UpdateUser(ctx, id, userPayload)
+) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer func() { tracing.End(span, err) }()
+
+	if userPayload.Role != nil && !userPayload.Role.IsValid() {
+		return errors.NewBadRequest("unknown role")
+	}
+	err = s.repo.UpdateUser(ctx, id, userPayload)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *UserServiceImpl) DeleteUser(ctx context.Context, id string) error {
-	err := s.repo.DeleteUser(ctx, id)
+func (s *UserServiceImpl) UpdateProfile(ctx context.Context, id string, profilePayload models.UpdateProfilePayload,
+) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateProfile")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.UpdateUser(ctx, id, models.UpdateUserPayload{
+		Name:  profilePayload.Name,
+		Email: profilePayload.Email,
+	})
+}
+
+func (s *UserServiceImpl) ChangePassword(ctx context.Context, id string, passwordPayload models.ChangePasswordPayload,
+) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ChangePassword")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := s.repo.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !security.CheckPassword(user.Password, passwordPayload.CurrentPassword) {
+		return errors.New(http.StatusUnauthorized, "current password is incorrect")
+	}
+
+	return s.repo.UpdateUser(ctx, id, models.UpdateUserPayload{
+		Password: &passwordPayload.NewPassword,
+	})
+}
+
+func (s *UserServiceImpl) DeleteUser(ctx context.Context, deletedBy, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer func() { tracing.End(span, err) }()
+
+	actor := models.RecordActor{Type: models.ActorUser, ID: deletedBy, Source: models.SourceAPI}
+	if deletedBy != id {
+		actor.Type = models.ActorAdmin
+	}
+	err = s.repo.DeleteUser(ctx, actor, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *UserServiceImpl) Login(ctx context.Context, email, password string) (string, error) {
+func (s *UserServiceImpl) Login(ctx context.Context, email, password, ip string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Login")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.guard.Check(ctx, email, ip); err != nil {
+		metrics.FailedLogins.WithLabelValues(loginMethodPassword, metrics.ReasonThrottled).Inc()
+		return "", err
+	}
+
 	user, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
 		if appErr, ok := err.(*errors.AppError); ok && appErr.Code == http.StatusNotFound {
+			// Unknown emails count as failures too, so they cannot be probed freely
+			s.guard.RecordFailure(ctx, email, ip)
+			metrics.FailedLogins.WithLabelValues(loginMethodPassword, metrics.ReasonInvalidCredentials).Inc()
 			return "", errors.NewUnauthorized()
 		}
 		return "", errors.NewInternal("Failed to fetch user")
 	}
 
 	if !security.CheckPassword(user.Password, password) {
+		s.guard.RecordFailure(ctx, email, ip)
+		metrics.FailedLogins.WithLabelValues(loginMethodPassword, metrics.ReasonInvalidCredentials).Inc()
 		return "", errors.NewUnauthorized()
 	}
+	s.guard.RecordSuccess(ctx, email)
 
-	token, err := security.GenerateJWT(user.ID)
+	if user.Status == models.StatusSuspended {
+		metrics.FailedLogins.WithLabelValues(loginMethodPassword, metrics.ReasonSuspended).Inc()
+		return "", errors.New(http.StatusForbidden, "account is suspended")
+	}
+
+	token, err := s.jwt.GenerateJWT(user.ID, string(user.Role))
 	if err != nil {
 		return "", errors.NewInternal("Failed to generate token")
 	}
 
+	metrics.Logins.WithLabelValues(loginMethodPassword).Inc()
 	return token, nil
 }
 
-func (s *UserServiceImpl) Logout(ctx context.Context, claims any) error {
+func (s *UserServiceImpl) Logout(ctx context.Context, claims any) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Logout")
+	defer func() { tracing.End(span, err) }()
+
 	// Implement token invalidation logic if needed (e.g., blacklist the token)
 	return nil
 }
+
+func toUserResponse(user *models.User) *models.UserResponse {
+	return &models.UserResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      user.Role,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
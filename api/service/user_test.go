@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+)
+
+// deletingUsers keeps the actor of the last deletion.
+type deletingUsers struct {
+	repository.UserRepository
+	actor models.RecordActor
+}
+
+func (r *deletingUsers) DeleteUser(ctx context.Context, actor models.RecordActor, id string) error {
+	r.actor = actor
+	return nil
+}
+
+func TestDeleteUserActor(t *testing.T) {
+	tests := []struct {
+		name      string
+		deletedBy string
+		want      models.ActorType
+	}{
+		{"own account", "ada", models.ActorUser},
+		{"by an admin", "grace", models.ActorAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &deletingUsers{}
+			if err := NewUserService(users, nil, nil).DeleteUser(context.Background(), tt.deletedBy, "ada"); err != nil {
+				t.Fatalf("DeleteUser: %v", err)
+			}
+			if users.actor.Type != tt.want || users.actor.ID != tt.deletedBy {
+				t.Fatalf("deleted as %s %s, want %s %s", users.actor.Type, users.actor.ID, tt.want, tt.deletedBy)
+			}
+		})
+	}
+}
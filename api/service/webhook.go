@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
+)
+
+type WebhookService interface {
+	ListWebhooks(ctx context.Context, userID string) ([]models.Webhook, error)
+	CreateWebhook(ctx context.Context, userID string, payload models.CreateWebhookPayload) (*models.WebhookSecretResponse, error)
+	GetWebhook(ctx context.Context, userID, id string) (*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, userID, id string, payload models.UpdateWebhookPayload) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, id string) error
+	RotateSecret(ctx context.Context, userID, id string) (*models.WebhookSecretResponse, error)
+	ListDeliveries(ctx context.Context, userID, webhookID string, filter models.WebhookDeliveryFilter) (*models.Page[models.WebhookDelivery], error)
+	GetDelivery(ctx context.Context, userID, webhookID, id string) (*models.WebhookDelivery, error)
+	Redeliver(ctx context.Context, userID, webhookID, id string) (*models.WebhookDelivery, error)
+}
+
+type WebhookServiceImpl struct {
+	repo repository.WebhookRepository
+	// allowPrivateAddresses accepts URLs of loopback and private hosts
+	allowPrivateAddresses bool
+}
+
+func NewWebhookService(repo repository.WebhookRepository, allowPrivateAddresses bool) WebhookService {
+	return &WebhookServiceImpl{repo: repo, allowPrivateAddresses: allowPrivateAddresses}
+}
+
+func (s *WebhookServiceImpl) ListWebhooks(ctx context.Context, userID string) (_ []models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.ListWebhooks")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.ListWebhooks(ctx, userID)
+}
+
+// CreateWebhook registers the endpoint, the secret signing its deliveries
+// is only returned here and on rotation.
+func (s *WebhookServiceImpl) CreateWebhook(
+	ctx context.Context,
+	userID string,
+	payload models.CreateWebhookPayload,
+) (_ *models.WebhookSecretResponse, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.CreateWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.validateWebhookURL(payload.URL); err != nil {
+		return nil, err
+	}
+	events, err := webhookEvents(payload.Events)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := security.GenerateWebhookSecret()
+	if err != nil {
+		return nil, errors.Wrap(http.StatusInternalServerError, "failed to generate webhook secret", err)
+	}
+
+	webhook := &models.Webhook{
+		UserID:      userID,
+		URL:         payload.URL,
+		Description: payload.Description,
+		Events:      events,
+		Secret:      secret,
+		Active:      true,
+	}
+	if err := s.repo.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return &models.WebhookSecretResponse{Webhook: *webhook, Secret: secret}, nil
+}
+
+func (s *WebhookServiceImpl) GetWebhook(ctx context.Context, userID, id string) (_ *models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.GetWebhook(ctx, userID, id)
+}
+
+// UpdateWebhook changes the fields set in the payload. Deliveries queued
+// while a webhook is inactive are sent once it is active again.
+func (s *WebhookServiceImpl) UpdateWebhook(
+	ctx context.Context,
+	userID, id string,
+	payload models.UpdateWebhookPayload,
+) (_ *models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.UpdateWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	webhook, err := s.repo.GetWebhook(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if payload.URL != nil {
+		if err := s.validateWebhookURL(*payload.URL); err != nil {
+			return nil, err
+		}
+		webhook.URL = *payload.URL
+	}
+	if payload.Description != nil {
+		webhook.Description = *payload.Description
+	}
+	if payload.Events != nil {
+		if webhook.Events, err = webhookEvents(payload.Events); err != nil {
+			return nil, err
+		}
+	}
+	if payload.Active != nil {
+		webhook.Active = *payload.Active
+	}
+	if err := s.repo.SaveWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookServiceImpl) DeleteWebhook(ctx context.Context, userID, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.DeleteWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.DeleteWebhook(ctx, userID, id)
+}
+
+// RotateSecret replaces the signing secret, deliveries sent from now on use
+// the new one.
+func (s *WebhookServiceImpl) RotateSecret(ctx context.Context, userID, id string) (_ *models.WebhookSecretResponse, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.RotateSecret")
+	defer func() { tracing.End(span, err) }()
+
+	webhook, err := s.repo.GetWebhook(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.Secret, err = security.GenerateWebhookSecret(); err != nil {
+		return nil, errors.Wrap(http.StatusInternalServerError, "failed to generate webhook secret", err)
+	}
+	if err := s.repo.SaveWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return &models.WebhookSecretResponse{Webhook: *webhook, Secret: webhook.Secret}, nil
+}
+
+func (s *WebhookServiceImpl) ListDeliveries(
+	ctx context.Context,
+	userID, webhookID string,
+	filter models.WebhookDeliveryFilter,
+) (_ *models.Page[models.WebhookDelivery], err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.ListDeliveries")
+	defer func() { tracing.End(span, err) }()
+
+	deliveries, total, err := s.repo.ListDeliveries(ctx, userID, webhookID, filter)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	page, pageSize := models.NormalizePage(filter.Page, filter.PageSize)
+	return &models.Page[models.WebhookDelivery]{
+		Items:    deliveries,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (s *WebhookServiceImpl) GetDelivery(ctx context.Context, userID, webhookID, id string) (_ *models.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetDelivery")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.GetDelivery(ctx, userID, webhookID, id)
+}
+
+// Redeliver sends the event of a delivery again, whatever its outcome was.
+func (s *WebhookServiceImpl) Redeliver(ctx context.Context, userID, webhookID, id string) (_ *models.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.Redeliver")
+	defer func() { tracing.End(span, err) }()
+
+	return s.repo.Redeliver(ctx, userID, webhookID, id)
+}
+
+// validateWebhookURL only accepts absolute http and https URLs of public
+// hosts. Host names are checked again on every delivery once resolved, see
+// security.WebhookDialControl.
+func (s *WebhookServiceImpl) validateWebhookURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return errors.NewBadRequest("url must be an absolute http or https URL")
+	}
+	if s.allowPrivateAddresses {
+		return nil
+	}
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.NewBadRequest("url must point to a public host")
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !security.IsPublicAddress(ip) {
+		return errors.NewBadRequest("url must point to a public host")
+	}
+	return nil
+}
+
+// webhookEvents checks the events and drops duplicates.
+func webhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, errors.NewBadRequest("subscribe to at least one event")
+	}
+	var unique []string
+	for _, event := range events {
+		if !models.IsValidWebhookEvent(event) {
+			return nil, errors.NewBadRequest("unknown event: " + event)
+		}
+		if !slices.Contains(unique, event) {
+			unique = append(unique, event)
+		}
+	}
+	return unique, nil
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	"github.com/aq-simei/coin-pilot/internal/config"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+)
+
+// Headers sent with every webhook delivery.
+const (
+	WebhookEventHeader     = "X-CoinPilot-Event"
+	WebhookDeliveryHeader  = "X-CoinPilot-Delivery"
+	WebhookSignatureHeader = "X-CoinPilot-Signature"
+)
+
+// maxResponseBody is how much of a webhook response is read, so the
+// connection can be reused. Responses are not stored, the delivery log
+// would let users read what internal services answer.
+const maxResponseBody = 1024
+
+type WebhookSenderConfig struct {
+	Timeout           time.Duration
+	Retry             RetryPolicy
+	DeliveryRetention time.Duration
+	// AllowPrivateAddresses lets webhooks reach addresses that are not
+	// public, see security.IsPublicAddress
+	AllowPrivateAddresses bool
+}
+
+func NewWebhookSenderConfig(cfg config.WebhooksConfig) WebhookSenderConfig {
+	return WebhookSenderConfig{
+		Timeout: time.Duration(cfg.Timeout),
+		Retry: RetryPolicy{
+			MaxAttempts: cfg.MaxAttempts,
+			BaseDelay:   time.Duration(cfg.RetryBaseDelay),
+			MaxDelay:    time.Duration(cfg.RetryMaxDelay),
+		},
+		DeliveryRetention:     time.Duration(cfg.DeliveryRetention),
+		AllowPrivateAddresses: cfg.AllowPrivateAddresses,
+	}
+}
+
+// WebhookSender sends webhook deliveries, each one from a job of the job
+// runner, which claims and retries it with the policy of the config.
+type WebhookSender struct {
+	repository repository.WebhookRepository
+	cfg        WebhookSenderConfig
+	client     *http.Client
+	now        func() time.Time
+}
+
+func NewWebhookSender(repository repository.WebhookRepository, cfg WebhookSenderConfig) *WebhookSender {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateAddresses {
+		// Checked on every connection, after DNS resolution
+		dialer.Control = security.WebhookDialControl
+	}
+	return &WebhookSender{
+		repository: repository,
+		cfg:        cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// No proxy, the dial check must see the address of the webhook
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: cfg.Timeout,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// A redirect is a failed delivery, the webhook URL must be fixed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now: time.Now,
+	}
+}
+
+func (d *WebhookSender) PurgeOnce(ctx context.Context) error {
+	purged, err := d.repository.PurgeDeliveriesBefore(ctx, d.now().Add(-d.cfg.DeliveryRetention))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.DebugCtx(ctx, "deleted %d webhook deliveries older than %s", purged, d.cfg.DeliveryRetention)
+	}
+	return nil
+}
+
+// Deliver is the handler of webhook.delivery jobs, it sends the delivery
+// once and stores the outcome. A failed attempt returns an error so the job
+// is retried, until the last attempt marks the delivery failed. A delivery
+// of a webhook deleted meanwhile is dropped, one of a webhook disabled
+// meanwhile fails.
+func (d *WebhookSender) Deliver(ctx context.Context, job models.Job) error {
+	var payload models.WebhookDeliveryJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return &PermanentJobError{Err: err}
+	}
+	delivery, err := d.repository.GetDeliveryToSend(ctx, payload.DeliveryID)
+	if err != nil {
+		if appErr, ok := errors.IsAppError(err); ok && appErr.Code == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	if delivery.Status != models.DeliveryPending {
+		return nil
+	}
+
+	var attempt models.DeliveryAttempt
+	if delivery.WebhookActive {
+		attempt = d.send(ctx, delivery)
+		// The runner claims the job again, the attempt is not counted
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	} else {
+		attempt.Error = "webhook is inactive"
+	}
+
+	now := d.now()
+	delivery.Attempts++
+	delivery.ResponseStatus = nil
+	if attempt.Status != 0 {
+		delivery.ResponseStatus = &attempt.Status
+	}
+	delivery.Error = attempt.Error
+	delivery.DurationMS = attempt.Duration.Milliseconds()
+
+	outcome := "retrying"
+	switch {
+	case attempt.Succeeded():
+		outcome = "succeeded"
+		delivery.Status = models.DeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case !delivery.WebhookActive || d.cfg.Retry.LastAttempt(job.Attempts):
+		outcome = "failed"
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		logger.WarnCtx(ctx, "webhook delivery %s failed after %d attempts", delivery.ID, delivery.Attempts)
+	default:
+		// The job runner retries with the same policy
+		next := now.Add(d.cfg.Retry.Delay(job.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+	metrics.WebhookDeliveries.WithLabelValues(outcome).Inc()
+
+	if err := d.repository.CompleteDelivery(ctx, delivery); err != nil {
+		return err
+	}
+	if outcome == "retrying" {
+		return fmt.Errorf("webhook delivery %s: %s", delivery.ID, attempt.Error)
+	}
+	return nil
+}
+
+// send POSTs the signed payload to the webhook.
+func (d *WebhookSender) send(ctx context.Context, delivery *models.WebhookDelivery) models.DeliveryAttempt {
+	body := []byte(delivery.Payload)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return models.DeliveryAttempt{Error: err.Error()}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "coin-pilot-webhooks")
+	request.Header.Set(WebhookEventHeader, delivery.Event)
+	request.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	request.Header.Set(WebhookSignatureHeader, security.SignWebhook(delivery.Secret, d.now(), body))
+
+	start := time.Now()
+	response, err := d.client.Do(request)
+	if err != nil {
+		return models.DeliveryAttempt{Error: err.Error(), Duration: time.Since(start)}
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBody))
+
+	attempt := models.DeliveryAttempt{Status: response.StatusCode, Duration: time.Since(start)}
+	if !attempt.Succeeded() {
+		attempt.Error = "unexpected status " + response.Status
+	}
+	return attempt
+}
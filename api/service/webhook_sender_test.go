@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/repository"
+	errors "github.com/aq-simei/coin-pilot/internal/config/error"
+)
+
+func TestWebhookSenderRefusesPrivateAddresses(t *testing.T) {
+	received := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+		_, _ = w.Write([]byte("internal answer"))
+	}))
+	defer server.Close()
+
+	delivery := &models.WebhookDelivery{ID: "d", Event: models.EventRecordCreated, Payload: models.JSONDocument(`{}`), URL: server.URL, Secret: "s"}
+	cfg := WebhookSenderConfig{Timeout: time.Second}
+
+	attempt := NewWebhookSender(nil, cfg).send(context.Background(), delivery)
+	if received || attempt.Succeeded() || !strings.Contains(attempt.Error, "not public") {
+		t.Fatalf("loopback delivery was not refused: received=%v attempt=%+v", received, attempt)
+	}
+
+	cfg.AllowPrivateAddresses = true
+	attempt = NewWebhookSender(nil, cfg).send(context.Background(), delivery)
+	if !received || !attempt.Succeeded() {
+		t.Fatalf("delivery with private addresses allowed failed: %+v", attempt)
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	s := &WebhookServiceImpl{}
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://hooks.example.com/coinpilot", true},
+		{"http://93.184.216.34:8080/", true},
+		{"ftp://example.com", false},
+		{"/relative", false},
+		{"http://localhost:5432", false},
+		{"http://api.localhost/", false},
+		{"http://127.0.0.1/", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[::1]:8080/", false},
+		{"http://10.0.0.5/", false},
+	}
+	for _, tt := range tests {
+		if err := s.validateWebhookURL(tt.url); (err == nil) != tt.ok {
+			t.Errorf("validateWebhookURL(%q) err = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+	if err := (&WebhookServiceImpl{allowPrivateAddresses: true}).validateWebhookURL("http://localhost:9000"); err != nil {
+		t.Errorf("localhost refused with private addresses allowed: %v", err)
+	}
+}
+
+// stubDeliveries serves one delivery and keeps what is saved, the methods
+// not overridden are not used.
+type stubDeliveries struct {
+	repository.WebhookRepository
+	delivery *models.WebhookDelivery
+	saved    []models.WebhookDelivery
+}
+
+func (r *stubDeliveries) GetDeliveryToSend(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	if r.delivery == nil || r.delivery.ID != id {
+		return nil, errors.NewNotFound("delivery")
+	}
+	delivery := *r.delivery
+	return &delivery, nil
+}
+
+func (r *stubDeliveries) CompleteDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	r.saved = append(r.saved, *delivery)
+	return nil
+}
+
+func TestWebhookSenderDeliver(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	retry := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		status     int
+		active     bool
+		attempts   int
+		wantErr    bool
+		wantStatus models.DeliveryStatus
+		wantNext   *time.Time
+	}{
+		{"acknowledged", http.StatusNoContent, true, 1, false, models.DeliverySucceeded, nil},
+		{"retried", http.StatusInternalServerError, true, 2, true, models.DeliveryPending, ptr(now.Add(2 * time.Minute))},
+		{"last attempt", http.StatusInternalServerError, true, 3, false, models.DeliveryFailed, nil},
+		{"inactive webhook", http.StatusOK, false, 1, false, models.DeliveryFailed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = tt.status
+			deliveries := &stubDeliveries{delivery: &models.WebhookDelivery{
+				ID: "d", Event: models.EventRecordCreated, Payload: models.JSONDocument(`{}`), Status: models.DeliveryPending,
+				Attempts: tt.attempts - 1, URL: server.URL, Secret: "s", WebhookActive: tt.active,
+			}}
+			sender := NewWebhookSender(deliveries, WebhookSenderConfig{Timeout: time.Second, Retry: retry, AllowPrivateAddresses: true})
+			sender.now = func() time.Time { return now }
+
+			err := sender.Deliver(context.Background(), models.Job{Payload: models.JSONDocument(`{"delivery_id":"d"}`), Attempts: tt.attempts})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Deliver err = %v, want an error %v", err, tt.wantErr)
+			}
+			if len(deliveries.saved) != 1 {
+				t.Fatalf("saved %d times, want once", len(deliveries.saved))
+			}
+			saved := deliveries.saved[0]
+			if saved.Status != tt.wantStatus || saved.Attempts != tt.attempts {
+				t.Fatalf("saved %s after %d attempts, want %s after %d", saved.Status, saved.Attempts, tt.wantStatus, tt.attempts)
+			}
+			if (saved.NextAttemptAt == nil) != (tt.wantNext == nil) || (tt.wantNext != nil && !saved.NextAttemptAt.Equal(*tt.wantNext)) {
+				t.Fatalf("next attempt at %v, want %v", saved.NextAttemptAt, tt.wantNext)
+			}
+		})
+	}
+
+	// A delivery deleted with its webhook is done
+	sender := NewWebhookSender(&stubDeliveries{}, WebhookSenderConfig{Timeout: time.Second, Retry: retry})
+	if err := sender.Deliver(context.Background(), models.Job{Payload: models.JSONDocument(`{"delivery_id":"gone"}`), Attempts: 1}); err != nil {
+		t.Fatalf("Deliver of a deleted delivery: %v", err)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
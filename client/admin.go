@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+// AdminService wraps /api/v1/admin, calls need an admin or support role.
+type AdminService struct {
+	client *Client
+}
+
+func (s *AdminService) SearchUsers(ctx context.Context, filter models.UserFilter) (*models.Page[models.UserResponse], error) {
+	query := url.Values{}
+	setQuery(query, "q", filter.Query)
+	setQuery(query, "role", string(filter.Role))
+	setQuery(query, "status", string(filter.Status))
+	setPageQuery(query, filter.Page, filter.PageSize)
+
+	var page models.Page[models.UserResponse]
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/admin/users", query: query}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// SuspendUser locks the user out, reason is stored in the audit log.
+func (s *AdminService) SuspendUser(ctx context.Context, id, reason string) error {
+	return s.client.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/users/" + url.PathEscape(id) + "/suspend",
+		body:   models.SuspendUserPayload{Reason: reason},
+	}, nil)
+}
+
+func (s *AdminService) ReactivateUser(ctx context.Context, id string) error {
+	return s.client.do(ctx, request{method: http.MethodPost, path: "/admin/users/" + url.PathEscape(id) + "/reactivate"}, nil)
+}
+
+func (s *AdminService) ListAuditLogs(ctx context.Context, filter models.AuditLogFilter) (*models.Page[models.AuditLog], error) {
+	query := url.Values{}
+	setQuery(query, "actor_id", filter.ActorID)
+	setQuery(query, "target_id", filter.TargetID)
+	setQuery(query, "action", filter.Action)
+	setPageQuery(query, filter.Page, filter.PageSize)
+
+	var page models.Page[models.AuditLog]
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/admin/audit-logs", query: query}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// ListJobs lists the background jobs, filter on models.JobDead for the dead
+// letters.
+func (s *AdminService) ListJobs(ctx context.Context, filter models.JobFilter) (*models.Page[models.Job], error) {
+	query := url.Values{}
+	setQuery(query, "status", string(filter.Status))
+	setQuery(query, "kind", filter.Kind)
+	setPageQuery(query, filter.Page, filter.PageSize)
+
+	var page models.Page[models.Job]
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/admin/jobs", query: query}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// RetryJob runs a dead job again with a fresh set of attempts.
+func (s *AdminService) RetryJob(ctx context.Context, id string) (*models.Job, error) {
+	var job models.Job
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: "/admin/jobs/" + url.PathEscape(id) + "/retry"}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func setQuery(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func setPageQuery(query url.Values, page, pageSize int) {
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if pageSize > 0 {
+		query.Set("page_size", strconv.Itoa(pageSize))
+	}
+}
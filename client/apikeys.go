@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+// APIKeysService wraps /api/v1/users/me/api-keys. Keys can only be managed
+// with a JWT, not with another API key.
+type APIKeysService struct {
+	client *Client
+}
+
+func (s *APIKeysService) List(ctx context.Context) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/users/me/api-keys"}, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Create returns the new key, its Key field is the only copy of the secret.
+func (s *APIKeysService) Create(ctx context.Context, payload models.CreateAPIKeyPayload) (*models.CreatedAPIKeyResponse, error) {
+	var key models.CreatedAPIKeyResponse
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: "/users/me/api-keys", body: payload}, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *APIKeysService) Revoke(ctx context.Context, id string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: "/users/me/api-keys/" + url.PathEscape(id)}, nil)
+}
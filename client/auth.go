@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// AuthService wraps the OIDC login routes under /api/v1/auth.
+type AuthService struct {
+	client *Client
+}
+
+// LoginURL is where a browser must be sent to log in with provider.
+func (s *AuthService) LoginURL(provider string) string {
+	return s.client.baseURL.JoinPath(apiPrefix, "auth", url.PathEscape(provider), "login").String()
+}
+
+// CompleteLogin exchanges the state and code the provider redirected with for
+// a JWT, which the client keeps for the next calls.
+func (s *AuthService) CompleteLogin(ctx context.Context, provider, state, code string) (string, error) {
+	var resp tokenResponse
+	err := s.client.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/auth/" + url.PathEscape(provider) + "/callback",
+		query:  url.Values{"state": {state}, "code": {code}},
+		public: true,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	s.client.setToken(resp.Token)
+	return resp.Token, nil
+}
@@ -0,0 +1,416 @@
+// Package client is a Go SDK for the CoinPilot /api/v1 endpoints. Request and
+// response types are the ones of api/models.
+//
+//	c, err := client.New("https://coinpilot.example.com", client.WithCredentials(email, password))
+//	records, err := c.Records.List(ctx)
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	responses "github.com/aq-simei/coin-pilot/internal"
+)
+
+const (
+	apiPrefix = "/api/v1"
+
+	defaultMaxRetries = 3
+	defaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second
+
+	// tokenExpiryMargin renews a token slightly before it expires so requests
+	// in flight do not race the expiry
+	tokenExpiryMargin = 30 * time.Second
+)
+
+// Client calls the CoinPilot API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	userAgent  string
+	maxRetries int
+	retryDelay time.Duration
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	apiKey      string
+	email       string
+	password    string
+	ledgerID    string
+
+	Users    *UsersService
+	APIKeys  *APIKeysService
+	Auth     *AuthService
+	Records  *RecordsService
+	Ledgers  *LedgersService
+	Groups   *GroupsService
+	Webhooks *WebhooksService
+	Admin    *AdminService
+	Health   *HealthService
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or a transport.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken authenticates with an existing JWT.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.setToken(token)
+	}
+}
+
+// WithAPIKey authenticates with a personal API key, limited to its scopes.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithCredentials logs in on the first call and again whenever the token
+// expires or is rejected.
+func WithCredentials(email, password string) Option {
+	return func(c *Client) {
+		c.email = email
+		c.password = password
+	}
+}
+
+// WithRetries sets how many times a failed call is retried and the first
+// backoff delay, doubled on every retry.
+func WithRetries(maxRetries int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryDelay = delay
+	}
+}
+
+// WithLedger sends record calls to a shared ledger instead of the personal
+// ledger of the user.
+func WithLedger(ledgerID string) Option {
+	return func(c *Client) {
+		c.ledgerID = ledgerID
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New returns a client for the server at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q, expected scheme and host", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: http.DefaultClient,
+		userAgent:  "coinpilot-go-client",
+		maxRetries: defaultMaxRetries,
+		retryDelay: defaultRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.Users = &UsersService{client: c}
+	c.APIKeys = &APIKeysService{client: c}
+	c.Auth = &AuthService{client: c}
+	c.Records = &RecordsService{client: c}
+	c.Ledgers = &LedgersService{client: c}
+	c.Groups = &GroupsService{client: c}
+	c.Webhooks = &WebhooksService{client: c}
+	c.Admin = &AdminService{client: c}
+	c.Health = &HealthService{client: c}
+	return c, nil
+}
+
+// Token returns the current JWT, empty when the client uses an API key or has
+// not logged in yet.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.tokenExpiry = tokenExpiry(token)
+}
+
+// tokenExpiry reads the exp claim without verifying the token, the server
+// does that; a zero time means unknown.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := decodeSegment(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// public requests are sent without credentials
+	public bool
+	// bare responses are not wrapped in the response envelope
+	bare bool
+	// unversioned paths are served outside /api/v1, e.g. the probes
+	unversioned bool
+	header      http.Header
+}
+
+// do sends the request, retrying on 429, 5xx and network errors, and decodes
+// the data of the response envelope into out when it is not nil.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	var payload []byte
+	if req.body != nil {
+		var err error
+		if payload, err = json.Marshal(req.body); err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+	}
+
+	// Retries of a mutating call share one key so the server applies it once
+	keyed := false
+	if !req.public && req.method != http.MethodGet && req.method != http.MethodHead {
+		req.header = req.header.Clone()
+		if req.header == nil {
+			req.header = http.Header{}
+		}
+		if req.header.Get(idempotencyKeyHeader) == "" {
+			req.header.Set(idempotencyKeyHeader, newIdempotencyKey())
+		}
+		keyed = true
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, payload)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= c.maxRetries {
+				return err
+			}
+			if err := c.wait(ctx, c.backoff(attempt, 0)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		apiErr := readResponse(resp, req.bare, out)
+		if apiErr == nil {
+			return nil
+		}
+
+		// A rejected token is renewed once when credentials are known
+		if apiErr.StatusCode == http.StatusUnauthorized && !req.public && !refreshed && c.canLogin() {
+			refreshed = true
+			c.setToken("")
+			continue
+		}
+		if !c.retryable(req.method, keyed, apiErr.StatusCode) || attempt >= c.maxRetries {
+			return apiErr
+		}
+		if err := c.wait(ctx, c.backoff(attempt, apiErr.RetryAfter)); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, payload []byte) (*http.Response, error) {
+	target := c.baseURL.JoinPath(apiPrefix, req.path)
+	if req.unversioned {
+		target = c.baseURL.JoinPath(req.path)
+	}
+	if len(req.query) > 0 {
+		target.RawQuery = req.query.Encode()
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.ledgerID != "" && httpReq.Header.Get(ledgerHeader) == "" {
+		httpReq.Header.Set(ledgerHeader, c.ledgerID)
+	}
+	if !req.public {
+		if err := c.authorize(ctx, httpReq); err != nil {
+			return nil, err
+		}
+	}
+	return c.httpClient.Do(httpReq)
+}
+
+func (c *Client) authorize(ctx context.Context, httpReq *http.Request) error {
+	c.mu.Lock()
+	apiKey, token, expiry := c.apiKey, c.token, c.tokenExpiry
+	c.mu.Unlock()
+
+	if apiKey != "" {
+		httpReq.Header.Set("X-API-Key", apiKey)
+		return nil
+	}
+	expired := !expiry.IsZero() && time.Now().Add(tokenExpiryMargin).After(expiry)
+	if (token == "" || expired) && c.canLogin() {
+		var err error
+		if token, err = c.Users.Login(ctx, c.email, c.password); err != nil {
+			return fmt.Errorf("refreshing token: %w", err)
+		}
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+func (c *Client) canLogin() bool {
+	return c.apiKey == "" && c.email != "" && c.password != ""
+}
+
+// retryable allows retrying any method on 429, the request was not handled,
+// but only idempotent ones on 5xx so a POST is never applied twice. Requests
+// sent with an Idempotency-Key are idempotent whatever their method.
+func (c *Client) retryable(method string, keyed bool, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	if status < 500 || status == http.StatusNotImplemented {
+		return false
+	}
+	if keyed {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff doubles the delay on every attempt with jitter, or follows the
+// server's Retry-After when it is given.
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, maxRetryDelay)
+	}
+	delay := min(c.retryDelay<<attempt, maxRetryDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func (c *Client) wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// readResponse decodes a successful response into out or turns a failed one
+// into an *APIError.
+func readResponse(resp *http.Response, bare bool, out any) *APIError {
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("reading response: %v", err)}
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    http.StatusText(resp.StatusCode),
+			RequestID:  resp.Header.Get("X-Request-ID"),
+		}
+		var envelope struct {
+			Data  json.RawMessage      `json:"data"`
+			Error *responses.ErrorData `json:"error"`
+		}
+		if json.Unmarshal(content, &envelope) == nil && envelope.Error != nil {
+			apiErr.Message = envelope.Error.Message
+			apiErr.Data = envelope.Data
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return apiErr
+	}
+
+	if out == nil || len(content) == 0 {
+		return nil
+	}
+	data := content
+	if !bare {
+		var envelope struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(content, &envelope); err != nil {
+			return &APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("decoding response: %v", err)}
+		}
+		data = envelope.Data
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return &APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("decoding response: %v", err)}
+	}
+	return nil
+}
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	_, _ = crand.Read(key)
+	return hex.EncodeToString(key)
+}
@@ -0,0 +1,281 @@
+package client_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/aq-simei/coin-pilot/api/router"
+	"github.com/aq-simei/coin-pilot/client"
+	"github.com/aq-simei/coin-pilot/internal/config"
+	"github.com/aq-simei/coin-pilot/internal/config/security"
+	"github.com/aq-simei/coin-pilot/internal/testdb"
+	"github.com/gin-gonic/gin"
+)
+
+const testJWTSecret = "0123456789abcdef0123456789abcdef"
+
+// newAPIServer serves the real router on the test database.
+func newAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	db := testdb.Open(t)
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	cfg.Database.DSN = "test"
+	cfg.Security.JWTSecret = testJWTSecret
+	server := httptest.NewServer(router.NewRouter(db, cfg))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// register creates a user through the API and returns its credentials.
+func register(t *testing.T, baseURL string) (string, string) {
+	t.Helper()
+	email, password := testdb.Email("client"), "correct-horse-battery"
+	c, err := client.New(baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Users.Register(context.Background(), models.CreateUserPayload{Name: "Client Test", Email: email, Password: password}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	return email, password
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	server := newAPIServer(t)
+	email, password := register(t, server.URL)
+	c, err := client.New(server.URL, client.WithCredentials(email, password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	created, err := c.Records.Create(ctx, models.CreateRecordPayload{
+		Name:   "Groceries",
+		Date:   time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		Type:   models.TypeExpense,
+		Amount: 4250,
+		Tags:   []string{"food"},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	got, err := c.Records.Get(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Name != "Groceries" || got.Amount != 4250 {
+		t.Fatalf("get returned %+v", got)
+	}
+
+	updated, err := c.Records.Update(ctx, got.ID, got.Version, models.UpdateRecordPayload{
+		Name:   "Groceries and wine",
+		Date:   got.Date,
+		Type:   got.Type,
+		Amount: 6100,
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.Amount != 6100 || updated.Version <= got.Version {
+		t.Fatalf("update returned %+v", updated)
+	}
+	// The version read before the update is stale now
+	if _, err := c.Records.Update(ctx, got.ID, got.Version, models.UpdateRecordPayload{Name: "x", Date: got.Date, Type: got.Type, Amount: 1}); !client.IsPreconditionFailed(err) {
+		t.Fatalf("stale update err = %v, want 412", err)
+	}
+
+	if err := c.Records.Delete(ctx, got.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := c.Records.Get(ctx, got.ID); !client.IsNotFound(err) {
+		t.Fatalf("get after delete err = %v, want 404", err)
+	}
+}
+
+func TestLoginAgainAfterRejectedToken(t *testing.T) {
+	server := newAPIServer(t)
+	email, password := register(t, server.URL)
+	ctx := context.Background()
+
+	// A token signed with another secret is rejected with a 401
+	forged, err := security.NewJWTManager("another-secret-another-secret-xx", time.Hour).GenerateJWT("someone", string(models.RoleUser))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.New(server.URL, client.WithToken(forged), client.WithCredentials(email, password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	me, err := c.Users.Me(ctx)
+	if err != nil {
+		t.Fatalf("me: %v", err)
+	}
+	if me.Email != email || c.Token() == forged {
+		t.Fatalf("client did not log in again, me = %+v", me)
+	}
+
+	// Without credentials the 401 is returned
+	c, err = client.New(server.URL, client.WithToken(forged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Users.Me(ctx); !client.IsUnauthorized(err) {
+		t.Fatalf("me err = %v, want 401", err)
+	}
+}
+
+// fakeToken returns an unsigned JWT expiring at exp, the client only reads
+// its claims.
+func fakeToken(name string, exp time.Time) string {
+	encode := func(v any) string {
+		content, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(content)
+	}
+	return encode(map[string]string{"alg": "HS256"}) + "." + encode(map[string]any{"sub": name, "exp": exp.Unix()}) + ".sig"
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	body := map[string]any{"success": status < 400, "data": data}
+	if status >= 400 {
+		body["error"] = map[string]any{"code": status, "message": http.StatusText(status)}
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestLoginBeforeTokenExpires(t *testing.T) {
+	fresh := fakeToken("fresh", time.Now().Add(time.Hour))
+	var logins atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/users/login":
+			logins.Add(1)
+			writeEnvelope(w, http.StatusOK, map[string]string{"token": fresh})
+		case "/api/v1/users/me":
+			if r.Header.Get("Authorization") != "Bearer "+fresh {
+				t.Errorf("expired token sent: %q", r.Header.Get("Authorization"))
+				writeEnvelope(w, http.StatusUnauthorized, nil)
+				return
+			}
+			writeEnvelope(w, http.StatusOK, models.UserResponse{Email: "me@example.com"})
+		}
+	}))
+	defer server.Close()
+
+	// Expiring within the safety margin counts as expired
+	c, err := client.New(server.URL,
+		client.WithToken(fakeToken("old", time.Now().Add(10*time.Second))),
+		client.WithCredentials("me@example.com", "secret-password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Users.Me(context.Background()); err != nil {
+		t.Fatalf("me: %v", err)
+	}
+	if _, err := c.Users.Me(context.Background()); err != nil {
+		t.Fatalf("me: %v", err)
+	}
+	if logins.Load() != 1 {
+		t.Fatalf("logged in %d times, want 1", logins.Load())
+	}
+}
+
+func TestRetryOnTooManyRequestsHonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			writeEnvelope(w, http.StatusTooManyRequests, nil)
+			return
+		}
+		writeEnvelope(w, http.StatusOK, models.UserResponse{Email: "me@example.com"})
+	}))
+	defer server.Close()
+
+	c, err := client.New(server.URL, client.WithToken("token"), client.WithRetries(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := c.Users.Me(context.Background()); err != nil {
+		t.Fatalf("me: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("%d calls, want 2", calls.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %s, Retry-After asked for 1s", elapsed)
+	}
+}
+
+func TestRetryOnServerErrors(t *testing.T) {
+	// Idempotency-Key of every call received
+	var mu sync.Mutex
+	var calls []string
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Header.Get("Idempotency-Key"))
+		current := status
+		mu.Unlock()
+		writeEnvelope(w, current, nil)
+	}))
+	defer server.Close()
+
+	c, err := client.New(server.URL, client.WithToken("token"), client.WithRetries(2, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		call  func() error
+		calls int
+	}{
+		{"GET is idempotent", func() error { _, err := c.Users.Me(ctx); return err }, 3},
+		{"DELETE is idempotent", func() error { return c.Records.Delete(ctx, "id") }, 3},
+		{"POST with an Idempotency-Key", func() error {
+			_, err := c.Records.Create(ctx, models.CreateRecordPayload{Name: "x"})
+			return err
+		}, 3},
+		{"POST without an Idempotency-Key", func() error {
+			return c.Users.Register(ctx, models.CreateUserPayload{Name: "x"})
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			if err := tt.call(); err == nil {
+				t.Fatal("call succeeded on a 503")
+			}
+			if len(calls) != tt.calls {
+				t.Fatalf("%d calls, want %d", len(calls), tt.calls)
+			}
+			for _, key := range calls[1:] {
+				if key != calls[0] {
+					t.Fatalf("retry sent Idempotency-Key %q, first attempt %q", key, calls[0])
+				}
+			}
+		})
+	}
+
+	// 501 means the call will never work, it is not retried
+	mu.Lock()
+	status = http.StatusNotImplemented
+	calls = nil
+	mu.Unlock()
+	if _, err := c.Users.Me(ctx); err == nil || len(calls) != 1 {
+		t.Fatalf("501: err = %v after %d calls, want 1 call", err, len(calls))
+	}
+}
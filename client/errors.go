@@ -0,0 +1,55 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// APIError is returned for every response with a 4xx or 5xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RequestID identifies the call in the server logs
+	RequestID string
+	// RetryAfter is set on 429 responses
+	RetryAfter time.Duration
+	// Data is the payload sent along with the error, e.g. the current record
+	// on a 412
+	Data json.RawMessage
+}
+
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("coinpilot: %d %s (request %s)", e.StatusCode, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("coinpilot: %d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the API.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsPreconditionFailed reports whether err is a 412 from the API, the
+// resource changed since it was read.
+func IsPreconditionFailed(err error) bool {
+	return hasStatus(err, http.StatusPreconditionFailed)
+}
+
+// IsUnauthorized reports whether err is a 401 from the API.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
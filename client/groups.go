@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+// GroupsService wraps /api/v1/groups. Groups can only be managed with a JWT,
+// not with an API key.
+type GroupsService struct {
+	client *Client
+}
+
+func (s *GroupsService) List(ctx context.Context) ([]models.Group, error) {
+	var groups []models.Group
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/groups"}, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Create creates a group with the user and placeholder members.
+func (s *GroupsService) Create(ctx context.Context, payload models.CreateGroupPayload) (*models.Group, error) {
+	var group models.Group
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: "/groups", body: payload}, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// Get returns the group with its members.
+func (s *GroupsService) Get(ctx context.Context, id string) (*models.Group, error) {
+	var group models.Group
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: groupPath(id)}, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (s *GroupsService) Rename(ctx context.Context, id, name string) (*models.Group, error) {
+	var group models.Group
+	body := models.UpdateGroupPayload{Name: name}
+	if err := s.client.do(ctx, request{method: http.MethodPatch, path: groupPath(id), body: body}, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// Delete deletes the group with its expenses and settlements.
+func (s *GroupsService) Delete(ctx context.Context, id string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: groupPath(id)}, nil)
+}
+
+// AddMember adds a registered user by email or a placeholder by name.
+func (s *GroupsService) AddMember(ctx context.Context, id string, payload models.AddGroupMemberPayload) (*models.GroupMember, error) {
+	var member models.GroupMember
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: groupPath(id) + "/members", body: payload}, &member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (s *GroupsService) RemoveMember(ctx context.Context, id, memberID string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: groupPath(id) + "/members/" + url.PathEscape(memberID)}, nil)
+}
+
+func (s *GroupsService) Expenses(ctx context.Context, id string, filter models.GroupExpenseFilter) (*models.Page[models.GroupExpense], error) {
+	query := url.Values{}
+	setPageQuery(query, filter.Page, filter.PageSize)
+
+	var page models.Page[models.GroupExpense]
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: groupPath(id) + "/expenses", query: query}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AddExpense splits an expense between members. A RecordID is looked up in
+// the ledger of WithLedger.
+func (s *GroupsService) AddExpense(ctx context.Context, id string, payload models.CreateGroupExpensePayload) (*models.GroupExpense, error) {
+	var expense models.GroupExpense
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: groupPath(id) + "/expenses", body: payload}, &expense); err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+func (s *GroupsService) Expense(ctx context.Context, id, expenseID string) (*models.GroupExpense, error) {
+	var expense models.GroupExpense
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: groupPath(id) + "/expenses/" + url.PathEscape(expenseID)}, &expense); err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+func (s *GroupsService) DeleteExpense(ctx context.Context, id, expenseID string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: groupPath(id) + "/expenses/" + url.PathEscape(expenseID)}, nil)
+}
+
+func (s *GroupsService) Settlements(ctx context.Context, id string) ([]models.GroupSettlement, error) {
+	var settlements []models.GroupSettlement
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: groupPath(id) + "/settlements"}, &settlements); err != nil {
+		return nil, err
+	}
+	return settlements, nil
+}
+
+// Settle records a payment from one member to another.
+func (s *GroupsService) Settle(ctx context.Context, id string, payload models.CreateSettlementPayload) (*models.GroupSettlement, error) {
+	var settlement models.GroupSettlement
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: groupPath(id) + "/settlements", body: payload}, &settlement); err != nil {
+		return nil, err
+	}
+	return &settlement, nil
+}
+
+func (s *GroupsService) DeleteSettlement(ctx context.Context, id, settlementID string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: groupPath(id) + "/settlements/" + url.PathEscape(settlementID)}, nil)
+}
+
+// Balances returns the balance of each member and who owes whom.
+func (s *GroupsService) Balances(ctx context.Context, id string) (*models.GroupBalances, error) {
+	var balances models.GroupBalances
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: groupPath(id) + "/balances"}, &balances); err != nil {
+		return nil, err
+	}
+	return &balances, nil
+}
+
+func groupPath(id string) string {
+	return "/groups/" + url.PathEscape(id)
+}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+// HealthService wraps the probes served next to the API.
+type HealthService struct {
+	client *Client
+}
+
+// Ready returns the readiness report, err is an *APIError with status 503
+// when the server is not ready.
+func (s *HealthService) Ready(ctx context.Context) (*models.HealthReport, error) {
+	var report models.HealthReport
+	err := s.client.do(ctx, request{method: http.MethodGet, path: "/readyz", public: true, bare: true, unversioned: true}, &report)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+// ledgerHeader picks the ledger of record calls, see WithLedger.
+const ledgerHeader = "X-Ledger-ID"
+
+// LedgersService wraps /api/v1/ledgers and /api/v1/invitations. Ledgers can
+// only be managed with a JWT, not with an API key.
+type LedgersService struct {
+	client *Client
+}
+
+// List returns the ledgers of the user with their role in each, the
+// personal ledger first.
+func (s *LedgersService) List(ctx context.Context) ([]models.Ledger, error) {
+	var ledgers []models.Ledger
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/ledgers"}, &ledgers); err != nil {
+		return nil, err
+	}
+	return ledgers, nil
+}
+
+// Create creates a shared ledger owned by the user.
+func (s *LedgersService) Create(ctx context.Context, name string) (*models.Ledger, error) {
+	var ledger models.Ledger
+	body := models.CreateLedgerPayload{Name: name}
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: "/ledgers", body: body}, &ledger); err != nil {
+		return nil, err
+	}
+	return &ledger, nil
+}
+
+func (s *LedgersService) Get(ctx context.Context, id string) (*models.Ledger, error) {
+	var ledger models.Ledger
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: ledgerPath(id)}, &ledger); err != nil {
+		return nil, err
+	}
+	return &ledger, nil
+}
+
+func (s *LedgersService) Rename(ctx context.Context, id, name string) (*models.Ledger, error) {
+	var ledger models.Ledger
+	body := models.UpdateLedgerPayload{Name: name}
+	if err := s.client.do(ctx, request{method: http.MethodPatch, path: ledgerPath(id), body: body}, &ledger); err != nil {
+		return nil, err
+	}
+	return &ledger, nil
+}
+
+// Delete deletes a shared ledger and every record in it.
+func (s *LedgersService) Delete(ctx context.Context, id string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: ledgerPath(id)}, nil)
+}
+
+func (s *LedgersService) Members(ctx context.Context, id string) ([]models.LedgerMember, error) {
+	var members []models.LedgerMember
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: ledgerPath(id) + "/members"}, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (s *LedgersService) SetMemberRole(ctx context.Context, id, userID string, role models.LedgerRole) error {
+	req := request{
+		method: http.MethodPatch,
+		path:   ledgerPath(id) + "/members/" + url.PathEscape(userID),
+		body:   models.UpdateLedgerMemberPayload{Role: role},
+	}
+	return s.client.do(ctx, req, nil)
+}
+
+// RemoveMember removes a member, passing the user's own ID leaves the
+// ledger.
+func (s *LedgersService) RemoveMember(ctx context.Context, id, userID string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: ledgerPath(id) + "/members/" + url.PathEscape(userID)}, nil)
+}
+
+func (s *LedgersService) Invitations(ctx context.Context, id string) ([]models.LedgerInvitation, error) {
+	var invitations []models.LedgerInvitation
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: ledgerPath(id) + "/invitations"}, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// Invite emails an invitation to join the ledger with role.
+func (s *LedgersService) Invite(ctx context.Context, id, email string, role models.LedgerRole) (*models.LedgerInvitation, error) {
+	var invitation models.LedgerInvitation
+	req := request{
+		method: http.MethodPost,
+		path:   ledgerPath(id) + "/invitations",
+		body:   models.CreateInvitationPayload{Email: email, Role: role},
+	}
+	if err := s.client.do(ctx, req, &invitation); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (s *LedgersService) RevokeInvitation(ctx context.Context, id, invitationID string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: ledgerPath(id) + "/invitations/" + url.PathEscape(invitationID)}, nil)
+}
+
+// Accept joins the ledger with the token of an invitation email.
+func (s *LedgersService) Accept(ctx context.Context, token string) (*models.LedgerInvitation, error) {
+	return s.respond(ctx, "/invitations/accept", token)
+}
+
+func (s *LedgersService) Decline(ctx context.Context, token string) (*models.LedgerInvitation, error) {
+	return s.respond(ctx, "/invitations/decline", token)
+}
+
+func (s *LedgersService) respond(ctx context.Context, path, token string) (*models.LedgerInvitation, error) {
+	var invitation models.LedgerInvitation
+	body := models.InvitationResponsePayload{Token: token}
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: path, body: body}, &invitation); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func ledgerPath(id string) string {
+	return "/ledgers/" + url.PathEscape(id)
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+// RecordsService wraps /api/v1/records. API keys need the records:read and
+// records:write scopes.
+type RecordsService struct {
+	client *Client
+}
+
+func (s *RecordsService) List(ctx context.Context) ([]models.Record, error) {
+	var records []models.Record
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/records/list", bare: true}, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *RecordsService) Create(ctx context.Context, payload models.CreateRecordPayload) (*models.Record, error) {
+	var record models.Record
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: "/records/new", body: payload}, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Get returns the record, its Version is the one updates must match.
+func (s *RecordsService) Get(ctx context.Context, id string) (*models.Record, error) {
+	var record models.Record
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/records/" + url.PathEscape(id)}, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// GetIfChanged returns the record only when it is no longer at version,
+// otherwise the server answers 304 and GetIfChanged returns nil.
+func (s *RecordsService) GetIfChanged(ctx context.Context, id string, version int64) (*models.Record, error) {
+	header := http.Header{}
+	header.Set("If-None-Match", etag(version))
+
+	var record models.Record
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/records/" + url.PathEscape(id), header: header}, &record); err != nil {
+		return nil, err
+	}
+	if record.ID == "" {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+// Update replaces the record if it is still at version. When someone else
+// changed it first the error is a 412, see IsPreconditionFailed, and the
+// current record is returned along with it.
+func (s *RecordsService) Update(ctx context.Context, id string, version int64, payload models.UpdateRecordPayload) (*models.Record, error) {
+	header := http.Header{}
+	header.Set("If-Match", etag(version))
+
+	var record models.Record
+	err := s.client.do(ctx, request{method: http.MethodPut, path: "/records/" + url.PathEscape(id), body: payload, header: header}, &record)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusPreconditionFailed && len(apiErr.Data) > 0 {
+			if json.Unmarshal(apiErr.Data, &record) == nil {
+				return &record, err
+			}
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Import creates a record marked as imported in its history.
+func (s *RecordsService) Import(ctx context.Context, payload models.CreateRecordPayload) (*models.Record, error) {
+	header := http.Header{}
+	header.Set("X-Record-Source", string(models.SourceImport))
+
+	var record models.Record
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: "/records/new", body: payload, header: header}, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Delete moves the record to the trash.
+func (s *RecordsService) Delete(ctx context.Context, id string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: "/records/" + url.PathEscape(id)}, nil)
+}
+
+// Trash lists deleted records, most recently deleted first.
+func (s *RecordsService) Trash(ctx context.Context, filter models.TrashFilter) (*models.Page[models.Record], error) {
+	query := url.Values{}
+	setPageQuery(query, filter.Page, filter.PageSize)
+
+	var page models.Page[models.Record]
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/records/trash", query: query}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (s *RecordsService) Restore(ctx context.Context, id string) error {
+	return s.client.do(ctx, request{method: http.MethodPost, path: "/records/trash/" + url.PathEscape(id) + "/restore"}, nil)
+}
+
+// Purge permanently deletes a record that is in the trash.
+func (s *RecordsService) Purge(ctx context.Context, id string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: "/records/trash/" + url.PathEscape(id)}, nil)
+}
+
+// History lists the changes made to a record, newest first.
+func (s *RecordsService) History(ctx context.Context, id string, filter models.RecordHistoryFilter) (*models.Page[models.RecordHistory], error) {
+	query := url.Values{}
+	setPageQuery(query, filter.Page, filter.PageSize)
+
+	var page models.Page[models.RecordHistory]
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/records/" + url.PathEscape(id) + "/history", query: query}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Bulk applies many changes at once, see models.BulkRequest. When an atomic
+// request is rolled back the error is a 422 and the response, telling which
+// operation failed, is returned along with it.
+func (s *RecordsService) Bulk(ctx context.Context, bulk models.BulkRequest) (*models.BulkResponse, error) {
+	var response models.BulkResponse
+	err := s.client.do(ctx, request{method: http.MethodPost, path: "/records/bulk", body: bulk}, &response)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity && len(apiErr.Data) > 0 {
+			if json.Unmarshal(apiErr.Data, &response) == nil {
+				return &response, err
+			}
+		}
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Changes returns the records changed since token, every record when token
+// is empty. Store NextToken and call again while HasMore is set. A 410 error
+// means the token expired and the client must sync again from scratch.
+func (s *RecordsService) Changes(ctx context.Context, token string, limit int) (*models.SyncPage, error) {
+	query := url.Values{}
+	if token != "" {
+		query.Set("token", token)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var page models.SyncPage
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/records/sync", query: query}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Upload sends changes made offline, records created offline keep the ID
+// generated by the client.
+func (s *RecordsService) Upload(ctx context.Context, upload models.SyncUploadRequest) (*models.SyncUploadResponse, error) {
+	var response models.SyncUploadResponse
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: "/records/sync", body: upload}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
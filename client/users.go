@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+// UsersService wraps /api/v1/users.
+type UsersService struct {
+	client *Client
+}
+
+type tokenResponse struct {
+	Token string `json:"token"`
+}
+
+// Register creates an account, it does not log in.
+func (s *UsersService) Register(ctx context.Context, payload models.CreateUserPayload) error {
+	return s.client.do(ctx, request{method: http.MethodPost, path: "/users/", body: payload, public: true}, nil)
+}
+
+// Login exchanges credentials for a JWT and keeps it for the next calls.
+func (s *UsersService) Login(ctx context.Context, email, password string) (string, error) {
+	var resp tokenResponse
+	err := s.client.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/login",
+		body:   map[string]string{"email": email, "password": password},
+		public: true,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	s.client.setToken(resp.Token)
+	return resp.Token, nil
+}
+
+// Logout ends the session server side and forgets the token.
+func (s *UsersService) Logout(ctx context.Context) error {
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: "/users/logout"}, nil); err != nil {
+		return err
+	}
+	s.client.setToken("")
+	return nil
+}
+
+func (s *UsersService) Me(ctx context.Context) (*models.UserResponse, error) {
+	var user models.UserResponse
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/users/me"}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *UsersService) UpdateMe(ctx context.Context, payload models.UpdateProfilePayload) error {
+	return s.client.do(ctx, request{method: http.MethodPut, path: "/users/me", body: payload}, nil)
+}
+
+func (s *UsersService) ChangePassword(ctx context.Context, payload models.ChangePasswordPayload) error {
+	return s.client.do(ctx, request{method: http.MethodPut, path: "/users/me/password", body: payload}, nil)
+}
+
+func (s *UsersService) DeleteMe(ctx context.Context) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: "/users/me"}, nil)
+}
+
+// Get needs the users:read permission.
+func (s *UsersService) Get(ctx context.Context, id string) (*models.UserResponse, error) {
+	var user models.UserResponse
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/users/" + url.PathEscape(id)}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Update needs the users:manage permission.
+func (s *UsersService) Update(ctx context.Context, id string, payload models.UpdateUserPayload) error {
+	return s.client.do(ctx, request{method: http.MethodPut, path: "/users/" + url.PathEscape(id), body: payload}, nil)
+}
+
+// Delete needs the users:manage permission.
+func (s *UsersService) Delete(ctx context.Context, id string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: "/users/" + url.PathEscape(id)}, nil)
+}
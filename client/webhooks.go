@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+// WebhookSignatureHeader carries the signature of a webhook delivery, see
+// VerifyWebhook.
+const WebhookSignatureHeader = "X-CoinPilot-Signature"
+
+// ErrInvalidSignature is returned by VerifyWebhook for deliveries that were
+// not signed with the secret, or too long ago.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// WebhooksService wraps /api/v1/webhooks. Webhooks can only be managed with
+// a JWT, not with an API key.
+type WebhooksService struct {
+	client *Client
+}
+
+func (s *WebhooksService) List(ctx context.Context) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: "/webhooks"}, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// Create registers an endpoint. The returned secret is needed to verify
+// deliveries and is not shown again.
+func (s *WebhooksService) Create(ctx context.Context, payload models.CreateWebhookPayload) (*models.WebhookSecretResponse, error) {
+	var webhook models.WebhookSecretResponse
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: "/webhooks", body: payload}, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *WebhooksService) Get(ctx context.Context, id string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: webhookPath(id)}, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Update changes the fields set in payload.
+func (s *WebhooksService) Update(ctx context.Context, id string, payload models.UpdateWebhookPayload) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := s.client.do(ctx, request{method: http.MethodPatch, path: webhookPath(id), body: payload}, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *WebhooksService) Delete(ctx context.Context, id string) error {
+	return s.client.do(ctx, request{method: http.MethodDelete, path: webhookPath(id)}, nil)
+}
+
+// RotateSecret replaces the signing secret and returns the new one.
+func (s *WebhooksService) RotateSecret(ctx context.Context, id string) (*models.WebhookSecretResponse, error) {
+	var webhook models.WebhookSecretResponse
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: webhookPath(id) + "/secret"}, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Deliveries returns the delivery log of a webhook, latest first.
+func (s *WebhooksService) Deliveries(ctx context.Context, id string, filter models.WebhookDeliveryFilter) (*models.Page[models.WebhookDelivery], error) {
+	query := url.Values{}
+	if filter.Status != "" {
+		query.Set("status", string(filter.Status))
+	}
+	if filter.Event != "" {
+		query.Set("event", filter.Event)
+	}
+	setPageQuery(query, filter.Page, filter.PageSize)
+
+	var page models.Page[models.WebhookDelivery]
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: webhookPath(id) + "/deliveries", query: query}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (s *WebhooksService) Delivery(ctx context.Context, id, deliveryID string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := s.client.do(ctx, request{method: http.MethodGet, path: webhookPath(id) + "/deliveries/" + url.PathEscape(deliveryID)}, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Redeliver sends the event of a delivery again and returns the new
+// delivery.
+func (s *WebhooksService) Redeliver(ctx context.Context, id, deliveryID string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	path := webhookPath(id) + "/deliveries/" + url.PathEscape(deliveryID) + "/redeliver"
+	if err := s.client.do(ctx, request{method: http.MethodPost, path: path}, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// VerifyWebhook checks the X-CoinPilot-Signature header of a delivery
+// against its raw body. Deliveries signed more than tolerance ago are
+// rejected so a captured delivery cannot be replayed later.
+func VerifyWebhook(secret, signature string, body []byte, tolerance time.Duration) error {
+	var timestamp, digest string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			digest = value
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(digest)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func webhookPath(id string) string {
+	return "/webhooks/" + url.PathEscape(id)
+}
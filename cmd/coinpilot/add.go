@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+const dateLayout = "2006-01-02"
+
+const addUsage = `Usage: coinpilot add <amount> <name...> [#tag...] [-d date] [-m description] [-o format]
+
+Negative amounts are expenses, positive ones income:
+  coinpilot add -12.50 "Coffee" #food
+  coinpilot add 2500 Salary #work -d 2026-10-01`
+
+// runAdd parses its arguments by hand: a negative amount would be taken for
+// a flag by the flag package.
+func runAdd(ctx context.Context, args []string) error {
+	var (
+		payload = models.CreateRecordPayload{Date: today()}
+		name    []string
+		output  = formatTable
+		amount  bool
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-h" || arg == "--help":
+			fmt.Fprintln(os.Stderr, addUsage)
+			return nil
+		case arg == "-d" || arg == "-m" || arg == "-o":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s needs a value\n\n%s", arg, addUsage)
+			}
+			i++
+			switch arg {
+			case "-d":
+				date, err := time.ParseInLocation(dateLayout, args[i], time.Local)
+				if err != nil {
+					return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", args[i])
+				}
+				payload.Date = date
+			case "-m":
+				payload.Description = args[i]
+			case "-o":
+				output = args[i]
+			}
+		case !amount && isAmount(arg):
+			cents, recordType, err := parseAmount(arg)
+			if err != nil {
+				return err
+			}
+			payload.Amount, payload.Type, amount = cents, recordType, true
+		case strings.HasPrefix(arg, "#") && len(arg) > 1:
+			payload.Tags = append(payload.Tags, strings.TrimPrefix(arg, "#"))
+		default:
+			name = append(name, arg)
+		}
+	}
+	if !amount {
+		return errors.New("missing amount\n\n" + addUsage)
+	}
+	payload.Name = strings.Join(name, " ")
+	if payload.Name == "" {
+		return errors.New("missing name\n\n" + addUsage)
+	}
+	if err := checkFormat(output); err != nil {
+		return err
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	created, err := c.Records.Create(ctx, payload)
+	if err != nil {
+		return err
+	}
+	return recordsTable([]models.Record{*created}).write(os.Stdout, output)
+}
+
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// recordView is the JSON output of a record, without the nested user.
+type recordView struct {
+	ID          string            `json:"id,omitempty"`
+	Date        string            `json:"date"`
+	Name        string            `json:"name"`
+	Type        models.RecordType `json:"type"`
+	Amount      int64             `json:"amount"`
+	Tags        []string          `json:"tags"`
+	Description string            `json:"description,omitempty"`
+}
+
+func recordsTable(records []models.Record) *table {
+	views := make([]recordView, 0, len(records))
+	t := &table{header: []string{"date", "name", "amount", "tags", "description", "id"}}
+	for _, record := range records {
+		views = append(views, recordView{
+			ID:          record.ID,
+			Date:        record.Date.Format(dateLayout),
+			Name:        record.Name,
+			Type:        record.Type,
+			Amount:      record.Amount,
+			Tags:        record.Tags,
+			Description: record.Description,
+		})
+		t.rows = append(t.rows, []string{
+			record.Date.Format(dateLayout),
+			record.Name,
+			formatCents(signedCents(record)),
+			strings.Join(record.Tags, " "),
+			record.Description,
+			record.ID,
+		})
+	}
+	t.value = views
+	return t
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+var amountPattern = regexp.MustCompile(`^[+-]?\d+([.,]\d{1,2})?$`)
+
+func isAmount(s string) bool {
+	return amountPattern.MatchString(s)
+}
+
+// parseAmount turns "-12.50" into 1250 cents of expense and "+3" or "3" into
+// 300 cents of income, without going through floats.
+func parseAmount(s string) (int64, models.RecordType, error) {
+	if !isAmount(s) {
+		return 0, "", fmt.Errorf("invalid amount %q, expected e.g. -12.50", s)
+	}
+	recordType := models.TypeIncome
+	if strings.HasPrefix(s, "-") {
+		recordType = models.TypeExpense
+	}
+	s = strings.TrimLeft(s, "+-")
+	units, fraction, _ := strings.Cut(strings.Replace(s, ",", ".", 1), ".")
+	fraction = (fraction + "00")[:2]
+
+	cents, err := strconv.ParseInt(units+fraction, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	if cents == 0 {
+		return 0, "", fmt.Errorf("amount must not be zero")
+	}
+	return cents, recordType, nil
+}
+
+// signedCents is negative for expenses.
+func signedCents(record models.Record) int64 {
+	if record.Type == models.TypeExpense {
+		return -record.Amount
+	}
+	return record.Amount
+}
+
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+const importUsage = `CSV columns, matched by header name: date (YYYY-MM-DD), name, amount
+(negative for expenses), and optionally tags (space or ; separated) and
+description.`
+
+// runImport creates one record per CSV row. Rows are validated before any
+// record is sent, so a malformed file creates nothing.
+func runImport(ctx context.Context, args []string) error {
+	var output string
+	flags := newFlagSet("import", &output)
+	dryRun := flags.Bool("dry-run", false, "validate and print the records without creating them")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: coinpilot import [flags] <file.csv|->")
+		flags.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\n"+importUsage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+	if err := checkFormat(output); err != nil {
+		return err
+	}
+
+	input := io.Reader(os.Stdin)
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	payloads, err := readImport(input)
+	if err != nil {
+		return err
+	}
+
+	records := make([]models.Record, 0, len(payloads))
+	for _, payload := range payloads {
+		records = append(records, models.Record{
+			Name:        payload.Name,
+			Description: payload.Description,
+			Date:        payload.Date,
+			Tags:        payload.Tags,
+			Type:        payload.Type,
+			Amount:      payload.Amount,
+		})
+	}
+	if *dryRun {
+		return recordsTable(records).write(os.Stdout, output)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	for i, payload := range payloads {
+		if _, err := c.Records.Import(ctx, payload); err != nil {
+			return fmt.Errorf("row %d: %w (%d of %d records imported)", i+2, err, i, len(payloads))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d records imported\n", len(payloads))
+	return nil
+}
+
+func readImport(r io.Reader) ([]models.CreateRecordPayload, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"date", "name", "amount"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing %q column\n\n%s", required, importUsage)
+		}
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var payloads []models.CreateRecordPayload
+	var errs []error
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		date, err := time.ParseInLocation(dateLayout, field(row, "date"), time.Local)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("row %d: invalid date %q", line, field(row, "date")))
+			continue
+		}
+		cents, recordType, err := parseAmount(field(row, "amount"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("row %d: %w", line, err))
+			continue
+		}
+		name := field(row, "name")
+		if name == "" {
+			errs = append(errs, fmt.Errorf("row %d: empty name", line))
+			continue
+		}
+		var tags []string
+		for _, tag := range strings.FieldsFunc(field(row, "tags"), func(r rune) bool { return r == ';' || r == ' ' }) {
+			tags = append(tags, strings.TrimPrefix(tag, "#"))
+		}
+
+		payloads = append(payloads, models.CreateRecordPayload{
+			Name:        name,
+			Description: field(row, "description"),
+			Date:        date,
+			Tags:        tags,
+			Type:        recordType,
+			Amount:      cents,
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return payloads, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+// recordFilter narrows records down on the client, the list endpoint returns
+// every record of the user.
+type recordFilter struct {
+	from, to   string
+	recordType string
+	tag        string
+	search     string
+}
+
+func (f *recordFilter) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.from, "from", "", "first date included, YYYY-MM-DD")
+	flags.StringVar(&f.to, "to", "", "last date included, YYYY-MM-DD")
+	flags.StringVar(&f.recordType, "type", "", "expense or income")
+	flags.StringVar(&f.tag, "tag", "", "only records with this tag, with or without #")
+	flags.StringVar(&f.search, "search", "", "text to find in the name or description")
+}
+
+func (f *recordFilter) apply(records []models.Record) ([]models.Record, error) {
+	var from, to time.Time
+	var err error
+	if f.from != "" {
+		if from, err = time.ParseInLocation(dateLayout, f.from, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid -from date %q", f.from)
+		}
+	}
+	if f.to != "" {
+		if to, err = time.ParseInLocation(dateLayout, f.to, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid -to date %q", f.to)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	if f.recordType != "" && f.recordType != string(models.TypeExpense) && f.recordType != string(models.TypeIncome) {
+		return nil, fmt.Errorf("invalid -type %q, expected expense or income", f.recordType)
+	}
+	tag := strings.TrimPrefix(f.tag, "#")
+	search := strings.ToLower(f.search)
+
+	var filtered []models.Record
+	for _, record := range records {
+		switch {
+		case !from.IsZero() && record.Date.Before(from):
+		case !to.IsZero() && !record.Date.Before(to):
+		case f.recordType != "" && string(record.Type) != f.recordType:
+		case tag != "" && !slices.Contains(record.Tags, tag):
+		case search != "" && !strings.Contains(strings.ToLower(record.Name+" "+record.Description), search):
+		default:
+			filtered = append(filtered, record)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].Date.After(filtered[j].Date)
+	})
+	return filtered, nil
+}
+
+func fetchRecords(ctx context.Context, filter *recordFilter) ([]models.Record, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	records, err := c.Records.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filter.apply(records)
+}
+
+func runList(ctx context.Context, args []string) error {
+	var output string
+	var filter recordFilter
+	flags := newFlagSet("list", &output)
+	filter.register(flags)
+	limit := flags.Int("limit", 0, "show at most this many records, newest first")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(output); err != nil {
+		return err
+	}
+
+	records, err := fetchRecords(ctx, &filter)
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(records) > *limit {
+		records = records[:*limit]
+	}
+	return recordsTable(records).write(os.Stdout, output)
+}
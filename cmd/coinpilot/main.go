@@ -0,0 +1,78 @@
+// Command coinpilot logs and reviews expenses from the terminal through the
+// CoinPilot API.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/aq-simei/coin-pilot/client"
+)
+
+const usage = `Usage: coinpilot <command> [flags]
+
+Commands:
+  login     log in and store the token in the user config directory
+  logout    forget the stored token
+  add       add a record, e.g. coinpilot add -12.50 "Coffee" #food
+  list      list records, with filters
+  report    totals of income and expenses grouped by tag, month or type
+  import    create records from a CSV file
+
+Run coinpilot <command> -h for the flags of a command.
+Output flags: -o table (default), json or csv.
+The server defaults to the one used at login, or COINPILOT_SERVER.
+Records go to your personal ledger, or to the shared one in COINPILOT_LEDGER.`
+
+type command func(ctx context.Context, args []string) error
+
+var commands = map[string]command{
+	"login":  runLogin,
+	"logout": runLogout,
+	"add":    runAdd,
+	"list":   runList,
+	"report": runReport,
+	"import": runImport,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "-h" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		}
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		if client.IsUnauthorized(err) {
+			err = fmt.Errorf("%w\nyour session expired, run coinpilot login", err)
+		}
+		fmt.Fprintln(os.Stderr, "coinpilot:", err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet returns the flags shared by the commands talking to the API.
+func newFlagSet(name string, output *string) *flag.FlagSet {
+	flags := flag.NewFlagSet("coinpilot "+name, flag.ContinueOnError)
+	if output != nil {
+		flags.StringVar(output, "o", formatTable, "output format: table, json or csv")
+	}
+	return flags
+}
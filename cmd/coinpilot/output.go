@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+func checkFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatCSV:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected table, json or csv", format)
+}
+
+// table is rendered as aligned columns, CSV or, when value is set, the JSON
+// encoding of value.
+type table struct {
+	header []string
+	rows   [][]string
+	value  any
+}
+
+func (t *table) write(w io.Writer, format string) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(t.value)
+	case formatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(t.header); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(t.rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	default:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(t.header, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	}
+}
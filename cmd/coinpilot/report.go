@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+)
+
+type reportLine struct {
+	Group   string `json:"group"`
+	Income  int64  `json:"income"`
+	Expense int64  `json:"expense"`
+	Net     int64  `json:"net"`
+	Count   int    `json:"count"`
+}
+
+// runReport sums the filtered records per tag, month or type. A record with
+// several tags counts once in each of them.
+func runReport(ctx context.Context, args []string) error {
+	var output string
+	var filter recordFilter
+	flags := newFlagSet("report", &output)
+	filter.register(flags)
+	by := flags.String("by", "tag", "group by tag, month or type")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkFormat(output); err != nil {
+		return err
+	}
+	var groupsOf func(models.Record) []string
+	switch *by {
+	case "tag":
+		groupsOf = func(record models.Record) []string {
+			if len(record.Tags) == 0 {
+				return []string{"(untagged)"}
+			}
+			return record.Tags
+		}
+	case "month":
+		groupsOf = func(record models.Record) []string { return []string{record.Date.Format("2006-01")} }
+	case "type":
+		groupsOf = func(record models.Record) []string { return []string{string(record.Type)} }
+	default:
+		return fmt.Errorf("invalid -by %q, expected tag, month or type", *by)
+	}
+
+	records, err := fetchRecords(ctx, &filter)
+	if err != nil {
+		return err
+	}
+
+	lines := map[string]*reportLine{}
+	total := reportLine{Group: "total"}
+	add := func(line *reportLine, record models.Record) {
+		if record.Type == models.TypeExpense {
+			line.Expense += record.Amount
+		} else {
+			line.Income += record.Amount
+		}
+		line.Net += signedCents(record)
+		line.Count++
+	}
+	for _, record := range records {
+		for _, group := range groupsOf(record) {
+			if lines[group] == nil {
+				lines[group] = &reportLine{Group: group}
+			}
+			add(lines[group], record)
+		}
+		add(&total, record)
+	}
+
+	report := make([]reportLine, 0, len(lines)+1)
+	for _, line := range lines {
+		report = append(report, *line)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if *by == "month" {
+			return report[i].Group < report[j].Group
+		}
+		return report[i].Net < report[j].Net
+	})
+	report = append(report, total)
+
+	t := &table{header: []string{*by, "income", "expense", "net", "records"}, value: report}
+	for _, line := range report {
+		t.rows = append(t.rows, []string{
+			line.Group,
+			formatCents(line.Income),
+			formatCents(-line.Expense),
+			formatCents(line.Net),
+			strconv.Itoa(line.Count),
+		})
+	}
+	return t.write(os.Stdout, output)
+}
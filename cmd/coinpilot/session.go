@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aq-simei/coin-pilot/client"
+	"golang.org/x/term"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// session is what login stores in the user config directory.
+type session struct {
+	Server string `json:"server"`
+	Email  string `json:"email"`
+	Token  string `json:"token"`
+}
+
+func sessionPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "coinpilot", "session.json"), nil
+}
+
+func loadSession() (*session, error) {
+	path, err := sessionPath()
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &session{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s session
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// save writes the session readable by the current user only, it holds a
+// bearer token.
+func (s *session) save() error {
+	path, err := sessionPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+// serverURL picks COINPILOT_SERVER, then the server used at login.
+func (s *session) serverURL() string {
+	if server := os.Getenv("COINPILOT_SERVER"); server != "" {
+		return server
+	}
+	if s.Server != "" {
+		return s.Server
+	}
+	return defaultServer
+}
+
+// newClient returns a client authenticated with the stored token, or with
+// COINPILOT_API_KEY when it is set. COINPILOT_LEDGER picks a shared ledger.
+func newClient() (*client.Client, error) {
+	s, err := loadSession()
+	if err != nil {
+		return nil, err
+	}
+	opts := []client.Option{client.WithUserAgent("coinpilot-cli")}
+	if ledgerID := os.Getenv("COINPILOT_LEDGER"); ledgerID != "" {
+		opts = append(opts, client.WithLedger(ledgerID))
+	}
+	if apiKey := os.Getenv("COINPILOT_API_KEY"); apiKey != "" {
+		return client.New(s.serverURL(), append(opts, client.WithAPIKey(apiKey))...)
+	}
+	if s.Token == "" {
+		return nil, errors.New("not logged in, run coinpilot login")
+	}
+	return client.New(s.serverURL(), append(opts, client.WithToken(s.Token))...)
+}
+
+func runLogin(ctx context.Context, args []string) error {
+	s, err := loadSession()
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("login", nil)
+	server := flags.String("server", s.serverURL(), "API base URL")
+	email := flags.String("email", s.Email, "account email")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *email == "" {
+		if *email, err = prompt("Email: "); err != nil {
+			return err
+		}
+	}
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	c, err := client.New(*server, client.WithUserAgent("coinpilot-cli"))
+	if err != nil {
+		return err
+	}
+	token, err := c.Users.Login(ctx, *email, password)
+	if err != nil {
+		return err
+	}
+
+	s.Server, s.Email, s.Token = *server, *email, token
+	if err := s.save(); err != nil {
+		return fmt.Errorf("saving session: %w", err)
+	}
+	fmt.Printf("Logged in as %s\n", *email)
+	return nil
+}
+
+func runLogout(ctx context.Context, args []string) error {
+	if err := newFlagSet("logout", nil).Parse(args); err != nil {
+		return err
+	}
+	s, err := loadSession()
+	if err != nil {
+		return err
+	}
+	if s.Token != "" {
+		if c, err := newClient(); err == nil {
+			// The token is forgotten locally even if the server is unreachable
+			_ = c.Users.Logout(ctx)
+		}
+	}
+	s.Token = ""
+	return s.save()
+}
+
+func prompt(label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// readPassword reads COINPILOT_PASSWORD, or prompts without echo on a terminal.
+func readPassword() (string, error) {
+	if password := os.Getenv("COINPILOT_PASSWORD"); password != "" {
+		return password, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return prompt("")
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
@@ -0,0 +1,625 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/api/models"
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+
+	// minProductionSecretLength is the shortest JWT secret accepted in production
+	minProductionSecretLength = 32
+)
+
+// RateLimitGroups are the route groups that can be given their own limit.
+var RateLimitGroups = []string{"global", "auth", "users", "records", "admin"}
+
+// Duration is a time.Duration read from strings such as "15m" in config files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config is the whole application configuration. Values are layered, each
+// source overriding the previous one: defaults, config file, environment
+// (including .env), command line flags.
+type Config struct {
+	App         AppConfig         `yaml:"app" toml:"app"`
+	Log         LogConfig         `yaml:"log" toml:"log"`
+	Database    DatabaseConfig    `yaml:"database" toml:"database"`
+	Security    SecurityConfig    `yaml:"security" toml:"security"`
+	Login       LoginConfig       `yaml:"login" toml:"login"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit" toml:"rate_limit"`
+	OIDC        OIDCConfig        `yaml:"oidc" toml:"oidc"`
+	Tracing     TracingConfig     `yaml:"tracing" toml:"tracing"`
+	Records     RecordsConfig     `yaml:"records" toml:"records"`
+	Idempotency IdempotencyConfig `yaml:"idempotency" toml:"idempotency"`
+	Webhooks    WebhooksConfig    `yaml:"webhooks" toml:"webhooks"`
+	Jobs        JobsConfig        `yaml:"jobs" toml:"jobs"`
+}
+
+type AppConfig struct {
+	Port int    `yaml:"port" toml:"port"`
+	Env  string `yaml:"env" toml:"env"`
+	// ShutdownTimeout is how long in-flight requests get to finish on SIGTERM
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// TrustedProxies are the IPs and CIDRs whose X-Forwarded-For is believed
+	// for the client IP. Empty trusts none, the client IP is the peer address.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+type LogConfig struct {
+	// Level is one of debug, info, warn or error
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+}
+
+type DatabaseConfig struct {
+	DSN string `yaml:"dsn" toml:"dsn"`
+}
+
+type SecurityConfig struct {
+	JWTSecret string   `yaml:"jwt_secret" toml:"jwt_secret"`
+	JWTTTL    Duration `yaml:"jwt_ttl" toml:"jwt_ttl"`
+}
+
+type LoginConfig struct {
+	AttemptStore    string   `yaml:"attempt_store" toml:"attempt_store"`
+	MaxFailures     int      `yaml:"max_failures" toml:"max_failures"`
+	MaxIPFailures   int      `yaml:"max_ip_failures" toml:"max_ip_failures"`
+	BaseDelay       Duration `yaml:"base_delay" toml:"base_delay"`
+	MaxDelay        Duration `yaml:"max_delay" toml:"max_delay"`
+	LockoutDuration Duration `yaml:"lockout_duration" toml:"lockout_duration"`
+	FailureWindow   Duration `yaml:"failure_window" toml:"failure_window"`
+}
+
+type RateLimitConfig struct {
+	Store string `yaml:"store" toml:"store"`
+	// Limits maps a group from RateLimitGroups to "<requests>/<period>"
+	Limits map[string]string `yaml:"limits" toml:"limits"`
+	// PurgeInterval is how often idle buckets are deleted from the postgres store
+	PurgeInterval Duration `yaml:"purge_interval" toml:"purge_interval"`
+}
+
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig `yaml:"providers" toml:"providers"`
+	// LoginTTL is how long a started login waits for the provider's callback
+	LoginTTL      Duration `yaml:"login_ttl" toml:"login_ttl"`
+	PurgeInterval Duration `yaml:"purge_interval" toml:"purge_interval"`
+}
+
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name" toml:"name"`
+	IssuerURL    string   `yaml:"issuer_url" toml:"issuer_url"`
+	ClientID     string   `yaml:"client_id" toml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url"`
+	Scopes       []string `yaml:"scopes" toml:"scopes"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout (local runs) or otlp
+	Exporter    string `yaml:"exporter" toml:"exporter"`
+	ServiceName string `yaml:"service_name" toml:"service_name"`
+	// OTLPEndpoint is the host:port of the OTLP/HTTP collector
+	OTLPEndpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	OTLPInsecure bool   `yaml:"otlp_insecure" toml:"otlp_insecure"`
+	// SampleRatio is the fraction of new traces recorded, from 0 to 1
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+type RecordsConfig struct {
+	// TrashRetention is how long deleted records stay restorable
+	TrashRetention     Duration `yaml:"trash_retention" toml:"trash_retention"`
+	TrashPurgeInterval Duration `yaml:"trash_purge_interval" toml:"trash_purge_interval"`
+	// TombstoneRetention is how long purged records are reported to syncing
+	// clients, older sync tokens must start over with a full sync
+	TombstoneRetention Duration `yaml:"tombstone_retention" toml:"tombstone_retention"`
+}
+
+type IdempotencyConfig struct {
+	// TTL is how long a response is replayed for a reused Idempotency-Key
+	TTL           Duration `yaml:"ttl" toml:"ttl"`
+	PurgeInterval Duration `yaml:"purge_interval" toml:"purge_interval"`
+}
+
+type WebhooksConfig struct {
+	// Timeout bounds each request to a webhook, deliveries are sent by jobs
+	// so it must be shorter than jobs.timeout
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+	// MaxAttempts is how many times a delivery is tried before it fails,
+	// waiting RetryBaseDelay after the first attempt and doubling up to
+	// RetryMaxDelay
+	MaxAttempts    int      `yaml:"max_attempts" toml:"max_attempts"`
+	RetryBaseDelay Duration `yaml:"retry_base_delay" toml:"retry_base_delay"`
+	RetryMaxDelay  Duration `yaml:"retry_max_delay" toml:"retry_max_delay"`
+	// DeliveryRetention is how long finished deliveries stay in the log
+	DeliveryRetention Duration `yaml:"delivery_retention" toml:"delivery_retention"`
+	PurgeInterval     Duration `yaml:"purge_interval" toml:"purge_interval"`
+	// AllowPrivateAddresses lets webhooks reach loopback and private
+	// networks, only for local development
+	AllowPrivateAddresses bool `yaml:"allow_private_addresses" toml:"allow_private_addresses"`
+}
+
+type JobsConfig struct {
+	// PollInterval is how often due jobs are looked for when the queue is
+	// idle
+	PollInterval Duration `yaml:"poll_interval" toml:"poll_interval"`
+	// Concurrency is how many jobs an instance runs at once
+	Concurrency int `yaml:"concurrency" toml:"concurrency"`
+	// Timeout bounds each attempt, a job whose runner died is run again once
+	// it is over
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+	// MaxAttempts is how many times a job is tried before it is dead,
+	// waiting RetryBaseDelay after the first attempt and doubling up to
+	// RetryMaxDelay
+	MaxAttempts    int      `yaml:"max_attempts" toml:"max_attempts"`
+	RetryBaseDelay Duration `yaml:"retry_base_delay" toml:"retry_base_delay"`
+	RetryMaxDelay  Duration `yaml:"retry_max_delay" toml:"retry_max_delay"`
+	// Retention is how long succeeded jobs are kept, dead ones stay until
+	// they are retried
+	Retention     Duration `yaml:"retention" toml:"retention"`
+	PurgeInterval Duration `yaml:"purge_interval" toml:"purge_interval"`
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() *Config {
+	return &Config{
+		App: AppConfig{
+			Port:            8080,
+			Env:             EnvDevelopment,
+			ShutdownTimeout: Duration(20 * time.Second),
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Security: SecurityConfig{
+			JWTTTL: Duration(24 * time.Hour),
+		},
+		Login: LoginConfig{
+			AttemptStore:    StoreMemory,
+			MaxFailures:     5,
+			MaxIPFailures:   25,
+			BaseDelay:       Duration(time.Second),
+			MaxDelay:        Duration(time.Minute),
+			LockoutDuration: Duration(15 * time.Minute),
+			FailureWindow:   Duration(30 * time.Minute),
+		},
+		RateLimit: RateLimitConfig{
+			Store: StoreMemory,
+			Limits: map[string]string{
+				"global":  "600/1m",
+				"auth":    "20/1m",
+				"users":   "120/1m",
+				"records": "120/1m",
+				"admin":   "120/1m",
+			},
+			PurgeInterval: Duration(time.Hour),
+		},
+		OIDC: OIDCConfig{
+			LoginTTL:      Duration(10 * time.Minute),
+			PurgeInterval: Duration(time.Hour),
+		},
+		Tracing: TracingConfig{
+			Exporter:     ExporterNone,
+			ServiceName:  "coin-pilot",
+			OTLPEndpoint: "localhost:4318",
+			SampleRatio:  1,
+		},
+		Records: RecordsConfig{
+			TrashRetention:     Duration(30 * 24 * time.Hour),
+			TrashPurgeInterval: Duration(time.Hour),
+			TombstoneRetention: Duration(90 * 24 * time.Hour),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:           Duration(24 * time.Hour),
+			PurgeInterval: Duration(time.Hour),
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:           Duration(10 * time.Second),
+			MaxAttempts:       8,
+			RetryBaseDelay:    Duration(30 * time.Second),
+			RetryMaxDelay:     Duration(6 * time.Hour),
+			DeliveryRetention: Duration(30 * 24 * time.Hour),
+			PurgeInterval:     Duration(time.Hour),
+		},
+		Jobs: JobsConfig{
+			PollInterval:   Duration(time.Second),
+			Concurrency:    4,
+			Timeout:        Duration(5 * time.Minute),
+			MaxAttempts:    10,
+			RetryBaseDelay: Duration(10 * time.Second),
+			RetryMaxDelay:  Duration(time.Hour),
+			Retention:      Duration(7 * 24 * time.Hour),
+			PurgeInterval:  Duration(time.Hour),
+		},
+	}
+}
+
+// Load builds the configuration from args (usually os.Args[1:]) and the
+// environment, and validates it. It returns the arguments left after flags,
+// e.g. a subcommand.
+func Load(args []string) (*Config, []string, error) {
+	flags := flag.NewFlagSet("coin-pilot", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv("COINPILOT_CONFIG"), "path to a YAML or TOML config file")
+	port := flags.Int("port", 0, "HTTP port, overrides app.port")
+	env := flags.String("env", "", "environment name (development or production), overrides app.env")
+	logLevel := flags.String("log-level", "", "debug, info, warn or error, overrides log.level")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Default()
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// A missing .env file is fine, real deployments use the environment
+	_ = godotenv.Load()
+	if err := cfg.loadEnv(); err != nil {
+		return nil, nil, err
+	}
+
+	if *port != 0 {
+		cfg.App.Port = *port
+	}
+	if *env != "" {
+		cfg.App.Env = *env
+	}
+	if *logLevel != "" {
+		cfg.Log.Level = *logLevel
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, c)
+	case ".toml":
+		err = toml.Unmarshal(content, c)
+	default:
+		return fmt.Errorf("unsupported config file %s, expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	// A file setting only some limits keeps the defaults for the others
+	defaults := Default().RateLimit.Limits
+	if c.RateLimit.Limits == nil {
+		c.RateLimit.Limits = map[string]string{}
+	}
+	for group, limit := range defaults {
+		if _, ok := c.RateLimit.Limits[group]; !ok {
+			c.RateLimit.Limits[group] = limit
+		}
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	var errs []error
+	setString := func(key string, target *string) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			*target = value
+		}
+	}
+	setInt := func(key string, target *int) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*target = parsed
+		}
+	}
+	setBool := func(key string, target *bool) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*target = parsed
+		}
+	}
+	setFloat := func(key string, target *float64) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*target = parsed
+		}
+	}
+	setDuration := func(key string, target *Duration) {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			if err := target.UnmarshalText([]byte(value)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	}
+
+	setInt("APP_PORT", &c.App.Port)
+	setString("APP_ENV", &c.App.Env)
+	setDuration("APP_SHUTDOWN_TIMEOUT", &c.App.ShutdownTimeout)
+	if proxies := os.Getenv("APP_TRUSTED_PROXIES"); proxies != "" {
+		c.App.TrustedProxies = strings.Fields(strings.ReplaceAll(proxies, ",", " "))
+	}
+	setString("LOG_LEVEL", &c.Log.Level)
+	setString("LOG_FORMAT", &c.Log.Format)
+	setString("POSTGRES_DSN", &c.Database.DSN)
+	setString("JWT_SECRET", &c.Security.JWTSecret)
+	setDuration("JWT_TTL", &c.Security.JWTTTL)
+
+	setString("LOGIN_ATTEMPT_STORE", &c.Login.AttemptStore)
+	setInt("LOGIN_MAX_FAILURES", &c.Login.MaxFailures)
+	setInt("LOGIN_MAX_IP_FAILURES", &c.Login.MaxIPFailures)
+	setDuration("LOGIN_BASE_DELAY", &c.Login.BaseDelay)
+	setDuration("LOGIN_MAX_DELAY", &c.Login.MaxDelay)
+	setDuration("LOGIN_LOCKOUT_DURATION", &c.Login.LockoutDuration)
+	setDuration("LOGIN_FAILURE_WINDOW", &c.Login.FailureWindow)
+
+	setString("RATE_LIMIT_STORE", &c.RateLimit.Store)
+	setDuration("RATE_LIMIT_PURGE_INTERVAL", &c.RateLimit.PurgeInterval)
+	if c.RateLimit.Limits == nil {
+		c.RateLimit.Limits = map[string]string{}
+	}
+	for _, group := range RateLimitGroups {
+		if value := os.Getenv("RATE_LIMIT_" + strings.ToUpper(group)); value != "" {
+			c.RateLimit.Limits[group] = value
+		}
+	}
+
+	setString("TRACING_EXPORTER", &c.Tracing.Exporter)
+	setString("TRACING_SERVICE_NAME", &c.Tracing.ServiceName)
+	setString("TRACING_OTLP_ENDPOINT", &c.Tracing.OTLPEndpoint)
+	setBool("TRACING_OTLP_INSECURE", &c.Tracing.OTLPInsecure)
+	setFloat("TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio)
+
+	setDuration("RECORDS_TRASH_RETENTION", &c.Records.TrashRetention)
+	setDuration("RECORDS_TRASH_PURGE_INTERVAL", &c.Records.TrashPurgeInterval)
+	setDuration("RECORDS_TOMBSTONE_RETENTION", &c.Records.TombstoneRetention)
+	setDuration("IDEMPOTENCY_TTL", &c.Idempotency.TTL)
+	setDuration("IDEMPOTENCY_PURGE_INTERVAL", &c.Idempotency.PurgeInterval)
+	setDuration("WEBHOOKS_TIMEOUT", &c.Webhooks.Timeout)
+	setInt("WEBHOOKS_MAX_ATTEMPTS", &c.Webhooks.MaxAttempts)
+	setDuration("WEBHOOKS_RETRY_BASE_DELAY", &c.Webhooks.RetryBaseDelay)
+	setDuration("WEBHOOKS_RETRY_MAX_DELAY", &c.Webhooks.RetryMaxDelay)
+	setDuration("WEBHOOKS_DELIVERY_RETENTION", &c.Webhooks.DeliveryRetention)
+	setDuration("WEBHOOKS_PURGE_INTERVAL", &c.Webhooks.PurgeInterval)
+	setBool("WEBHOOKS_ALLOW_PRIVATE_ADDRESSES", &c.Webhooks.AllowPrivateAddresses)
+	setDuration("JOBS_POLL_INTERVAL", &c.Jobs.PollInterval)
+	setInt("JOBS_CONCURRENCY", &c.Jobs.Concurrency)
+	setDuration("JOBS_TIMEOUT", &c.Jobs.Timeout)
+	setInt("JOBS_MAX_ATTEMPTS", &c.Jobs.MaxAttempts)
+	setDuration("JOBS_RETRY_BASE_DELAY", &c.Jobs.RetryBaseDelay)
+	setDuration("JOBS_RETRY_MAX_DELAY", &c.Jobs.RetryMaxDelay)
+	setDuration("JOBS_RETENTION", &c.Jobs.Retention)
+	setDuration("JOBS_PURGE_INTERVAL", &c.Jobs.PurgeInterval)
+
+	setDuration("OIDC_LOGIN_TTL", &c.OIDC.LoginTTL)
+	setDuration("OIDC_PURGE_INTERVAL", &c.OIDC.PurgeInterval)
+
+	// OIDC_PROVIDERS=google,github replaces the providers of the config file,
+	// each one configured through OIDC_<NAME>_* variables
+	if names := os.Getenv("OIDC_PROVIDERS"); names != "" {
+		c.OIDC.Providers = nil
+		for _, name := range strings.Split(names, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			prefix := "OIDC_" + strings.ToUpper(name) + "_"
+			provider := OIDCProviderConfig{
+				Name:         name,
+				IssuerURL:    os.Getenv(prefix + "ISSUER_URL"),
+				ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+				ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+				RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			}
+			if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+				provider.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+			}
+			c.OIDC.Providers = append(c.OIDC.Providers, provider)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid or missing setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.App.Port <= 0 || c.App.Port > 65535 {
+		errs = append(errs, fmt.Errorf("app.port must be between 1 and 65535, got %d", c.App.Port))
+	}
+	if c.App.Env != EnvDevelopment && c.App.Env != EnvProduction {
+		errs = append(errs, fmt.Errorf("app.env must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.App.Env))
+	}
+	if c.App.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("app.shutdown_timeout must be positive"))
+	}
+	for _, proxy := range c.App.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("app.trusted_proxies: %q is not an IP or CIDR", proxy))
+		}
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("log.format must be json or text, got %q", c.Log.Format))
+	}
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn (POSTGRES_DSN) is required"))
+	}
+	if c.Security.JWTSecret == "" {
+		errs = append(errs, errors.New("security.jwt_secret (JWT_SECRET) is required"))
+	} else if c.IsProduction() && len(c.Security.JWTSecret) < minProductionSecretLength {
+		errs = append(errs, fmt.Errorf("security.jwt_secret must be at least %d characters in production", minProductionSecretLength))
+	}
+	if c.Security.JWTTTL <= 0 {
+		errs = append(errs, errors.New("security.jwt_ttl must be positive"))
+	}
+
+	if !isStore(c.Login.AttemptStore) {
+		errs = append(errs, fmt.Errorf("login.attempt_store must be %q or %q", StoreMemory, StorePostgres))
+	}
+	if c.Login.MaxFailures <= 0 || c.Login.MaxIPFailures <= 0 {
+		errs = append(errs, errors.New("login.max_failures and login.max_ip_failures must be positive"))
+	}
+	if c.Login.BaseDelay <= 0 || c.Login.MaxDelay < c.Login.BaseDelay {
+		errs = append(errs, errors.New("login.base_delay must be positive and not above login.max_delay"))
+	}
+	if c.Login.LockoutDuration <= 0 || c.Login.FailureWindow <= 0 {
+		errs = append(errs, errors.New("login.lockout_duration and login.failure_window must be positive"))
+	}
+
+	if !isStore(c.RateLimit.Store) {
+		errs = append(errs, fmt.Errorf("rate_limit.store must be %q or %q", StoreMemory, StorePostgres))
+	}
+	for _, group := range RateLimitGroups {
+		if _, err := c.RateLimit.Limit(group); err != nil {
+			errs = append(errs, fmt.Errorf("rate_limit.limits.%s: %w", group, err))
+		}
+	}
+	if c.RateLimit.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("rate_limit.purge_interval must be positive"))
+	}
+
+	switch c.Tracing.Exporter {
+	case ExporterNone, ExporterStdout:
+	case ExporterOTLP:
+		if c.Tracing.OTLPEndpoint == "" {
+			errs = append(errs, errors.New("tracing.otlp_endpoint is required with the otlp exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be %q, %q or %q, got %q", ExporterNone, ExporterStdout, ExporterOTLP, c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_ratio must be between 0 and 1, got %v", c.Tracing.SampleRatio))
+	}
+
+	if c.Records.TrashRetention <= 0 || c.Records.TrashPurgeInterval <= 0 || c.Records.TombstoneRetention <= 0 {
+		errs = append(errs, errors.New("records.trash_retention, records.trash_purge_interval and records.tombstone_retention must be positive"))
+	}
+	if c.Idempotency.TTL <= 0 || c.Idempotency.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("idempotency.ttl and idempotency.purge_interval must be positive"))
+	}
+	if c.Webhooks.Timeout <= 0 || c.Webhooks.DeliveryRetention <= 0 || c.Webhooks.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("webhooks.timeout, webhooks.delivery_retention and webhooks.purge_interval must be positive"))
+	}
+	if c.Webhooks.Timeout >= c.Jobs.Timeout {
+		errs = append(errs, errors.New("webhooks.timeout must be shorter than jobs.timeout, deliveries are sent by jobs"))
+	}
+	if c.Webhooks.MaxAttempts <= 0 {
+		errs = append(errs, errors.New("webhooks.max_attempts must be positive"))
+	}
+	if c.Webhooks.RetryBaseDelay <= 0 || c.Webhooks.RetryMaxDelay < c.Webhooks.RetryBaseDelay {
+		errs = append(errs, errors.New("webhooks.retry_base_delay must be positive and not above webhooks.retry_max_delay"))
+	}
+	if c.Jobs.PollInterval <= 0 || c.Jobs.Timeout <= 0 || c.Jobs.Retention <= 0 || c.Jobs.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("jobs.poll_interval, jobs.timeout, jobs.retention and jobs.purge_interval must be positive"))
+	}
+	if c.Jobs.Concurrency <= 0 || c.Jobs.MaxAttempts <= 0 {
+		errs = append(errs, errors.New("jobs.concurrency and jobs.max_attempts must be positive"))
+	}
+	if c.Jobs.RetryBaseDelay <= 0 || c.Jobs.RetryMaxDelay < c.Jobs.RetryBaseDelay {
+		errs = append(errs, errors.New("jobs.retry_base_delay must be positive and not above jobs.retry_max_delay"))
+	}
+
+	if c.OIDC.LoginTTL <= 0 || c.OIDC.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("oidc.login_ttl and oidc.purge_interval must be positive"))
+	}
+	seen := map[string]bool{}
+	for _, provider := range c.OIDC.Providers {
+		if provider.Name == "" {
+			errs = append(errs, errors.New("oidc provider without a name"))
+			continue
+		}
+		if seen[provider.Name] {
+			errs = append(errs, fmt.Errorf("oidc provider %s is configured twice", provider.Name))
+		}
+		seen[provider.Name] = true
+		if provider.IssuerURL == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			errs = append(errs, fmt.Errorf("oidc provider %s needs issuer_url, client_id and redirect_url", provider.Name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Limit returns the parsed limit of a route group.
+func (c RateLimitConfig) Limit(group string) (models.RateLimit, error) {
+	return models.ParseRateLimit(c.Limits[group])
+}
+
+// LongestPeriod is the longest period of the route group limits. A bucket
+// left alone that long is full again.
+func (c RateLimitConfig) LongestPeriod() time.Duration {
+	var longest time.Duration
+	for _, group := range RateLimitGroups {
+		if limit, err := c.Limit(group); err == nil {
+			longest = max(longest, limit.Period)
+		}
+	}
+	return longest
+}
+
+func (c *Config) IsProduction() bool {
+	return c.App.Env == EnvProduction
+}
+
+func isStore(store string) bool {
+	return store == StoreMemory || store == StorePostgres
+}
@@ -1,58 +1,88 @@
 package database
 
 import (
-	"log"
-
-	"github.com/aq-simei/coin-pilot/api/models"
-	"github.com/aq-simei/coin-pilot/internal/config/environment"
+	"github.com/aq-simei/coin-pilot/internal/config"
+	"github.com/aq-simei/coin-pilot/internal/config/database/migrations"
 	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/aq-simei/coin-pilot/internal/metrics"
+	"github.com/go-gormigrate/gormigrate/v2"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	otelgorm "gorm.io/plugin/opentelemetry/tracing"
 )
 
-func NewDB() *gorm.DB {
-	environment.LoadEnv()
-
-	dsn := environment.GetEnv("POSTGRES_DSN")
-	if dsn == "" {
-		logger.Fatal("POSTGRES_DSN is not set")
-	}
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+func NewDB(cfg config.DatabaseConfig) *gorm.DB {
+	db, err := gorm.Open(postgres.Open(cfg.DSN), &gorm.Config{Logger: newGormLogger()})
 	if err != nil {
 		logger.Fatal("Failed to connect to PostgreSQL: %v", err)
 	}
+	if err := db.Use(metrics.NewGormPlugin("coinpilot")); err != nil {
+		logger.Fatal("Failed to install database metrics: %v", err)
+	}
+	// Query arguments stay out of spans, they may hold personal data
+	if err := db.Use(otelgorm.NewPlugin(otelgorm.WithoutMetrics(), otelgorm.WithoutQueryVariables())); err != nil {
+		logger.Fatal("Failed to install database tracing: %v", err)
+	}
 	logger.Info("Connected to PostgreSQL")
 	return db
 }
 
-func RunMigrations(db *gorm.DB) {
-	// Check if the enum type 'record_type' exists before creating it
-	var exists bool
-	err := db.Raw(`
-		SELECT EXISTS (
-			SELECT 1
-			FROM pg_type
-			WHERE typname = 'record_type'
-		)
-	`).Scan(&exists).Error
-	if err != nil {
-		log.Fatalf("❌ Could not check if enum type exists: %v", err)
-	}
+// MigrationState reports whether a known migration was applied.
+type MigrationState struct {
+	ID      string
+	Applied bool
+}
+
+func newMigrator(db *gorm.DB) *gormigrate.Gormigrate {
+	options := *gormigrate.DefaultOptions
+	options.UseTransaction = true
+	options.ValidateUnknownMigrations = true
+	return gormigrate.New(db, &options, migrations.All())
+}
 
-	if !exists {
-		if err := db.Exec("CREATE TYPE record_type AS ENUM ('income', 'expense')").Error; err != nil {
-			log.Fatalf("❌ Could not create enum type: %v", err)
+// MigrateUp applies every pending migration.
+func MigrateUp(db *gorm.DB) error {
+	return newMigrator(db).Migrate()
+}
+
+// MigrateDown rolls back the most recently applied migration.
+func MigrateDown(db *gorm.DB) error {
+	return newMigrator(db).RollbackLast()
+}
+
+// MigrationStatus lists every known migration in order with its state.
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	applied := map[string]bool{}
+	if db.Migrator().HasTable(gormigrate.DefaultOptions.TableName) {
+		var ids []string
+		err := db.Table(gormigrate.DefaultOptions.TableName).
+			Pluck(gormigrate.DefaultOptions.IDColumnName, &ids).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			applied[id] = true
 		}
-		log.Println("✅ Enum type 'record_type' created successfully")
-	} else {
-		log.Println("ℹ️ Enum type 'record_type' already exists")
 	}
 
-	// Use AutoMigrate for development environments
-	if err := db.AutoMigrate(&models.User{}, &models.Record{}); err != nil {
-		log.Fatalf("❌ Could not auto migrate: %v", err)
-	} else {
-		log.Println("✅ Auto migration ran successfully")
+	var states []MigrationState
+	for _, migration := range migrations.All() {
+		states = append(states, MigrationState{ID: migration.ID, Applied: applied[migration.ID]})
+	}
+	return states, nil
+}
+
+// PendingMigrations returns the IDs of the migrations not applied yet.
+func PendingMigrations(db *gorm.DB) ([]string, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, state := range states {
+		if !state.Applied {
+			pending = append(pending, state.ID)
+		}
 	}
+	return pending, nil
 }
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold is the duration above which a query is logged at WARN.
+const slowQueryThreshold = 200 * time.Millisecond
+
+// gormLogger routes GORM output through the application logger so SQL errors
+// and slow queries carry the request ID of the context they ran with.
+type gormLogger struct {
+	level gormlogger.LogLevel
+}
+
+func newGormLogger() gormlogger.Interface {
+	return &gormLogger{level: gormlogger.Warn}
+}
+
+func (l *gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	return &gormLogger{level: level}
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Info {
+		logger.InfoCtx(ctx, msg, data...)
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		logger.WarnCtx(ctx, msg, data...)
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Error {
+		logger.ErrorCtx(ctx, msg, data...)
+	}
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= gormlogger.Error:
+		sql, rows := fc()
+		logger.L().LogAttrs(ctx, slog.LevelError, "query failed",
+			slog.String("sql", sql), slog.Int64("rows", rows), slog.Duration("elapsed", elapsed), slog.String("error", err.Error()))
+	case elapsed > slowQueryThreshold && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		logger.L().LogAttrs(ctx, slog.LevelWarn, fmt.Sprintf("slow query over %s", slowQueryThreshold),
+			slog.String("sql", sql), slog.Int64("rows", rows), slog.Duration("elapsed", elapsed))
+	case l.level >= gormlogger.Info:
+		sql, rows := fc()
+		logger.L().LogAttrs(ctx, slog.LevelDebug, "query",
+			slog.String("sql", sql), slog.Int64("rows", rows), slog.Duration("elapsed", elapsed))
+	}
+}
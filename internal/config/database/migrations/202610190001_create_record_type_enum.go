@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func createRecordTypeEnum() *gormigrate.Migration {
+	return &gormigrate.Migration{
+		ID: "202610190001_create_record_type_enum",
+		Migrate: func(tx *gorm.DB) error {
+			// Databases created before versioned migrations already have the type
+			return tx.Exec(`
+				DO $$ BEGIN
+					CREATE TYPE record_type AS ENUM ('income', 'expense');
+				EXCEPTION WHEN duplicate_object THEN NULL;
+				END $$;
+			`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Exec("DROP TYPE IF EXISTS record_type").Error
+		},
+	}
+}
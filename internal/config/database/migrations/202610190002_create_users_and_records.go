@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+func createUsersAndRecords() *gormigrate.Migration {
+	type Record struct {
+		ID          string `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		Name        string `gorm:"not null"`
+		Description string `gorm:"type:text;default:''"`
+		Date        time.Time
+		Tags        pq.StringArray `gorm:"type:text[]"`
+		Type        string         `gorm:"type:record_type;not null;index"`
+		Amount      int64          `gorm:"not null"`
+		CreatedAt   time.Time      `gorm:"autoCreateTime"`
+		UpdatedAt   time.Time      `gorm:"autoUpdateTime"`
+		DeletedAt   *time.Time     `gorm:"index"`
+		UserID      string         `gorm:"not null;index"`
+	}
+	type User struct {
+		ID        string         `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		Name      string         `gorm:"not null"`
+		Email     string         `gorm:"unique;not null"`
+		Password  string         `gorm:"not null"`
+		Records   []Record       `gorm:"foreignKey:UserID"`
+		CreatedAt time.Time      `gorm:"not null;default:current_timestamp"`
+		UpdatedAt time.Time      `gorm:"not null;default:current_timestamp"`
+		DeletedAt gorm.DeletedAt `gorm:"index"`
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190002_create_users_and_records",
+		Migrate: func(tx *gorm.DB) error {
+			// AutoMigrate adopts tables created by the former boot-time AutoMigrate
+			return tx.AutoMigrate(&User{}, &Record{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("records", "users")
+		},
+	}
+}
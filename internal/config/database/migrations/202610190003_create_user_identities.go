@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func createUserIdentities() *gormigrate.Migration {
+	type User struct {
+		ID string `gorm:"type:string;primaryKey"`
+	}
+	type UserIdentity struct {
+		ID        string    `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		UserID    string    `gorm:"not null;index"`
+		Provider  string    `gorm:"not null;uniqueIndex:idx_identity_provider_subject"`
+		Subject   string    `gorm:"not null;uniqueIndex:idx_identity_provider_subject"`
+		Email     string    `gorm:"not null"`
+		CreatedAt time.Time `gorm:"not null;default:current_timestamp"`
+		UpdatedAt time.Time `gorm:"not null;default:current_timestamp"`
+		User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190003_create_user_identities",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&UserIdentity{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("user_identities")
+		},
+	}
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func addUserRolesAndAuditLogs() *gormigrate.Migration {
+	type User struct {
+		ID     string `gorm:"type:string;primaryKey"`
+		Role   string `gorm:"not null;default:'user';index"`
+		Status string `gorm:"not null;default:'active';index"`
+	}
+	type AuditLog struct {
+		ID         string `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		ActorID    string `gorm:"not null;index"`
+		ActorRole  string `gorm:"not null"`
+		Action     string `gorm:"not null;index"`
+		TargetID   string `gorm:"index"`
+		Details    string `gorm:"type:text;default:''"`
+		StatusCode int    `gorm:"not null"`
+		IP         string
+		CreatedAt  time.Time `gorm:"not null;default:current_timestamp;index"`
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190004_add_user_roles_and_audit_logs",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&User{}, &AuditLog{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable("audit_logs"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropColumn(&User{}, "Status"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&User{}, "Role")
+		},
+	}
+}
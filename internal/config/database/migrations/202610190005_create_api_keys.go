@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+func createAPIKeys() *gormigrate.Migration {
+	type User struct {
+		ID string `gorm:"type:string;primaryKey"`
+	}
+	type APIKey struct {
+		ID         string         `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		UserID     string         `gorm:"not null;index"`
+		Name       string         `gorm:"not null"`
+		Prefix     string         `gorm:"not null;uniqueIndex"`
+		KeyHash    string         `gorm:"not null"`
+		Scopes     pq.StringArray `gorm:"type:text[];not null"`
+		ExpiresAt  *time.Time
+		LastUsedAt *time.Time
+		RevokedAt  *time.Time
+		CreatedAt  time.Time `gorm:"not null;default:current_timestamp"`
+		User       User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190005_create_api_keys",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&APIKey{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("api_keys")
+		},
+	}
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func createLoginAttempts() *gormigrate.Migration {
+	type LoginAttempt struct {
+		Key           string    `gorm:"primaryKey"`
+		Failures      int       `gorm:"not null;default:0"`
+		LastFailureAt time.Time `gorm:"not null"`
+		LockedUntil   *time.Time
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190006_create_login_attempts",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&LoginAttempt{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("login_attempts")
+		},
+	}
+}
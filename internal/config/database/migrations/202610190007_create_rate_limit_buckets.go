@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func createRateLimitBuckets() *gormigrate.Migration {
+	type RateLimitBucket struct {
+		Key       string    `gorm:"primaryKey"`
+		Tokens    float64   `gorm:"not null"`
+		UpdatedAt time.Time `gorm:"not null;index"`
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190007_create_rate_limit_buckets",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&RateLimitBucket{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("rate_limit_buckets")
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func createRecordHistory() *gormigrate.Migration {
+	type RecordHistory struct {
+		ID        string `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		RecordID  string `gorm:"not null;index"`
+		UserID    string `gorm:"not null;index"`
+		Action    string `gorm:"not null"`
+		ActorType string `gorm:"not null"`
+		ActorID   string
+		Source    string    `gorm:"not null"`
+		Before    []byte    `gorm:"type:jsonb"`
+		After     []byte    `gorm:"type:jsonb"`
+		CreatedAt time.Time `gorm:"not null;default:current_timestamp;index"`
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190008_create_record_history",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.Table("record_history").AutoMigrate(&RecordHistory{}); err != nil {
+				return err
+			}
+			// Entries are append-only, the database refuses to change them
+			return tx.Exec(`
+				CREATE FUNCTION record_history_append_only() RETURNS trigger AS $$
+				BEGIN
+					RAISE EXCEPTION 'record_history is append-only';
+				END;
+				$$ LANGUAGE plpgsql;
+
+				CREATE TRIGGER record_history_append_only
+				BEFORE UPDATE OR DELETE ON record_history
+				FOR EACH ROW EXECUTE FUNCTION record_history_append_only();
+			`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable("record_history"); err != nil {
+				return err
+			}
+			return tx.Exec("DROP FUNCTION IF EXISTS record_history_append_only()").Error
+		},
+	}
+}
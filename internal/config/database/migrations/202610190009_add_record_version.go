@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func addRecordVersion() *gormigrate.Migration {
+	type Record struct {
+		ID      string `gorm:"type:string;primaryKey"`
+		Version int64  `gorm:"not null;default:1"`
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190009_add_record_version",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&Record{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&Record{}, "Version")
+		},
+	}
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func createIdempotencyKeys() *gormigrate.Migration {
+	type IdempotencyKey struct {
+		UserID          string `gorm:"primaryKey"`
+		Key             string `gorm:"primaryKey"`
+		RequestHash     string `gorm:"not null"`
+		StatusCode      int    `gorm:"not null;default:0"`
+		ResponseHeaders []byte `gorm:"type:jsonb"`
+		ResponseBody    []byte
+		CreatedAt       time.Time `gorm:"not null"`
+		CompletedAt     *time.Time
+		ExpiresAt       time.Time `gorm:"not null;index"`
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190010_create_idempotency_keys",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&IdempotencyKey{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("idempotency_keys")
+		},
+	}
+}
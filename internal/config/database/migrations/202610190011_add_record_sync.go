@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// addRecordSync stamps every record change with the ID of the transaction
+// that made it, and keeps a tombstone for purged records, so clients can ask
+// for what changed since their last sync. xid8 needs PostgreSQL 13.
+func addRecordSync() *gormigrate.Migration {
+	return &gormigrate.Migration{
+		ID: "202610190011_add_record_sync",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.Exec(`
+				ALTER TABLE records ADD COLUMN sync_xid xid8 NOT NULL DEFAULT pg_current_xact_id();
+				CREATE INDEX idx_records_user_sync ON records (user_id, sync_xid, id);
+
+				CREATE TABLE record_tombstones (
+					record_id text PRIMARY KEY,
+					user_id text NOT NULL,
+					sync_xid xid8 NOT NULL,
+					deleted_at timestamptz NOT NULL
+				);
+				CREATE INDEX idx_record_tombstones_user_sync ON record_tombstones (user_id, sync_xid, record_id);
+				CREATE INDEX idx_record_tombstones_deleted_at ON record_tombstones (deleted_at);
+
+				CREATE FUNCTION records_set_sync_xid() RETURNS trigger AS $$
+				BEGIN
+					NEW.sync_xid := pg_current_xact_id();
+					IF TG_OP = 'INSERT' THEN
+						-- A purged ID can come back from a client that had it offline
+						DELETE FROM record_tombstones WHERE record_id = NEW.id;
+					END IF;
+					RETURN NEW;
+				END;
+				$$ LANGUAGE plpgsql;
+
+				CREATE TRIGGER records_set_sync_xid
+				BEFORE INSERT OR UPDATE ON records
+				FOR EACH ROW EXECUTE FUNCTION records_set_sync_xid();
+
+				CREATE FUNCTION records_write_tombstone() RETURNS trigger AS $$
+				BEGIN
+					INSERT INTO record_tombstones (record_id, user_id, sync_xid, deleted_at)
+					VALUES (OLD.id, OLD.user_id, pg_current_xact_id(), now())
+					ON CONFLICT (record_id) DO UPDATE
+					SET user_id = EXCLUDED.user_id, sync_xid = EXCLUDED.sync_xid, deleted_at = EXCLUDED.deleted_at;
+					RETURN OLD;
+				END;
+				$$ LANGUAGE plpgsql;
+
+				CREATE TRIGGER records_write_tombstone
+				AFTER DELETE ON records
+				FOR EACH ROW EXECUTE FUNCTION records_write_tombstone();
+			`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Exec(`
+				DROP TRIGGER IF EXISTS records_write_tombstone ON records;
+				DROP TRIGGER IF EXISTS records_set_sync_xid ON records;
+				DROP FUNCTION IF EXISTS records_write_tombstone();
+				DROP FUNCTION IF EXISTS records_set_sync_xid();
+				DROP TABLE IF EXISTS record_tombstones;
+				DROP INDEX IF EXISTS idx_records_user_sync;
+				ALTER TABLE records DROP COLUMN IF EXISTS sync_xid;
+			`).Error
+		},
+	}
+}
@@ -0,0 +1,117 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// createLedgers moves record ownership from users to ledgers. Every existing
+// user gets a personal ledger holding their records.
+func createLedgers() *gormigrate.Migration {
+	type Ledger struct {
+		ID             string  `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		Name           string  `gorm:"not null"`
+		PersonalUserID *string `gorm:"uniqueIndex"`
+		CreatedAt      time.Time
+		UpdatedAt      time.Time
+	}
+	type LedgerMember struct {
+		LedgerID  string `gorm:"primaryKey"`
+		UserID    string `gorm:"primaryKey;index"`
+		Role      string `gorm:"not null"`
+		CreatedAt time.Time
+	}
+	type LedgerInvitation struct {
+		ID          string    `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		LedgerID    string    `gorm:"not null;index"`
+		Email       string    `gorm:"not null;index"`
+		Role        string    `gorm:"not null"`
+		InvitedBy   string    `gorm:"not null"`
+		TokenHash   string    `gorm:"not null;uniqueIndex"`
+		Status      string    `gorm:"not null;default:'pending'"`
+		ExpiresAt   time.Time `gorm:"not null"`
+		CreatedAt   time.Time
+		RespondedAt *time.Time
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190012_create_ledgers",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&Ledger{}, &LedgerMember{}, &LedgerInvitation{}); err != nil {
+				return err
+			}
+			return tx.Exec(`
+				ALTER TABLE ledger_members
+					ADD CONSTRAINT fk_ledger_members_ledger FOREIGN KEY (ledger_id) REFERENCES ledgers (id) ON DELETE CASCADE,
+					ADD CONSTRAINT fk_ledger_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+				ALTER TABLE ledger_invitations
+					ADD CONSTRAINT fk_ledger_invitations_ledger FOREIGN KEY (ledger_id) REFERENCES ledgers (id) ON DELETE CASCADE;
+
+				INSERT INTO ledgers (name, personal_user_id, created_at, updated_at)
+				SELECT 'Personal', id, now(), now() FROM users;
+				INSERT INTO ledger_members (ledger_id, user_id, role, created_at)
+				SELECT id, personal_user_id, 'owner', now() FROM ledgers WHERE personal_user_id IS NOT NULL;
+
+				ALTER TABLE records ADD COLUMN ledger_id text;
+				UPDATE records SET ledger_id = ledgers.id FROM ledgers WHERE ledgers.personal_user_id = records.user_id;
+				ALTER TABLE records
+					ALTER COLUMN ledger_id SET NOT NULL,
+					ADD CONSTRAINT fk_records_ledger FOREIGN KEY (ledger_id) REFERENCES ledgers (id) ON DELETE CASCADE;
+				DROP INDEX IF EXISTS idx_records_user_sync;
+				CREATE INDEX idx_records_ledger_sync ON records (ledger_id, sync_xid, id);
+
+				ALTER TABLE record_tombstones ADD COLUMN ledger_id text;
+				UPDATE record_tombstones SET ledger_id = ledgers.id FROM ledgers WHERE ledgers.personal_user_id = record_tombstones.user_id;
+				DELETE FROM record_tombstones WHERE ledger_id IS NULL;
+				ALTER TABLE record_tombstones ALTER COLUMN ledger_id SET NOT NULL;
+				DROP INDEX IF EXISTS idx_record_tombstones_user_sync;
+				CREATE INDEX idx_record_tombstones_ledger_sync ON record_tombstones (ledger_id, sync_xid, record_id);
+
+				CREATE OR REPLACE FUNCTION records_write_tombstone() RETURNS trigger AS $$
+				BEGIN
+					INSERT INTO record_tombstones (record_id, user_id, ledger_id, sync_xid, deleted_at)
+					VALUES (OLD.id, OLD.user_id, OLD.ledger_id, pg_current_xact_id(), now())
+					ON CONFLICT (record_id) DO UPDATE
+					SET user_id = EXCLUDED.user_id, ledger_id = EXCLUDED.ledger_id,
+						sync_xid = EXCLUDED.sync_xid, deleted_at = EXCLUDED.deleted_at;
+					RETURN OLD;
+				END;
+				$$ LANGUAGE plpgsql;
+
+				-- History is append-only, the backfill is the one exception
+				ALTER TABLE record_history ADD COLUMN ledger_id text;
+				ALTER TABLE record_history DISABLE TRIGGER record_history_append_only;
+				UPDATE record_history SET ledger_id = ledgers.id FROM ledgers WHERE ledgers.personal_user_id = record_history.user_id;
+				ALTER TABLE record_history ENABLE TRIGGER record_history_append_only;
+				CREATE INDEX idx_record_history_ledger_id ON record_history (ledger_id);
+			`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Exec(`
+				DROP INDEX IF EXISTS idx_record_history_ledger_id;
+				ALTER TABLE record_history DROP COLUMN IF EXISTS ledger_id;
+
+				CREATE OR REPLACE FUNCTION records_write_tombstone() RETURNS trigger AS $$
+				BEGIN
+					INSERT INTO record_tombstones (record_id, user_id, sync_xid, deleted_at)
+					VALUES (OLD.id, OLD.user_id, pg_current_xact_id(), now())
+					ON CONFLICT (record_id) DO UPDATE
+					SET user_id = EXCLUDED.user_id, sync_xid = EXCLUDED.sync_xid, deleted_at = EXCLUDED.deleted_at;
+					RETURN OLD;
+				END;
+				$$ LANGUAGE plpgsql;
+				DROP INDEX IF EXISTS idx_record_tombstones_ledger_sync;
+				ALTER TABLE record_tombstones DROP COLUMN IF EXISTS ledger_id;
+				CREATE INDEX IF NOT EXISTS idx_record_tombstones_user_sync ON record_tombstones (user_id, sync_xid, record_id);
+
+				DROP INDEX IF EXISTS idx_records_ledger_sync;
+				ALTER TABLE records DROP COLUMN IF EXISTS ledger_id;
+				CREATE INDEX IF NOT EXISTS idx_records_user_sync ON records (user_id, sync_xid, id);
+
+				DROP TABLE IF EXISTS ledger_invitations, ledger_members, ledgers;
+			`).Error
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// createGroups adds groups splitting expenses between their members.
+// Members referenced by an expense or settlement cannot be deleted.
+func createGroups() *gormigrate.Migration {
+	type Group struct {
+		ID        string `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		Name      string `gorm:"not null"`
+		CreatedBy string `gorm:"not null"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	type GroupMember struct {
+		ID        string `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		GroupID   string `gorm:"not null;index"`
+		UserID    *string
+		Name      string `gorm:"not null"`
+		CreatedAt time.Time
+	}
+	type GroupExpense struct {
+		ID          string    `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		GroupID     string    `gorm:"not null;index"`
+		Description string    `gorm:"not null"`
+		Amount      int64     `gorm:"not null"`
+		Date        time.Time `gorm:"not null"`
+		PaidBy      string    `gorm:"not null"`
+		SplitType   string    `gorm:"not null"`
+		RecordID    *string
+		CreatedBy   string `gorm:"not null"`
+		CreatedAt   time.Time
+	}
+	type GroupExpenseShare struct {
+		ExpenseID string `gorm:"primaryKey"`
+		MemberID  string `gorm:"primaryKey"`
+		Value     int64  `gorm:"not null"`
+		Amount    int64  `gorm:"not null"`
+	}
+	type GroupSettlement struct {
+		ID        string    `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		GroupID   string    `gorm:"not null;index"`
+		FromID    string    `gorm:"not null"`
+		ToID      string    `gorm:"not null"`
+		Amount    int64     `gorm:"not null"`
+		Date      time.Time `gorm:"not null"`
+		Note      string
+		CreatedBy string `gorm:"not null"`
+		CreatedAt time.Time
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190013_create_groups",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&Group{}, &GroupMember{}, &GroupExpense{}, &GroupExpenseShare{}, &GroupSettlement{}); err != nil {
+				return err
+			}
+			return tx.Exec(`
+				ALTER TABLE group_members
+					ADD CONSTRAINT fk_group_members_group FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+					ADD CONSTRAINT fk_group_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+				CREATE UNIQUE INDEX idx_group_members_group_user ON group_members (group_id, user_id) WHERE user_id IS NOT NULL;
+				CREATE INDEX idx_group_members_user_id ON group_members (user_id);
+
+				ALTER TABLE group_expenses
+					ADD CONSTRAINT fk_group_expenses_group FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+					ADD CONSTRAINT fk_group_expenses_paid_by FOREIGN KEY (paid_by) REFERENCES group_members (id),
+					ADD CONSTRAINT fk_group_expenses_record FOREIGN KEY (record_id) REFERENCES records (id) ON DELETE SET NULL,
+					ADD CONSTRAINT chk_group_expenses_amount CHECK (amount > 0);
+				ALTER TABLE group_expense_shares
+					ADD CONSTRAINT fk_group_expense_shares_expense FOREIGN KEY (expense_id) REFERENCES group_expenses (id) ON DELETE CASCADE,
+					ADD CONSTRAINT fk_group_expense_shares_member FOREIGN KEY (member_id) REFERENCES group_members (id);
+				CREATE INDEX idx_group_expense_shares_member_id ON group_expense_shares (member_id);
+
+				ALTER TABLE group_settlements
+					ADD CONSTRAINT fk_group_settlements_group FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+					ADD CONSTRAINT fk_group_settlements_from FOREIGN KEY (from_id) REFERENCES group_members (id),
+					ADD CONSTRAINT fk_group_settlements_to FOREIGN KEY (to_id) REFERENCES group_members (id),
+					ADD CONSTRAINT chk_group_settlements_amount CHECK (amount > 0 AND from_id <> to_id);
+			`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("group_settlements", "group_expense_shares", "group_expenses", "group_members", "groups")
+		},
+	}
+}
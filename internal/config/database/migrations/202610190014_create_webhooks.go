@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// createWebhooks adds webhook endpoints and the queue of their deliveries,
+// which doubles as the delivery log.
+func createWebhooks() *gormigrate.Migration {
+	type Webhook struct {
+		ID          string         `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		UserID      string         `gorm:"not null;index"`
+		URL         string         `gorm:"not null"`
+		Description string         `gorm:"not null;default:''"`
+		Events      pq.StringArray `gorm:"type:text[];not null"`
+		Secret      string         `gorm:"not null"`
+		Active      bool           `gorm:"not null;default:true"`
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+	}
+	type WebhookDelivery struct {
+		ID             string `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		WebhookID      string `gorm:"not null"`
+		EventID        string `gorm:"not null"`
+		Event          string `gorm:"not null"`
+		Payload        string `gorm:"type:jsonb;not null"`
+		Status         string `gorm:"not null;default:pending"`
+		Attempts       int    `gorm:"not null;default:0"`
+		NextAttemptAt  *time.Time
+		ResponseStatus *int
+		ResponseBody   string `gorm:"not null;default:''"`
+		Error          string `gorm:"not null;default:''"`
+		DurationMS     int64  `gorm:"not null;default:0"`
+		DeliveredAt    *time.Time
+		CreatedAt      time.Time
+		UpdatedAt      time.Time
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190014_create_webhooks",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&Webhook{}, &WebhookDelivery{}); err != nil {
+				return err
+			}
+			return tx.Exec(`
+				ALTER TABLE webhooks
+					ADD CONSTRAINT fk_webhooks_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+				ALTER TABLE webhook_deliveries
+					ADD CONSTRAINT fk_webhook_deliveries_webhook FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE,
+					ADD CONSTRAINT chk_webhook_deliveries_status CHECK (status IN ('pending', 'succeeded', 'failed'));
+				CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, created_at DESC);
+				-- The dispatcher only looks at deliveries waiting for an attempt
+				CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+			`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("webhook_deliveries", "webhooks")
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// createJobs adds the queue of background jobs. Repositories insert jobs in
+// the transaction of the change causing them, the table doubles as outbox.
+func createJobs() *gormigrate.Migration {
+	type Job struct {
+		ID          string    `gorm:"type:string;default:gen_random_uuid();primaryKey"`
+		Kind        string    `gorm:"not null"`
+		Payload     string    `gorm:"type:jsonb;not null"`
+		Status      string    `gorm:"not null;default:pending"`
+		Attempts    int       `gorm:"not null;default:0"`
+		RunAt       time.Time `gorm:"not null"`
+		LockedUntil *time.Time
+		LastError   string `gorm:"not null;default:''"`
+		UniqueKey   *string
+		FinishedAt  *time.Time
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190015_create_jobs",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&Job{}); err != nil {
+				return err
+			}
+			return tx.Exec(`
+				ALTER TABLE jobs
+					ADD CONSTRAINT chk_jobs_status CHECK (status IN ('pending', 'running', 'succeeded', 'dead'));
+				CREATE UNIQUE INDEX idx_jobs_unique_key ON jobs (unique_key) WHERE unique_key IS NOT NULL;
+				-- Runners only look at due jobs and expired locks
+				CREATE INDEX idx_jobs_due ON jobs (run_at) WHERE status = 'pending';
+				CREATE INDEX idx_jobs_locked ON jobs (locked_until) WHERE status = 'running';
+				CREATE INDEX idx_jobs_status ON jobs (status, created_at DESC);
+			`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("jobs")
+		},
+	}
+}
@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// dropWebhookResponseBodies stops keeping webhook responses in the delivery
+// log, they let users read what internal services answer.
+func dropWebhookResponseBodies() *gormigrate.Migration {
+	return &gormigrate.Migration{
+		ID: "202610190016_drop_webhook_response_bodies",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.Exec(`ALTER TABLE webhook_deliveries DROP COLUMN response_body`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Exec(`ALTER TABLE webhook_deliveries ADD COLUMN response_body text NOT NULL DEFAULT ''`).Error
+		},
+	}
+}
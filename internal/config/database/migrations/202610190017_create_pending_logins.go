@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func createPendingLogins() *gormigrate.Migration {
+	type PendingLogin struct {
+		State        string    `gorm:"primaryKey"`
+		Provider     string    `gorm:"not null"`
+		CodeVerifier string    `gorm:"not null"`
+		Nonce        string    `gorm:"not null"`
+		CreatedAt    time.Time `gorm:"not null"`
+		ExpiresAt    time.Time `gorm:"not null;index"`
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190017_create_pending_logins",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&PendingLogin{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("pending_logins")
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+func addEmailVerification() *gormigrate.Migration {
+	type User struct {
+		ID              string `gorm:"type:string;primaryKey"`
+		EmailVerifiedAt *time.Time
+	}
+	type PendingLogin struct {
+		State  string `gorm:"primaryKey"`
+		UserID *string
+	}
+
+	return &gormigrate.Migration{
+		ID: "202610190018_add_email_verification",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&User{}, &PendingLogin{}); err != nil {
+				return err
+			}
+			// Accounts created by a provider have the email it verified
+			return tx.Exec(`
+				UPDATE users SET email_verified_at = users.created_at
+				WHERE users.password = '' AND EXISTS (
+					SELECT 1 FROM user_identities
+					WHERE user_identities.user_id = users.id AND user_identities.email = users.email
+				)`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&PendingLogin{}, "UserID"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&User{}, "EmailVerifiedAt")
+		},
+	}
+}
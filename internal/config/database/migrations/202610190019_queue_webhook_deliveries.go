@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// queueWebhookDeliveries moves the pending webhook deliveries to the job
+// queue, which sends them from now on. The jobs keep the attempts already
+// made.
+func queueWebhookDeliveries() *gormigrate.Migration {
+	return &gormigrate.Migration{
+		ID: "202610190019_queue_webhook_deliveries",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.Exec(`
+				INSERT INTO jobs (kind, payload, status, attempts, run_at, created_at, updated_at)
+				SELECT 'webhook.delivery', jsonb_build_object('delivery_id', id), 'pending', attempts,
+					coalesce(next_attempt_at, now()), now(), now()
+				FROM webhook_deliveries
+				WHERE status = 'pending'`).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Exec(`DELETE FROM jobs WHERE kind = 'webhook.delivery' AND status IN ('pending', 'running')`).Error
+		},
+	}
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import "github.com/go-gormigrate/gormigrate/v2"
+
+// All returns every schema migration in the order it must be applied. New
+// migrations are appended, existing ones must never be edited once released.
+//
+// Migrations declare their own snapshot of the structs they touch instead of
+// using api/models, so later model changes cannot alter what they do.
+func All() []*gormigrate.Migration {
+	return []*gormigrate.Migration{
+		createRecordTypeEnum(),
+		createUsersAndRecords(),
+		createUserIdentities(),
+		addUserRolesAndAuditLogs(),
+		createAPIKeys(),
+		createLoginAttempts(),
+		createRateLimitBuckets(),
+		createRecordHistory(),
+		addRecordVersion(),
+		createIdempotencyKeys(),
+		addRecordSync(),
+		createLedgers(),
+		createGroups(),
+		createWebhooks(),
+		createJobs(),
+		dropWebhookResponseBodies(),
+		createPendingLogins(),
+		addEmailVerification(),
+		queueWebhookDeliveries(),
+	}
+}
@@ -0,0 +1,20 @@
+package logger
+
+import "context"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID, which is
+// then added to every record logged with that context.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -1,8 +1,17 @@
 package logger
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -10,53 +19,148 @@ const (
 	LevelInfo  = "INFO"
 	LevelWarn  = "WARN"
 	LevelError = "ERROR"
+
+	FormatJSON = "json"
+	FormatText = "text"
 )
 
 var (
-	debugLogger *log.Logger
-	infoLogger  *log.Logger
-	warnLogger  *log.Logger
-	errorLogger *log.Logger
+	level   = new(slog.LevelVar)
+	current atomic.Pointer[slog.Logger]
 )
 
+// Init installs the default logger: JSON on stdout at INFO level.
 func Init() {
-	debugLogger = log.New(os.Stdout, "[DEBUG] ", log.Ldate|log.Ltime|log.Lshortfile)
-	infoLogger = log.New(os.Stdout, "[INFO] ", log.Ldate|log.Ltime)
-	warnLogger = log.New(os.Stdout, "[WARN] ", log.Ldate|log.Ltime)
-	errorLogger = log.New(os.Stderr, "[ERROR] ", log.Ldate|log.Ltime|log.Lshortfile)
+	level.Set(slog.LevelInfo)
+	current.Store(newLogger(os.Stdout, FormatJSON))
 }
 
-func Debug(format string, v ...interface{}) {
-	if debugLogger == nil {
-		Init()
+// Configure changes the level and output format of the logger.
+func Configure(levelName, format string) error {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(levelName)); err != nil {
+		return fmt.Errorf("invalid log level %q", levelName)
 	}
-	debugLogger.Printf(format, v...)
+	if format != FormatJSON && format != FormatText {
+		return fmt.Errorf("invalid log format %q, expected %s or %s", format, FormatJSON, FormatText)
+	}
+	level.Set(parsed)
+	current.Store(newLogger(os.Stdout, format))
+	return nil
 }
 
-func Info(format string, v ...interface{}) {
-	if infoLogger == nil {
-		Init()
+func newLogger(w io.Writer, format string) *slog.Logger {
+	options := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}
+	var handler slog.Handler
+	if format == FormatText {
+		handler = slog.NewTextHandler(w, options)
+	} else {
+		handler = slog.NewJSONHandler(w, options)
 	}
-	infoLogger.Printf(format, v...)
+	return slog.New(contextHandler{handler})
 }
 
-func Warn(format string, v ...interface{}) {
-	if warnLogger == nil {
-		Init()
+// L returns the structured logger, for call sites that log attributes
+// rather than a formatted message.
+func L() *slog.Logger {
+	if logger := current.Load(); logger != nil {
+		return logger
 	}
-	warnLogger.Printf(format, v...)
+	Init()
+	return current.Load()
 }
 
-func Error(format string, v ...interface{}) {
-	if errorLogger == nil {
-		Init()
+// contextHandler adds the request ID and trace carried by the context to every
+// record and scrubs secrets out of messages.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
 	}
-	errorLogger.Printf(format, v...)
+	record.Message = Redact(record.Message)
+	return h.Handler.Handle(ctx, record)
 }
 
-func Fatal(format string, v ...interface{}) {
-	if errorLogger == nil {
-		Init()
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// logf formats the message and logs it with the caller of the exported
+// function as source.
+func logf(ctx context.Context, lvl slog.Level, format string, v ...interface{}) {
+	logger := L()
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	errorLogger.Fatalf(format, v...)
+	if !logger.Enabled(ctx, lvl) {
+		return
+	}
+	var pcs [1]uintptr
+	// skip runtime.Callers, logf and the exported wrapper
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), lvl, fmt.Sprintf(format, v...), pcs[0])
+	_ = logger.Handler().Handle(ctx, record)
+}
+
+func Debug(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelDebug, format, v...)
+}
+
+func Info(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelInfo, format, v...)
+}
+
+func Warn(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelWarn, format, v...)
+}
+
+func Error(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelError, format, v...)
+}
+
+func Fatal(format string, v ...interface{}) {
+	logf(context.Background(), slog.LevelError, format, v...)
+	os.Exit(1)
+}
+
+// DebugCtx logs like Debug and adds the request ID carried by ctx.
+func DebugCtx(ctx context.Context, format string, v ...interface{}) {
+	logf(ctx, slog.LevelDebug, format, v...)
+}
+
+// InfoCtx logs like Info and adds the request ID carried by ctx.
+func InfoCtx(ctx context.Context, format string, v ...interface{}) {
+	logf(ctx, slog.LevelInfo, format, v...)
+}
+
+// WarnCtx logs like Warn and adds the request ID carried by ctx.
+func WarnCtx(ctx context.Context, format string, v ...interface{}) {
+	logf(ctx, slog.LevelWarn, format, v...)
+}
+
+// ErrorCtx logs like Error and adds the request ID carried by ctx.
+func ErrorCtx(ctx context.Context, format string, v ...interface{}) {
+	logf(ctx, slog.LevelError, format, v...)
+}
+
+// LevelName returns the current level, e.g. "INFO".
+func LevelName() string {
+	return strings.ToUpper(level.Level().String())
 }
@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose value is never logged.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+	"api_key":       true,
+	"x-api-key":     true,
+	"jwt_secret":    true,
+	"client_secret": true,
+	"key_hash":      true,
+}
+
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Bearer credentials in raw headers
+	{regexp.MustCompile(`(?i)\bbearer\s+\S+`), "Bearer " + redacted},
+	// JWTs anywhere in a message
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+	// Personal API keys, the public prefix is kept to tell keys apart
+	{regexp.MustCompile(`\b(cp_(?:[0-9a-f]{16}|[0-9a-f]{8}))_[A-Za-z0-9_-]+`), "${1}_" + redacted},
+	// key=value pairs such as password=... in query strings or DSNs
+	{regexp.MustCompile(`(?i)\b(password|secret|token|api_key)=[^\s&]+`), "${1}=" + redacted},
+	// credentials embedded in connection URLs
+	{regexp.MustCompile(`(://[^:/\s]+):[^@/\s]+@`), "${1}:" + redacted + "@"},
+}
+
+// Redact removes known secret formats from s.
+func Redact(s string) string {
+	for _, secret := range secretPatterns {
+		s = secret.pattern.ReplaceAllString(s, secret.replacement)
+	}
+	return s
+}
+
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, redacted)
+	}
+	if attr.Value.Kind() == slog.KindString {
+		return slog.String(attr.Key, Redact(attr.Value.String()))
+	}
+	return attr
+}
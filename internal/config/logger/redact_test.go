@@ -0,0 +1,19 @@
+package logger
+
+import "testing"
+
+func TestRedactAPIKeys(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"key cp_0123456789abcdef_c2VjcmV0 used", "key cp_0123456789abcdef_" + redacted + " used"},
+		{"key cp_01234567_c2VjcmV0 used", "key cp_01234567_" + redacted + " used"},
+		{"prefix cp_0123456789abcdef only", "prefix cp_0123456789abcdef only"},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
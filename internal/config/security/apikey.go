@@ -0,0 +1,69 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix marks CoinPilot personal API keys, keys look like
+// cp_<16 char id>_<secret>.
+const APIKeyPrefix = "cp_"
+
+const (
+	// apiKeyIDLength is 8 random bytes in hex, so prefixes do not collide
+	apiKeyIDLength = 16
+	// legacyAPIKeyIDLength is the id length of keys issued before, they keep
+	// working
+	legacyAPIKeyIDLength = 8
+)
+
+// GenerateAPIKey returns a new random API key together with its public prefix.
+func GenerateAPIKey() (key string, prefix string, err error) {
+	idBytes := make([]byte, apiKeyIDLength/2)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	prefix = APIKeyPrefix + hex.EncodeToString(idBytes)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, nil
+}
+
+// APIKeyPrefixOf extracts the public prefix from a raw key.
+func APIKeyPrefixOf(key string) (string, bool) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return "", false
+	}
+	// The id is hex and the secret may contain '_', a legacy key cannot be
+	// read as a longer id
+	for _, idLength := range []int{apiKeyIDLength, legacyAPIKeyIDLength} {
+		prefixLength := len(APIKeyPrefix) + idLength
+		if len(key) <= prefixLength+1 || key[prefixLength] != '_' {
+			continue
+		}
+		if _, err := hex.DecodeString(key[len(APIKeyPrefix):prefixLength]); err == nil {
+			return key[:prefixLength], true
+		}
+	}
+	return "", false
+}
+
+// HashAPIKey hashes a key for storage. Keys carry 256 bits of entropy, so a
+// fast hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckAPIKey compares a raw key against a stored hash in constant time.
+func CheckAPIKey(hash, key string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashAPIKey(key))) == 1
+}
@@ -0,0 +1,49 @@
+package security
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prefix) != len(APIKeyPrefix)+16 || !strings.HasPrefix(key, prefix+"_") {
+		t.Fatalf("key %q has prefix %q, want cp_ and 16 hex chars", key, prefix)
+	}
+	if got, ok := APIKeyPrefixOf(key); !ok || got != prefix {
+		t.Fatalf("APIKeyPrefixOf = %q, %v, want %q", got, ok, prefix)
+	}
+	if !CheckAPIKey(HashAPIKey(key), key) || CheckAPIKey(HashAPIKey(key), key+"x") {
+		t.Fatal("CheckAPIKey does not match the hash of the key only")
+	}
+}
+
+func TestAPIKeyPrefixOf(t *testing.T) {
+	tests := []struct {
+		key    string
+		prefix string
+		ok     bool
+	}{
+		{"cp_0123456789abcdef_c2VjcmV0", "cp_0123456789abcdef", true},
+		{"cp_0123456789abcdef_se_cr_et", "cp_0123456789abcdef", true},
+		// Keys issued with 4 byte ids keep working
+		{"cp_01234567_c2VjcmV0", "cp_01234567", true},
+		// A legacy secret with '_' where a longer id would end
+		{"cp_01234567_abcdefg_tail", "cp_01234567", true},
+		{"cp_0123456789abcdef_", "", false},
+		{"cp_0123456789abcdef", "", false},
+		{"cp_0123456789abcdeg_c2VjcmV0", "", false},
+		{"cp_0123_c2VjcmV0", "", false},
+		{"xx_0123456789abcdef_c2VjcmV0", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		prefix, ok := APIKeyPrefixOf(tt.key)
+		if prefix != tt.prefix || ok != tt.ok {
+			t.Errorf("APIKeyPrefixOf(%q) = %q, %v, want %q, %v", tt.key, prefix, ok, tt.prefix, tt.ok)
+		}
+	}
+}
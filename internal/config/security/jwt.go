@@ -4,50 +4,66 @@ import (
 	"errors"
 	"time"
 
-	"github.com/aq-simei/coin-pilot/internal/config/environment"
 	"github.com/aq-simei/coin-pilot/internal/config/logger"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateJWT(userID string) (string, error) {
+// Claims are the CoinPilot specific values carried by an access token.
+type Claims struct {
+	UserID string
+	Role   string
+}
+
+// JWTManager signs and verifies access tokens with a shared HMAC secret.
+type JWTManager struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewJWTManager(secret string, ttl time.Duration) *JWTManager {
+	return &JWTManager{secret: []byte(secret), ttl: ttl}
+}
+
+func (m *JWTManager) GenerateJWT(userID, role string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"role":    role,
+		"exp":     time.Now().Add(m.ttl).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secret := environment.GetEnv("JWT_SECRET")
-	return token.SignedString([]byte(secret))
+	return token.SignedString(m.secret)
 }
 
-func ParseJWT(tokenString string) (string, error) {
-	secret := environment.GetEnv("JWT_SECRET")
+func (m *JWTManager) ParseJWT(tokenString string) (*Claims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Ensure the signing method is as expected
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(secret), nil
+		return m.secret, nil
 	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Extract claims and validate
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		userID, ok := claims["user_id"].(string)
 		if !ok || userID == "" {
-			return "", errors.New("user_id claim not found")
+			return nil, errors.New("user_id claim not found")
 		}
 		if exp, ok := claims["exp"].(float64); ok {
 			if time.Unix(int64(exp), 0).Before(time.Now()) {
-				return "", errors.New("token has expired")
+				return nil, errors.New("token has expired")
 			}
 		}
-		logger.Info("JWT parsed successfully, user_id: %s", userID)
-		logger.Info("JWT expiration time: %v", time.Unix(int64(claims["exp"].(float64)), 0))
-		return userID, nil
+		// Tokens issued before roles existed carry no role claim
+		role, _ := claims["role"].(string)
+		logger.Debug("JWT parsed successfully, user_id: %s", userID)
+		logger.Debug("JWT expiration time: %v", time.Unix(int64(claims["exp"].(float64)), 0))
+		return &Claims{UserID: userID, Role: role}, nil
 	}
 
-	return "", errors.New("invalid token")
+	return nil, errors.New("invalid token")
 }
@@ -0,0 +1,82 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// webhookSecretPrefix tells webhook secrets apart from other credentials.
+const webhookSecretPrefix = "whsec_"
+
+// GenerateWebhookSecret returns a new secret for signing webhook
+// deliveries.
+func GenerateWebhookSecret() (string, error) {
+	token, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + token, nil
+}
+
+// SignWebhook returns the signature header of a webhook body sent at
+// timestamp: "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">".
+// Signing the timestamp lets receivers reject replayed deliveries.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// ErrNonPublicAddress is returned when dialing a webhook that resolves to a
+// loopback, private, link-local or otherwise internal address.
+var ErrNonPublicAddress = errors.New("webhook address is not public")
+
+// nonPublicPrefixes are the ranges IsPublicAddress refuses on top of those
+// the netip helpers cover.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// IsPublicAddress reports whether webhooks may be sent to ip. Loopback,
+// private, link-local (which holds cloud metadata services), multicast and
+// unspecified addresses are refused.
+func IsPublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// WebhookDialControl is a net.Dialer Control refusing connections to
+// addresses that are not public. It runs on the resolved address of every
+// connection, so a host that resolves to a public address when the webhook
+// is saved and to an internal one later is refused too.
+func WebhookDialControl(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrNonPublicAddress, addrPort.Addr())
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package security
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:93.184.216.34", true},
+	}
+	for _, tt := range tests {
+		if got := IsPublicAddress(netip.MustParseAddr(tt.ip)); got != tt.public {
+			t.Errorf("IsPublicAddress(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	if err := WebhookDialControl("tcp4", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("public address refused: %v", err)
+	}
+	if err := WebhookDialControl("tcp4", "169.254.169.254:80", nil); err == nil || !strings.Contains(err.Error(), ErrNonPublicAddress.Error()) {
+		t.Errorf("metadata address allowed, err = %v", err)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	signature := SignWebhook("whsec_test", time.Unix(1700000000, 0), []byte(`{"id":"1"}`))
+	if !strings.HasPrefix(signature, "t=1700000000,v1=") || len(signature) != len("t=1700000000,v1=")+64 {
+		t.Errorf("unexpected signature %q", signature)
+	}
+	if SignWebhook("other", time.Unix(1700000000, 0), []byte(`{"id":"1"}`)) == signature {
+		t.Error("signature does not depend on the secret")
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const startTimeKey = "metrics:start_time"
+
+// GormPlugin times every GORM operation and exports the connection pool
+// statistics of the database it is installed on.
+type GormPlugin struct {
+	// DBName labels the pool statistics
+	DBName string
+}
+
+func NewGormPlugin(dbName string) *GormPlugin {
+	return &GormPlugin{DBName: dbName}
+}
+
+func (p *GormPlugin) Name() string {
+	return "coinpilot:metrics"
+}
+
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := Registry.Register(collectors.NewDBStatsCollector(sqlDB, p.DBName)); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+	}
+
+	callbacks := db.Callback()
+	hooks := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+	for _, hook := range hooks {
+		if err := hook.before("metrics:before_"+hook.operation, startTimer); err != nil {
+			return err
+		}
+		if err := hook.after("metrics:after_"+hook.operation, observe(hook.operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(startTimeKey, time.Now())
+}
+
+func observe(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startTimeKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		DBQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			DBQueryErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
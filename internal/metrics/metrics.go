@@ -0,0 +1,115 @@
+// Package metrics holds the Prometheus collectors exposed on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "coinpilot"
+
+// Registry is a dedicated registry so only the collectors below, plus the Go
+// runtime and process ones, are exported.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Database query latency, by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	DBQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_errors_total",
+		Help:      "Database queries that failed, record not found excluded.",
+	}, []string{"operation", "table"})
+
+	RecordsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "records_created_total",
+		Help:      "Financial records created.",
+	})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Successful logins, by method (password or the OIDC provider name).",
+	}, []string{"method"})
+
+	FailedLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failed_logins_total",
+		Help:      "Rejected logins, by method and reason.",
+	}, []string{"method", "reason"})
+
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_attempts_total",
+		Help:      "Webhook delivery attempts, by outcome (succeeded, retrying or failed).",
+	}, []string{"outcome"})
+
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Background job attempts, by kind and outcome (succeeded, retrying or dead).",
+	}, []string{"kind", "outcome"})
+)
+
+// Reasons used with FailedLogins.
+const (
+	ReasonInvalidCredentials = "invalid_credentials"
+	ReasonThrottled          = "throttled"
+	ReasonSuspended          = "suspended"
+	ReasonIdentity           = "identity"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		HTTPRequestsInFlight,
+		DBQueryDuration,
+		DBQueryErrors,
+		RecordsCreated,
+		Logins,
+		FailedLogins,
+		WebhookDeliveries,
+		JobRuns,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
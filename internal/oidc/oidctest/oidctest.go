@@ -0,0 +1,181 @@
+// Package oidctest runs a fake OpenID Connect provider for tests. It serves
+// discovery, a key set and a token endpoint checking PKCE like a real
+// provider, and signs id_tokens for the identity a test signs in as.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aq-simei/coin-pilot/internal/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ClientID    = "coin-pilot-test"
+	RedirectURL = "http://coin-pilot.test/callback"
+	keyID       = "test-key"
+)
+
+// Identity is the account a test signs in as. EmailVerified is a bool or a
+// string, some providers send the latter.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified any
+	Name          string
+}
+
+// Server is a running fake provider, closed when the test ends.
+type Server struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// grant is an authorization code waiting to be exchanged.
+type grant struct {
+	challenge string
+	nonce     string
+	identity  Identity
+}
+
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{key: key, grants: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("POST /token", s.token)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Provider returns a provider named name logging in with this server.
+func (s *Server) Provider(name string) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Name:        name,
+		IssuerURL:   s.URL,
+		ClientID:    ClientID,
+		RedirectURL: RedirectURL,
+	}, s.Client())
+}
+
+// SignIn plays the user agent at the authorization endpoint: it signs in as
+// identity and returns the state and code the provider redirects back with.
+func (s *Server) SignIn(t testing.TB, authURL string, identity Identity) (string, string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != ClientID || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without PKCE or for another client: %s", authURL)
+	}
+	code, err := oidc.RandomString(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grants[code] = grant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), identity: identity}
+	return query.Get("state"), code
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	encode := func(value *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(value.Bytes())
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kid": keyID,
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"n":   encode(s.key.N),
+		"e":   encode(big.NewInt(int64(s.key.E))),
+	}}})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != ClientID {
+		tokenError(w, "invalid_request", "unexpected grant type or client")
+		return
+	}
+
+	// Codes are single use, even when the exchange fails
+	s.mu.Lock()
+	code := r.PostForm.Get("code")
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+	if !ok {
+		tokenError(w, "invalid_grant", "unknown or used code")
+		return
+	}
+	if oidc.CodeChallengeS256(r.PostForm.Get("code_verifier")) != g.challenge {
+		tokenError(w, "invalid_grant", "code_verifier does not match the code_challenge")
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            ClientID,
+		"sub":            g.identity.Subject,
+		"email":          g.identity.Email,
+		"email_verified": g.identity.EmailVerified,
+		"name":           g.identity.Name,
+		"nonce":          g.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = keyID
+	signed, err := idToken.SignedString(s.key)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": "access", "token_type": "Bearer", "id_token": signed})
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
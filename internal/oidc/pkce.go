@@ -0,0 +1,27 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// RandomString returns a URL safe random string built from n random bytes.
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// NewCodeVerifier generates a PKCE code verifier (RFC 7636, 43 chars).
+func NewCodeVerifier() (string, error) {
+	return RandomString(32)
+}
+
+// CodeChallengeS256 derives the S256 code challenge for a verifier.
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
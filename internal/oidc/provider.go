@@ -0,0 +1,293 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrMissingIDToken    = errors.New("token response did not include an id_token")
+	ErrNonceMismatch     = errors.New("id_token nonce does not match")
+	ErrUnknownSigningKey = errors.New("id_token signed with unknown key")
+)
+
+// Config describes a single OpenID Connect provider.
+type Config struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims holds the identity information extracted from a verified id_token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+}
+
+// Provider performs the authorization code flow with PKCE against an OIDC
+// issuer. Discovery and key sets are fetched lazily and cached.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      map[string]any
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	config.IssuerURL = strings.TrimSuffix(config.IssuerURL, "/")
+	return &Provider{config: config, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL builds the URL the user agent is redirected to in order to
+// start the login.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the claims of
+// the verified id_token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, token.Error, token.Description)
+	}
+	if token.IDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+
+	return p.verifyIDToken(ctx, token.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, rawToken, nonce string) (*Claims, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	return &Claims{
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: isTrue(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// some providers encode email_verified as a string
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	doc := &discoveryDocument{}
+	if err := p.getJSON(ctx, p.config.IssuerURL+"/.well-known/openid-configuration", doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed for %s: %w", p.config.Name, err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.config.IssuerURL {
+		return nil, fmt.Errorf("issuer mismatch: expected %s, got %s", p.config.IssuerURL, doc.Issuer)
+	}
+	p.discovery = doc
+	return doc, nil
+}
+
+func (p *Provider) getKey(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	// Unknown kid: the provider may have rotated its keys, so refresh once
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// Tokens without a kid are accepted when the set holds a single key
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return err
+	}
+
+	set := &jsonWebKeySet{}
+	if err := p.getJSON(ctx, doc.JWKSURI, set); err != nil {
+		return fmt.Errorf("fetching jwks failed: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
@@ -0,0 +1,116 @@
+package oidc_test
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+
+	"github.com/aq-simei/coin-pilot/internal/oidc"
+	"github.com/aq-simei/coin-pilot/internal/oidc/oidctest"
+)
+
+// startLogin begins a login with p, signs in as identity and returns the
+// code along with the verifier and nonce of the login.
+func startLogin(t *testing.T, server *oidctest.Server, p *oidc.Provider, identity oidctest.Identity) (string, string, string) {
+	t.Helper()
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthCodeURL(context.Background(), "state", nonce, oidc.CodeChallengeS256(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	_, code := server.SignIn(t, authURL, identity)
+	return code, verifier, nonce
+}
+
+func TestExchange(t *testing.T) {
+	server := oidctest.NewServer(t)
+	p := server.Provider("mock")
+	identity := oidctest.Identity{Subject: "sub-1", Email: "Ada@Example.com", EmailVerified: true, Name: "Ada"}
+
+	// verifier and nonce replace the ones of the login when set
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		ok       bool
+		wantErr  error
+	}{
+		{name: "valid", ok: true},
+		{name: "verifier of another login", verifier: "another-verifier-another-verifier-another-v"},
+		{name: "nonce of another login", nonce: "another-nonce", wantErr: oidc.ErrNonceMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, verifier, nonce := startLogin(t, server, p, identity)
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			claims, err := p.Exchange(context.Background(), code, verifier, nonce)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("Exchange succeeded, claims = %+v", claims)
+				}
+				if tt.wantErr != nil && !stderrors.Is(err, tt.wantErr) {
+					t.Fatalf("Exchange err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if claims.Subject != "sub-1" || claims.Email != "ada@example.com" || !claims.EmailVerified || claims.Name != "Ada" {
+				t.Fatalf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeIsSingleUse(t *testing.T) {
+	server := oidctest.NewServer(t)
+	p := server.Provider("mock")
+	code, verifier, nonce := startLogin(t, server, p, oidctest.Identity{Subject: "sub-1", Email: "ada@example.com", EmailVerified: true})
+
+	if _, err := p.Exchange(context.Background(), code, verifier, nonce); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Fatal("second Exchange of the same code succeeded")
+	}
+}
+
+func TestExchangeEmailVerified(t *testing.T) {
+	server := oidctest.NewServer(t)
+	p := server.Provider("mock")
+	tests := []struct {
+		value any
+		want  bool
+	}{
+		{true, true},
+		{false, false},
+		{"true", true},
+		{"TRUE", true},
+		{"false", false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		code, verifier, nonce := startLogin(t, server, p, oidctest.Identity{Subject: "sub-1", Email: "ada@example.com", EmailVerified: tt.value})
+		claims, err := p.Exchange(context.Background(), code, verifier, nonce)
+		if err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		if claims.EmailVerified != tt.want {
+			t.Errorf("email_verified %#v read as %v, want %v", tt.value, claims.EmailVerified, tt.want)
+		}
+	}
+}
@@ -79,6 +79,19 @@ func NotFound(c *gin.Context, message string) {
 	})
 }
 
+func TooManyRequests(c *gin.Context, message string) {
+	if message == "" {
+		message = "Too many requests"
+	}
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, Response{
+		Success: false,
+		Error: &ErrorData{
+			Code:    http.StatusTooManyRequests,
+			Message: message,
+		},
+	})
+}
+
 func InternalServerError(c *gin.Context, message string) {
 	if message == "" {
 		message = "Internal server error"
@@ -1,33 +1,203 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/aq-simei/coin-pilot/api/router"
+	"github.com/aq-simei/coin-pilot/internal/config"
 	"github.com/aq-simei/coin-pilot/internal/config/database"
 	"github.com/aq-simei/coin-pilot/internal/config/logger"
+	"github.com/aq-simei/coin-pilot/internal/tracing"
+	"gorm.io/gorm"
 )
 
+// readHeaderTimeout protects against clients that never finish sending
+// their headers.
+const readHeaderTimeout = 10 * time.Second
+
+const usage = `Usage:
+  coin-pilot [flags]                  start the API server
+  coin-pilot [flags] migrate up       apply all pending migrations
+  coin-pilot [flags] migrate down     roll back the last applied migration
+  coin-pilot [flags] migrate status   list migrations and whether they are applied
+
+Flags:
+  -config path   YAML or TOML config file (or COINPILOT_CONFIG)
+  -port n        HTTP port, overrides app.port
+  -env name      development or production, overrides app.env
+  -log-level l   debug, info, warn or error, overrides log.level`
+
 func main() {
 	// Initialize logger
 	logger.Init()
 
+	// Load and validate configuration, refusing to start on missing secrets
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, usage)
+		logger.Fatal("invalid configuration: %v", err)
+	}
+
+	if err := logger.Configure(cfg.Log.Level, cfg.Log.Format); err != nil {
+		logger.Fatal("invalid log configuration: %v", err)
+	}
+
 	// Load DB connection
-	dbInstance := database.NewDB()
-	database.RunMigrations(dbInstance)
+	dbInstance := database.NewDB(cfg.Database)
 
-	// Initialize Router
-	router := router.NewRouter(dbInstance)
+	if len(args) > 0 {
+		if args[0] != "migrate" {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		runMigrate(dbInstance, args[1:])
+		closeDB(dbInstance)
+		return
+	}
+
+	// Schema changes are applied explicitly through `migrate up`
+	pending, err := database.PendingMigrations(dbInstance)
+	if err != nil {
+		logger.Fatal("failed to read migration state: %v", err)
+	}
+	if len(pending) > 0 {
+		logger.Warn("%d pending migration(s), /readyz fails until `coin-pilot migrate up` is run: %v", len(pending), pending)
+	}
+
+	if err := serve(cfg, dbInstance); err != nil {
+		logger.Fatal("server error: %v", err)
+	}
+}
+
+// serve runs the HTTP server until SIGINT or SIGTERM, then stops accepting
+// connections, lets in-flight requests finish and the background jobs stop
+// within the shutdown timeout, flushes traces and closes the database pool.
+func serve(cfg *config.Config, db *gorm.DB) error {
+	defer closeDB(db)
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.App.Port),
+		Handler:           router.NewRouter(db, cfg),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background jobs stop with the first signal, a job cut short runs again
+	// once its lock expires
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		router.NewJobRunner(db, cfg).Run(ctx)
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Server running on port %d", cfg.App.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		// The server never started or died, only the jobs to stop
+		stop()
+		background.Wait()
+		_ = shutdownTracing(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal kills the process right away
+	stop()
+
+	timeout := time.Duration(cfg.App.ShutdownTimeout)
+	logger.Info("Shutting down, draining in-flight requests for up to %s", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("requests still running after %s were dropped: %v", timeout, err)
+	}
+	if !waitFor(shutdownCtx, &background) {
+		logger.Error("background jobs still running after %s, closing the database anyway", timeout)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("failed to flush traces: %v", err)
+	}
+	logger.Info("Server stopped")
+	return nil
+}
+
+// waitFor waits for wg until ctx is done, it reports whether wg finished.
+func waitFor(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func closeDB(db *gorm.DB) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return
+	}
+	if err := sqlDB.Close(); err != nil {
+		logger.Error("failed to close database pool: %v", err)
+	}
+}
 
-	// Read port from env or fallback
-	port := os.Getenv("APP_PORT")
-	if port == "" {
-		port = "8080"
+func runMigrate(db *gorm.DB, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
 
-	// Start server
-	logger.Info("Server running on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		logger.Fatal("failed to start server: %v", err)
+	switch args[0] {
+	case "up":
+		if err := database.MigrateUp(db); err != nil {
+			logger.Fatal("migration failed: %v", err)
+		}
+		logger.Info("Migrations applied successfully")
+	case "down":
+		if err := database.MigrateDown(db); err != nil {
+			logger.Fatal("rollback failed: %v", err)
+		}
+		logger.Info("Last migration rolled back successfully")
+	case "status":
+		states, err := database.MigrationStatus(db)
+		if err != nil {
+			logger.Fatal("failed to read migration state: %v", err)
+		}
+		for _, state := range states {
+			status := "pending"
+			if state.Applied {
+				status = "applied"
+			}
+			fmt.Printf("%-8s %s\n", status, state.ID)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
 }